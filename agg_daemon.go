@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"internal/config"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/joncaudill/gator/internal/database"
+)
+
+const aggPidFileName = ".gator-agg.pid"
+
+type aggSignals struct {
+	//channels the aggregator loop listens on, fed by watchSignals
+	stop   chan struct{}
+	reload chan struct{}
+}
+
+func watchSignals(ctx context.Context, s *state, cancelWork context.CancelFunc) *aggSignals {
+	//func that turns os signals into aggregator events
+	//the first SIGINT/SIGTERM asks the loop to stop after the feed it is working on,
+	//a second one cancels the in-flight work, and SIGHUP asks for the config to be reloaded
+	signals := &aggSignals{stop: make(chan struct{}), reload: make(chan struct{}, 1)}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sigs)
+		stopping := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-sigs:
+				if sig == syscall.SIGHUP {
+					select {
+					case signals.reload <- struct{}{}:
+					default:
+					}
+					continue
+				}
+				if stopping {
+					s.logger.Warn("received second signal, cancelling in-flight work", "signal", sig.String())
+					cancelWork()
+					return
+				}
+				stopping = true
+				s.logger.Info("finishing in-flight feeds before exiting", "signal", sig.String())
+				close(signals.stop)
+			}
+		}
+	}()
+
+	return signals
+}
+
+type aggWorkers struct {
+	//webhook deliveries and post hooks run in the background, so they don't hold up fetching
+	wg sync.WaitGroup
+	//asks the webhook worker for a round of deliveries, a round already asked for covers later asks
+	webhooks chan struct{}
+}
+
+func startAggWorkers(ctx context.Context, s *state) *aggWorkers {
+	//func that starts the webhook worker, which delivers whatever is due each time it is woken
+	w := &aggWorkers{webhooks: make(chan struct{}, 1)}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-w.webhooks:
+				if !ok {
+					return
+				}
+				deliverWebhooks(ctx, s)
+			}
+		}
+	}()
+	return w
+}
+
+func (w *aggWorkers) deliverWebhooks() {
+	select {
+	case w.webhooks <- struct{}{}:
+	default:
+	}
+}
+
+func (w *aggWorkers) runPostHooks(ctx context.Context, s *state, feed database.Feed, posts []hookPost, log *slog.Logger) {
+	//func that runs the post hooks of a feed's new posts in the background
+	//the hooks' slots still limit how many run at once
+	if len(posts) == 0 {
+		return
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		runPostHooks(ctx, s, feed, posts, log)
+	}()
+}
+
+func (w *aggWorkers) wait() {
+	//func that waits for the webhook round that was asked for last and any running post hooks
+	//it is called once the aggregator loop has stopped, so nothing asks for more work
+	close(w.webhooks)
+	w.wg.Wait()
+}
+
+func (a *aggSignals) stopping() bool {
+	//func that reports whether a shutdown has been requested
+	select {
+	case <-a.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func aggPidFilePath(cfg *config.Config) (string, error) {
+	//func that returns the pid file path from the config, defaulting to the home directory
+	if cfg.AggPidFile != "" {
+		return cfg.AggPidFile, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, aggPidFileName), nil
+}
+
+func reloadConfig(s *state) error {
+	//func that re-reads the config file and rebuilds the feed fetcher and post hooks from it
+	//the database connection and servers are not reopened, so db_url, metrics_addr and websub changes need a restart
+	cfg, err := config.Read()
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+	fetcher, err := newFeedFetcher(&cfg)
+	if err != nil {
+		return fmt.Errorf("could not read fetch settings: %w", err)
+	}
+	hooks, err := newPostHooks(&cfg)
+	if err != nil {
+		return fmt.Errorf("invalid post_hooks: %w", err)
+	}
+	err = reopenLogger(s.logger, &cfg)
+	if err != nil {
+		return fmt.Errorf("could not set up logging: %w", err)
+	}
+	//the servers and background workers read the fetcher, hooks and logger while this runs,
+	//so those are swapped atomically; the config itself is only read by the aggregator loop
+	*s.config = cfg
+	s.fetcher.Store(fetcher)
+	s.hooks.Store(hooks)
+	return nil
+}
+
+func runAggOnce(ctx context.Context, s *state, signals *aggSignals) error {
+	//func that scrapes every feed once and returns, for running agg from cron
+	feeds, err := s.db.GetFeeds(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get feeds: %w", err)
+	}
+
+	failed := 0
+	for range feeds {
+		if signals.stopping() || ctx.Err() != nil {
+			break
+		}
+		err := scrapeFeeds(ctx, s)
+		if err != nil {
+			failed++
+		}
+		s.workers.deliverWebhooks()
+	}
+
+	if s.config.AggSendDigests && !signals.stopping() {
+		sendAggDigests(ctx, s)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d feeds could not be scraped", failed, len(feeds))
+	}
+	return nil
+}
+
+func sendAggDigests(ctx context.Context, s *state) {
+	//func that sends the digests that are due, when agg_send_digests is set
+	//errors are only logged, so a bad smtp server does not stop the aggregator
+	sent, err := sendDueDigests(ctx, s)
+	if err != nil {
+		s.logger.Error("could not send digests", "err", err)
+	}
+	if sent > 0 {
+		s.logger.Info("digests sent", "count", sent)
+	}
+}
+
+func runAggLoop(ctx context.Context, s *state, signals *aggSignals, interval time.Duration) error {
+	//func that scrapes a feed every interval until it is asked to stop
+	//scrape errors are logged by scrapeFeeds and the loop carries on with the next feed
+
+	//pushes from websub hubs are stored here between scrapes, a nil channel never receives when websub is off
+	var pushes chan webSubPush
+	if s.websub != nil {
+		pushes = s.websub.pushes
+	}
+
+	//do an initial scrape of the feeds before starting the ticker
+	scrapeFeeds(ctx, s)
+	s.workers.deliverWebhooks()
+	if s.websub != nil {
+		renewWebSubs(ctx, s)
+	}
+	if s.config.AggSendDigests {
+		sendAggDigests(ctx, s)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-signals.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		case <-signals.reload:
+			err := reloadConfig(s)
+			if err != nil {
+				s.logger.Error("could not reload config", "err", err)
+				continue
+			}
+			s.logger.Info("config reloaded")
+		case push := <-pushes:
+			if signals.stopping() {
+				return nil
+			}
+			ingestWebSubPush(ctx, s, push)
+			s.workers.deliverWebhooks()
+		case <-ticker.C:
+			if signals.stopping() {
+				return nil
+			}
+			scrapeFeeds(ctx, s)
+			s.workers.deliverWebhooks()
+			if s.websub != nil {
+				renewWebSubs(ctx, s)
+			}
+			if s.config.AggSendDigests {
+				sendAggDigests(ctx, s)
+			}
+		}
+	}
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
-	"encoding/xml"
+	"database/sql"
+	"errors"
 	"fmt"
 	"html"
-	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,33 +17,81 @@ import (
 	"github.com/joncaudill/gator/internal/database"
 )
 
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
+var errParseFeed = errors.New("could not parse feed")
+
+func fetchFeed(ctx context.Context, s *state, feedURL string) (*RSSFeed, error) {
 	//fetches a given RSS feed from a URL
-	request, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not create request: %w", err)
-	}
+	//redirects are followed here so we can keep track of where the feed permanently moved to
+	fetcher := s.fetcher.Load()
+	movedTo := ""
+	permanent := true
+	requestURL := feedURL
+	var response *http.Response
+	var release func()
+	for redirects := 0; ; redirects++ {
+		if redirects > maxRedirects {
+			return nil, fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
 
-	//set the request headers
-	request.Header.Set("User-Agent", "gator-cli")
+		var err error
+		response, release, err = fetcher.get(ctx, requestURL)
+		if err != nil {
+			return nil, err
+		}
 
-	//use client with the context
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil {
-		return nil, fmt.Errorf("could not fetch feed: %w", err)
+		location := response.Header.Get("Location")
+		if response.StatusCode < 300 || response.StatusCode > 399 || location == "" {
+			break
+		}
+		response.Body.Close()
+		release()
+
+		nextURL, err := response.Request.URL.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse redirect location: %w", err)
+		}
+		requestURL = nextURL.String()
+
+		switch response.StatusCode {
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+			if permanent {
+				movedTo = requestURL
+			}
+		default:
+			permanent = false
+		}
 	}
+	defer release()
 	defer response.Body.Close()
 
-	//parse the response body
-	var feed RSSFeed
-	body, err := io.ReadAll(response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, &fetchStatusError{URL: requestURL,
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+		}
+	}
+
+	body, err := readBody(response, fetcher.maxBodyBytes)
 	if err != nil {
-		return nil, fmt.Errorf("could not read response body: %w", err)
+		return nil, err
 	}
-	err = xml.Unmarshal(body, &feed)
+	feed, err := parseFeed(body, response.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	feed.MovedTo = movedTo
+	feed.StatusCode = response.StatusCode
+	discoverHubs(feed, response)
+
+	return feed, nil
+}
+
+func parseFeed(body []byte, contentType string) (*RSSFeed, error) {
+	//func that parses a feed body, whether it was fetched or pushed by a websub hub
+	var feed RSSFeed
+	err := unmarshalFeedXML(body, contentType, &feed)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse feed: %w", err)
+		return nil, fmt.Errorf("%w: %w", errParseFeed, err)
 	}
 
 	//unescape the HTML entities in the feed
@@ -54,54 +105,379 @@ func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 	return &feed, nil
 }
 
-func scrapeFeeds(s *state) error {
+func siteLink(feed *RSSFeed) string {
+	//returns the first non-empty channel link
+	//atom:link elements also match the link tag but carry their url in an attribute
+	for _, link := range feed.Channel.Link {
+		if link := strings.TrimSpace(link.Text); link != "" {
+			return link
+		}
+	}
+	return ""
+}
+
+func moveFeed(ctx context.Context, s *state, feed database.Feed, newURL string) error {
+	//func that points a feed at the url it was permanently redirected to
+	//the old url is kept as an alias so lookups by it still find the feed
+	newURL, err := normalizeFeedURL(newURL)
+	if err != nil {
+		return fmt.Errorf("could not normalize url: %w", err)
+	}
+	newKey, err := feedURLKey(newURL)
+	if err != nil {
+		return fmt.Errorf("could not get url key: %w", err)
+	}
+	if newURL == feed.Url {
+		return nil
+	}
+
+	err = s.db.UpdateFeedUrl(ctx,
+		database.UpdateFeedUrlParams{ID: feed.ID,
+			Url:    newURL,
+			UrlKey: newKey,
+		})
+	if err != nil {
+		return fmt.Errorf("could not update feed url: %w", err)
+	}
+
+	if newKey == feed.UrlKey {
+		return nil
+	}
+	err = s.db.CreateFeedUrlAlias(ctx,
+		database.CreateFeedUrlAliasParams{ID: uuid.New(),
+			CreatedAt: time.Now(),
+			Url:       feed.Url,
+			UrlKey:    feed.UrlKey,
+			FeedID:    feed.ID,
+		})
+	if err != nil {
+		return fmt.Errorf("could not create feed url alias: %w", err)
+	}
+	return nil
+}
+
+func recordFetchResult(ctx context.Context, s *state, feed database.Feed, feedRSS *RSSFeed, fetchErr error) {
+	//func that stores the status code and error of the last fetch of a feed
+	params := database.SetFeedFetchResultParams{ID: feed.ID}
+	var statusErr *fetchStatusError
+	switch {
+	case fetchErr == nil:
+		params.LastFetchStatus = sql.NullInt32{Int32: int32(feedRSS.StatusCode), Valid: true}
+	case errors.As(fetchErr, &statusErr):
+		params.LastFetchStatus = sql.NullInt32{Int32: int32(statusErr.StatusCode), Valid: true}
+		params.LastFetchError = fetchErr.Error()
+	default:
+		params.LastFetchError = fetchErr.Error()
+	}
+
+	err := s.db.SetFeedFetchResult(ctx, params)
+	if err != nil {
+		s.logger.Error("could not record fetch result", "feed_id", feed.ID, "err", err)
+	}
+}
+
+func scrapeFeeds(ctx context.Context, s *state) error {
 	//scrapeFeeds fetches the next feed to fetch from the database
 	//using GetFeedToFetch query and then fetches the feed
 	//afterward it marks the feed as fetched using the MarkFeedFetched query
-	//and then iterates over all the items in the feed and prints their titles to the console
-	feed, err := s.db.GetFeedToFetch(context.Background())
+	//and then stores every item in the feed as a post, logging a summary of what changed
+	feed, err := s.db.GetFeedToFetch(ctx)
 	if err != nil {
+		s.logger.Error("could not get feed to fetch", "err", err)
 		return fmt.Errorf("could not get feed to fetch: %w", err)
 	}
+	log := s.logger.With("feed_id", feed.ID, "url", feed.Url)
 
-	err = s.db.MarkFeedFetched(context.Background(), feed.ID)
+	err = s.db.MarkFeedFetched(ctx, feed.ID)
 	if err != nil {
+		log.Error("could not mark feed fetched", "err", err)
 		return fmt.Errorf("could not mark feed fetched: %w", err)
 	}
 
-	feedURL := feed.Url
-	feedRSS, err := fetchFeed(context.Background(), feedURL)
+	started := time.Now()
+	feedRSS, err := fetchFeed(ctx, s, feed.Url)
+	duration := time.Since(started)
+	recordFetchResult(ctx, s, feed, feedRSS, err)
+	metricFetchDuration.Observe(duration.Seconds())
 	if err != nil {
+		status := "error"
+		var statusErr *fetchStatusError
+		if errors.As(err, &statusErr) {
+			log = log.With("status", statusErr.StatusCode)
+			status = strconv.Itoa(statusErr.StatusCode)
+		}
+		if errors.Is(err, errParseFeed) {
+			metricParseErrors.WithLabelValues("feed").Inc()
+		}
+		metricFetches.WithLabelValues(status).Inc()
+		log.Error("could not fetch feed", "duration", duration, "err", err)
 		return fmt.Errorf("could not fetch feed: %w", err)
 	}
+	log = log.With("status", feedRSS.StatusCode, "duration", duration)
+	metricFetches.WithLabelValues(strconv.Itoa(feedRSS.StatusCode)).Inc()
+
+	if feedRSS.MovedTo != "" {
+		err = moveFeed(ctx, s, feed, feedRSS.MovedTo)
+		if err != nil {
+			log.Warn("could not update moved feed url", "moved_to", feedRSS.MovedTo, "err", err)
+		} else {
+			log.Info("feed moved permanently", "moved_to", feedRSS.MovedTo)
+		}
+	}
+
+	if s.websub != nil {
+		subscribeWebSub(ctx, s, feed, feedRSS, log)
+	}
 
+	itemsNew, itemsUpdated, itemsSkipped := storeFeedItems(ctx, s, feed, feedRSS, log)
+	log.Info("feed scraped",
+		"items_new", itemsNew,
+		"items_updated", itemsUpdated,
+		"items_skipped", itemsSkipped,
+	)
+	return nil
+}
+
+func storeFeedItems(ctx context.Context, s *state, feed database.Feed, feedRSS *RSSFeed, log *slog.Logger) (int, int, int) {
+	//func that stores every item of a fetched or pushed feed as a post, and runs what follows new posts
+	//it returns how many posts were new, updated and skipped
+	itemsNew, itemsUpdated, itemsDuplicate, itemsSkipped := 0, 0, 0, 0
+	var newPosts []hookPost
 	for _, item := range feedRSS.Channel.Item {
-		//fmt.Printf("  * %s\n", item.Title)
-		publishedAt, err := time.Parse(time.RFC1123Z, item.PubDate)
+		publishedAt, err := parsePubDate(item.PubDate)
 		if err != nil {
-			return fmt.Errorf("could not parse time: %w", err)
+			log.Warn("skipping item with bad publish date", "item_url", item.Link, "pub_date", item.PubDate)
+			metricParseErrors.WithLabelValues("item_date").Inc()
+			itemsSkipped++
+			continue
 		}
 		if item.Title == "" {
 			item.Title = "No Title"
 		}
-		_, err = s.db.CreatePost(context.Background(),
-			database.CreatePostParams{ID: uuid.New(),
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-				Title:       item.Title,
-				Url:         item.Link,
-				Description: item.Description,
-				PublishedAt: publishedAt,
-				FeedID:      feed.ID,
-			})
-		if err != nil {
-			if !strings.Contains(err.Error(), "duplicate key") {
-				fmt.Printf("could not create feed item: %s", err)
+		summarySource := item.Description
+		if strings.TrimSpace(summarySource) == "" {
+			summarySource = item.Content
+		}
+		enclosureLength, _ := strconv.ParseInt(strings.TrimSpace(item.Enclosure.Length), 10, 64)
+		canonicalURL := canonicalPostURL(item.Link)
+		if origLink := strings.TrimSpace(item.OrigLink); origLink != "" {
+			canonicalURL = canonicalPostURL(origLink)
+		}
+		params := database.UpsertPostParams{ID: uuid.New(),
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+			Title:           item.Title,
+			Url:             item.Link,
+			Description:     sanitizeHTML(item.Description),
+			Summary:         summarizeHTML(summarySource),
+			PlainText:       plainTextHTML(summarySource),
+			PublishedAt:     publishedAt,
+			FeedID:          feed.ID,
+			Content:         sanitizeHTML(item.Content),
+			Author:          itemAuthor(item),
+			Guid:            strings.TrimSpace(item.GUID),
+			CommentsUrl:     strings.TrimSpace(item.Comments),
+			EnclosureUrl:    strings.TrimSpace(item.Enclosure.URL),
+			EnclosureType:   strings.TrimSpace(item.Enclosure.Type),
+			EnclosureLength: max(enclosureLength, 0),
+			CanonicalUrl:    canonicalURL,
+		}
+		post, err := s.db.UpsertPost(ctx, params)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			//the post already exists and has not changed
+			itemsDuplicate++
+			itemsSkipped++
+		case err != nil:
+			log.Error("could not store feed item", "item_url", item.Link, "err", err)
+			itemsSkipped++
+		case post.Inserted:
+			itemsNew++
+		default:
+			itemsUpdated++
+		}
+		if err == nil {
+			err = storeCategories(ctx, s, post.ID, item.Categories)
+			if err != nil {
+				log.Warn("could not store item categories", "item_url", item.Link, "err", err)
+			}
+			if item.Enclosure.URL != "" {
+				err = storeEpisode(ctx, s, post.ID, item)
+				if err != nil {
+					log.Warn("could not store episode", "item_url", item.Link, "err", err)
+				}
+			}
+			if feed.FetchFullContent && item.Link != "" && (post.Inserted || !post.FullContentFetched) {
+				if pageCanonical := storeFullContent(ctx, s, post.ID, item.Link, log); pageCanonical != "" {
+					canonicalURL = pageCanonical
+				}
+			}
+			if post.Inserted {
+				err = assignStory(ctx, s, post, feed.ID, canonicalURL, item.Title, publishedAt)
+				if err != nil {
+					log.Warn("could not group post into a story", "item_url", item.Link, "err", err)
+				}
+				applyIngestRules(ctx, s, post.ID, log)
+				queueWebhooks(ctx, s, post.ID, log)
+				newPosts = append(newPosts, newHookPost(post, params, item.Categories, feed))
 			}
 		}
+	}
+
+	s.workers.runPostHooks(ctx, s, feed, newPosts, log)
+
+	metricPosts.WithLabelValues("inserted").Add(float64(itemsNew))
+	metricPosts.WithLabelValues("updated").Add(float64(itemsUpdated))
+	metricPosts.WithLabelValues("duplicate").Add(float64(itemsDuplicate))
+
+	return itemsNew, itemsUpdated, itemsSkipped
+}
+
+func itemAuthor(item RSSItem) string {
+	//func that returns the author of an item, preferring dc:creator
+	//the rss author element is an email address, often followed by the name in brackets, e.g. "jo@example.com (Jo Smith)"
+	if creator := strings.TrimSpace(item.Creator); creator != "" {
+		return creator
+	}
+	for _, author := range item.Authors {
+		author = strings.TrimSpace(author)
+		if author == "" {
+			continue
+		}
+		if open := strings.Index(author, " ("); open > 0 && strings.HasSuffix(author, ")") && strings.Contains(author[:open], "@") {
+			return author[open+2 : len(author)-1]
+		}
+		return author
+	}
+	return ""
+}
+
+func storeFullContent(ctx context.Context, s *state, postID uuid.UUID, link string, log *slog.Logger) string {
+	//func that fetches the page a post links to and stores its article as the post's full content
+	//it returns the canonical url the page gave, so the post can be grouped into a story by it
+	//a failed fetch is left to be tried again the next time the item changes
+	page, err := fetchArticle(ctx, s, link)
+	switch {
+	case errors.Is(err, errNoArticle):
+		metricArticleFetches.WithLabelValues("no_article").Inc()
+		log.Warn("could not find article in page", "item_url", link)
+	case err != nil:
+		metricArticleFetches.WithLabelValues("error").Inc()
+		log.Warn("could not fetch article", "item_url", link, "err", err)
+		return ""
+	default:
+		metricArticleFetches.WithLabelValues("extracted").Inc()
+	}
+
+	canonicalURL := canonicalPostURL(page.canonicalURL)
+	err = s.db.SetPostFullContent(ctx, database.SetPostFullContentParams{ID: postID, FullContent: page.content, CanonicalUrl: canonicalURL})
+	if err != nil {
+		log.Warn("could not store full content", "item_url", link, "err", err)
+		return ""
+	}
+	return canonicalURL
+}
 
+func applyIngestRules(ctx context.Context, s *state, postID uuid.UUID, log *slog.Logger) {
+	//func that runs the read and star rules of every follower of the feed on a new post
+	//categories are matched too, so this runs once they are stored
+	if err := s.db.ApplyReadRules(ctx, postID); err != nil {
+		log.Warn("could not apply read rules", "post_id", postID, "err", err)
 	}
+	if err := s.db.ApplyStarRules(ctx, postID); err != nil {
+		log.Warn("could not apply star rules", "post_id", postID, "err", err)
+	}
+}
+
+func storeCategories(ctx context.Context, s *state, postID uuid.UUID, categories []string) error {
+	//func that replaces the categories of a post with the ones from its item
+	err := s.db.DeletePostCategories(ctx, postID)
+	if err != nil {
+		return fmt.Errorf("could not clear post categories: %w", err)
+	}
+	for _, category := range categories {
+		category = strings.TrimSpace(category)
+		if category == "" {
+			//itunes:category also matches, and keeps its name in an attribute
+			continue
+		}
+		err = s.db.CreatePostCategory(ctx, database.CreatePostCategoryParams{
+			ID:     uuid.New(),
+			PostID: postID,
+			Name:   category,
+		})
+		if err != nil {
+			return fmt.Errorf("could not store post category: %w", err)
+		}
+	}
+	return nil
+}
 
+func storeEpisode(ctx context.Context, s *state, postID uuid.UUID, item RSSItem) error {
+	//func that stores the podcast details of an item that has an enclosure
+	err := s.db.UpsertEpisode(ctx, database.UpsertEpisodeParams{
+		ID:              uuid.New(),
+		PostID:          postID,
+		DurationSeconds: parseITunesDuration(item.ITunesDuration),
+		Episode:         parseITunesNumber(item.ITunesEpisode),
+		Season:          parseITunesNumber(item.ITunesSeason),
+		ImageUrl:        strings.TrimSpace(item.ITunesImage.Href),
+		Explicit:        parseITunesExplicit(item.ITunesExplicit),
+	})
+	if err != nil {
+		return fmt.Errorf("could not store episode: %w", err)
+	}
 	return nil
+}
 
+func parseITunesDuration(duration string) sql.NullInt32 {
+	//func that parses an itunes:duration, which is either seconds or HH:MM:SS / MM:SS
+	duration = strings.TrimSpace(duration)
+	if duration == "" {
+		return sql.NullInt32{}
+	}
+	seconds := int64(0)
+	for _, part := range strings.Split(duration, ":") {
+		n, err := strconv.ParseInt(strings.TrimSpace(part), 10, 32)
+		if err != nil || n < 0 {
+			return sql.NullInt32{}
+		}
+		seconds = seconds*60 + n
+		if seconds > math.MaxInt32 {
+			return sql.NullInt32{}
+		}
+	}
+	return sql.NullInt32{Int32: int32(seconds), Valid: true}
+}
+
+func parseITunesNumber(number string) sql.NullInt32 {
+	n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 32)
+	if err != nil || n < 0 {
+		return sql.NullInt32{}
+	}
+	return sql.NullInt32{Int32: int32(n), Valid: true}
+}
+
+func parseITunesExplicit(explicit string) sql.NullBool {
+	//func that parses itunes:explicit, which feeds give as true/false, yes/no or explicit/clean
+	switch strings.ToLower(strings.TrimSpace(explicit)) {
+	case "true", "yes", "explicit":
+		return sql.NullBool{Bool: true, Valid: true}
+	case "false", "no", "clean":
+		return sql.NullBool{Bool: false, Valid: true}
+	}
+	return sql.NullBool{}
+}
+
+func parsePubDate(pubDate string) (time.Time, error) {
+	//func that parses an item's publish date, allowing for the formats feeds commonly use
+	pubDate = strings.TrimSpace(pubDate)
+	layouts := []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"}
+	for _, layout := range layouts {
+		publishedAt, err := time.Parse(layout, pubDate)
+		if err == nil {
+			return publishedAt, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("could not parse time: %s", pubDate)
 }
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	//shortest text an extracted article can have, in characters, before it counts as a failed extraction
+	minArticleLength = 140
+)
+
+var errNoArticle = errors.New("could not find the article in the page")
+
+var (
+	//class and id names that mark parts of a page that are unlikely to be the article, unless they
+	//also look like it, and names that make an element more or less likely to hold the article
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|gdpr|header|legends|menu|modal|nav|newsletter|pager|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|toolbar|widget`)
+	maybeCandidates    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveNames      = regexp.MustCompile(`(?i)article|blog|body|content|entry|h-entry|hentry|main|page|post|story|text`)
+	negativeNames      = regexp.MustCompile(`(?i)banner|byline|combx|comment|com-|contact|foot|footnote|hidden|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+	//a sentence ending, used to keep short paragraphs next to the article
+	sentenceEnd = regexp.MustCompile(`\.( |$)`)
+)
+
+var strippedElements = map[string]bool{
+	//elements that are never part of an article, removed before the page is scored
+	"aside": true, "button": true, "embed": true, "footer": true, "form": true, "header": true, "iframe": true,
+	"input": true, "link": true, "meta": true, "nav": true, "noscript": true, "object": true, "script": true,
+	"select": true, "style": true, "svg": true, "template": true, "textarea": true,
+}
+
+type article struct {
+	//the main content of a page as sanitized html, and the canonical url the page gave for itself, if any
+	content      string
+	canonicalURL string
+}
+
+func fetchArticle(ctx context.Context, s *state, pageURL string) (article, error) {
+	//func that downloads the page a post links to and extracts its article
+	fetcher := s.fetcher.Load()
+	requestURL := pageURL
+	var response *http.Response
+	var release func()
+	for redirects := 0; ; redirects++ {
+		if redirects > maxRedirects {
+			return article{}, fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		var err error
+		response, release, err = fetcher.get(ctx, requestURL)
+		if err != nil {
+			return article{}, err
+		}
+		location := response.Header.Get("Location")
+		if response.StatusCode < 300 || response.StatusCode > 399 || location == "" {
+			break
+		}
+		response.Body.Close()
+		release()
+		nextURL, err := response.Request.URL.Parse(location)
+		if err != nil {
+			return article{}, fmt.Errorf("could not parse redirect location: %w", err)
+		}
+		requestURL = nextURL.String()
+	}
+	defer release()
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return article{}, &fetchStatusError{URL: requestURL, StatusCode: response.StatusCode, Status: response.Status}
+	}
+	contentType := response.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return article{}, fmt.Errorf("%s is not a web page: %s", requestURL, mediaType)
+	}
+
+	body, err := readBody(response, fetcher.maxBodyBytes)
+	if err != nil {
+		return article{}, err
+	}
+	reader, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return article{}, fmt.Errorf("could not decode page: %w", err)
+	}
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return article{}, fmt.Errorf("could not parse page: %w", err)
+	}
+	return extractArticle(doc, response.Request.URL)
+}
+
+func extractArticle(doc *html.Node, base *url.URL) (article, error) {
+	//func that finds the main content of a page, the way readability does
+	//paragraphs are scored on their length and commas, the scores add up in the elements that hold them,
+	//and the best scoring element is kept along with the siblings that score nearly as well
+	//the page's canonical url is returned even when no article is found
+	result := article{canonicalURL: pageCanonicalURL(doc, base)}
+
+	body := findElement(doc, "body")
+	if body == nil {
+		return result, errNoArticle
+	}
+	stripUnlikely(body)
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+	walkElements(body, func(n *html.Node) {
+		if !isParagraph(n) {
+			return
+		}
+		text := nodeText(n)
+		length := len([]rune(text))
+		if length < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(length)/100, 3)
+		addScore(n.Parent, score)
+		if n.Parent != nil {
+			addScore(n.Parent.Parent, score/2)
+		}
+	})
+
+	top := body
+	best := 0.0
+	for _, candidate := range candidates {
+		scores[candidate] *= 1 - linkDensity(candidate)
+		if scores[candidate] > best {
+			top, best = candidate, scores[candidate]
+		}
+	}
+
+	//siblings of the best element that score well or read like paragraphs are part of the article too
+	keep := []*html.Node{top}
+	if top != body && top.Parent != nil {
+		keep = nil
+		threshold := math.Max(10, best*0.2)
+		for sibling := top.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+			if sibling.Type != html.ElementNode {
+				continue
+			}
+			if sibling == top {
+				keep = append(keep, sibling)
+				continue
+			}
+			bonus := 0.0
+			if class := nodeAttr(sibling, "class"); class != "" && class == nodeAttr(top, "class") {
+				bonus = best * 0.2
+			}
+			if score, ok := scores[sibling]; ok && score+bonus >= threshold {
+				keep = append(keep, sibling)
+				continue
+			}
+			if sibling.Data == "p" {
+				text := nodeText(sibling)
+				length := len([]rune(text))
+				density := linkDensity(sibling)
+				if (length > 80 && density < 0.25) || (length > 0 && density == 0 && sentenceEnd.MatchString(text)) {
+					keep = append(keep, sibling)
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, n := range keep {
+		resolveURLs(n, base)
+		if err := html.Render(&b, n); err != nil {
+			return article{}, fmt.Errorf("could not render article: %w", err)
+		}
+	}
+	content := sanitizeHTML(b.String())
+	if len([]rune(htmlText(content))) < minArticleLength {
+		return result, errNoArticle
+	}
+	result.content = content
+	return result, nil
+}
+
+func pageCanonicalURL(doc *html.Node, base *url.URL) string {
+	//func that returns the url a page gives in <link rel="canonical">, made absolute
+	canonical := ""
+	walkElements(doc, func(n *html.Node) {
+		if canonical != "" || n.Data != "link" || !slices.Contains(strings.Fields(strings.ToLower(nodeAttr(n, "rel"))), "canonical") {
+			return
+		}
+		if href, err := base.Parse(strings.TrimSpace(nodeAttr(n, "href"))); err == nil && (href.Scheme == "http" || href.Scheme == "https") {
+			canonical = href.String()
+		}
+	})
+	return canonical
+}
+
+func stripUnlikely(root *html.Node) {
+	//func that removes the parts of a page that can't be the article: scripts, navigation, hidden elements,
+	//and elements whose class or id says they are comments, sidebars, share buttons and the like
+	var remove []*html.Node
+	walkElements(root, func(n *html.Node) {
+		if n == root {
+			return
+		}
+		if strippedElements[n.Data] || isHidden(n) {
+			remove = append(remove, n)
+			return
+		}
+		if n.Data == "article" || n.Data == "main" || n.Data == "body" || n.Data == "a" {
+			return
+		}
+		names := nodeAttr(n, "class") + " " + nodeAttr(n, "id")
+		if unlikelyCandidates.MatchString(names) && !maybeCandidates.MatchString(names) {
+			remove = append(remove, n)
+		}
+	})
+	for _, n := range remove {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+}
+
+func isHidden(n *html.Node) bool {
+	//func that reports whether an element is hidden from readers
+	style := strings.ReplaceAll(strings.ToLower(nodeAttr(n, "style")), " ", "")
+	return nodeHasAttr(n, "hidden") || nodeAttr(n, "aria-hidden") == "true" ||
+		strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+func isParagraph(n *html.Node) bool {
+	//func that reports whether an element is scored as a paragraph
+	//a div counts as one when it holds only text and inline elements
+	switch n.Data {
+	case "p", "pre", "td", "blockquote":
+		return true
+	case "div":
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == html.ElementNode && (blockElements[child.Data] || child.Data == "div") {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func initialScore(n *html.Node) float64 {
+	//func that returns the score an element starts with, from its tag and its class and id names
+	score := 0.0
+	switch n.Data {
+	case "article":
+		score = 10
+	case "div":
+		score = 5
+	case "pre", "td", "blockquote":
+		score = 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score = -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score = -5
+	}
+	for _, name := range []string{nodeAttr(n, "class"), nodeAttr(n, "id")} {
+		if name == "" {
+			continue
+		}
+		if negativeNames.MatchString(name) {
+			score -= 25
+		}
+		if positiveNames.MatchString(name) {
+			score += 25
+		}
+	}
+	return score
+}
+
+func linkDensity(n *html.Node) float64 {
+	//func that returns how much of an element's text is link text, from 0 to 1
+	length := len([]rune(nodeText(n)))
+	if length == 0 {
+		return 0
+	}
+	linkLength := 0
+	walkElements(n, func(link *html.Node) {
+		if link.Data == "a" {
+			linkLength += len([]rune(nodeText(link)))
+		}
+	})
+	return math.Min(float64(linkLength)/float64(length), 1)
+}
+
+func resolveURLs(root *html.Node, base *url.URL) {
+	//func that makes the links and image sources in an element absolute, so they still work away from the page
+	//lazy loaded images keep their real source in data-src
+	walkElements(root, func(n *html.Node) {
+		if n.Data == "img" && nodeAttr(n, "src") == "" {
+			if lazy := nodeAttr(n, "data-src"); lazy != "" {
+				n.Attr = append(n.Attr, html.Attribute{Key: "src", Val: lazy})
+			}
+		}
+		for i, a := range n.Attr {
+			if a.Namespace != "" || (a.Key != "href" && a.Key != "src") || strings.HasPrefix(strings.TrimSpace(a.Val), "#") {
+				continue
+			}
+			if resolved, err := base.Parse(strings.TrimSpace(a.Val)); err == nil {
+				n.Attr[i].Val = resolved.String()
+			}
+		}
+	})
+}
+
+func walkElements(n *html.Node, visit func(*html.Node)) {
+	//func that calls visit on n and every element under it, in document order
+	if n.Type == html.ElementNode {
+		visit(n)
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walkElements(child, visit)
+	}
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	//func that returns the first element with the given tag under n
+	var found *html.Node
+	walkElements(n, func(e *html.Node) {
+		if found == nil && e.Data == tag {
+			found = e
+		}
+	})
+	return found
+}
+
+func nodeText(n *html.Node) string {
+	//func that returns the text of a node with its whitespace collapsed
+	var b strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func htmlText(s string) string {
+	//func that returns the text of an html fragment with its whitespace collapsed
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return ""
+	}
+	return nodeText(doc)
+}
+
+func nodeAttr(n *html.Node, key string) string {
+	//func that returns the value of an element's attribute, or "" if it does not have it
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func nodeHasAttr(n *html.Node, key string) bool {
+	//func that reports whether an element has an attribute, whatever its value
+	return slices.ContainsFunc(n.Attr, func(a html.Attribute) bool { return a.Namespace == "" && a.Key == key })
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/gator/internal/database"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+const (
+	//how long a session lasts since it was last used
+	sessionLifetime = 30 * 24 * time.Hour
+	//bcrypt only looks at the first 72 bytes of a password, so longer ones are refused
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+var (
+	//stdin is shared between password prompts, so piped passwords can be read one line at a time
+	stdinReader = bufio.NewReader(os.Stdin)
+)
+
+func readPassword(prompt string) (string, error) {
+	//func that reads a password, without echoing it when stdin is a terminal
+	//otherwise it reads a line, so scripts can pipe passwords in
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, prompt)
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("could not read password: %w", err)
+		}
+		return string(password), nil
+	}
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", fmt.Errorf("could not read password from stdin: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func readNewPassword(cmd command, prompt string) (string, error) {
+	//func that reads a new password, asking for it twice when stdin is a terminal
+	password, err := readPassword(prompt)
+	if err != nil {
+		return "", err
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return "", &usageError{command: cmd.def, msg: fmt.Sprintf("%s: the password must be %d to %d bytes long", cmd.name, minPasswordLength, maxPasswordLength)}
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		again, err := readPassword("repeat password: ")
+		if err != nil {
+			return "", err
+		}
+		if again != password {
+			return "", &usageError{command: cmd.def, msg: cmd.name + ": the passwords do not match"}
+		}
+	}
+	return password, nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("could not hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func hashSessionToken(token string) string {
+	//func that returns how a session token is stored in the database
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func startSession(s *state, user database.User) error {
+	//func that starts a session for user and makes it the current one in the config
+	//the session it replaces, and any that have expired, are deleted
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("could not make session token: %w", err)
+	}
+	token := hex.EncodeToString(key)
+	err := s.db.CreateSession(context.Background(), database.CreateSessionParams{ID: uuid.New(),
+		UserID:          user.ID,
+		TokenHash:       hashSessionToken(token),
+		LifetimeSeconds: int32(sessionLifetime / time.Second),
+	})
+	if err != nil {
+		return dbError(err, "could not create session")
+	}
+	if s.config.SessionToken != "" {
+		if err := s.db.DeleteSession(context.Background(), hashSessionToken(s.config.SessionToken)); err != nil {
+			return dbError(err, "could not end previous session")
+		}
+	}
+	if err := s.db.DeleteExpiredSessions(context.Background()); err != nil {
+		return dbError(err, "could not delete expired sessions")
+	}
+
+	err = s.config.SetSession(token)
+	if err != nil {
+		return fmt.Errorf("could not save session: %w", err)
+	}
+	s.config.SessionToken = token
+	return nil
+}
+
+func handlerLogin(s *state, cmd command) error {
+	//func that handles the login command
+	//a user made before gator had passwords is locked until an admin sets one with "gator passwd <username>",
+	//except for an admin without one, who chooses it here since nobody else could
+	user, err := s.db.GetUser(context.Background(), cmd.args[0])
+	if err != nil {
+		return dbError(err, "user %s", cmd.args[0])
+	}
+	if user.PasswordHash == "" {
+		if !user.IsAdmin {
+			return authError("user %s has no password yet, ask an admin to set one with \"gator passwd %s\"", user.Name, user.Name)
+		}
+		fmt.Fprintf(os.Stderr, "admin %s has no password yet, choose one now\n", user.Name)
+		password, err := readNewPassword(cmd, "new password: ")
+		if err != nil {
+			return err
+		}
+		hash, err := hashPassword(password)
+		if err != nil {
+			return err
+		}
+		//only set if it is still empty, so two first logins can't both choose one
+		set, err := s.db.SetFirstPassword(context.Background(), database.SetFirstPasswordParams{ID: user.ID, PasswordHash: hash})
+		if err != nil {
+			return dbError(err, "could not set password for %s", user.Name)
+		}
+		if set == 0 {
+			return authError("the password of %s was just set by someone else, log in with it", user.Name)
+		}
+		return finishLogin(s, user)
+	}
+
+	password, err := readPassword("password: ")
+	if err != nil {
+		return err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err != nil {
+		return authError("wrong password for %s", user.Name)
+	}
+
+	return finishLogin(s, user)
+}
+
+func finishLogin(s *state, user database.User) error {
+	err := startSession(s, user)
+	if err != nil {
+		return err
+	}
+	fmt.Println("logged in as:", user.Name)
+	return nil
+}
+
+func handlerLogout(s *state, cmd command) error {
+	//func that ends the current session
+	if s.config.SessionToken == "" {
+		fmt.Println("not logged in")
+		return nil
+	}
+	err := s.db.DeleteSession(context.Background(), hashSessionToken(s.config.SessionToken))
+	if err != nil {
+		return dbError(err, "could not end session")
+	}
+	err = s.config.SetSession("")
+	if err != nil {
+		return fmt.Errorf("could not clear session: %w", err)
+	}
+	fmt.Println("logged out")
+	return nil
+}
+
+func handlerPasswd(s *state, cmd command, user database.User) error {
+	//func that changes the password of the current user
+	//the current password is asked for first, and every other session of the user is ended
+	if len(cmd.args) > 0 && cmd.args[0] != user.Name {
+		return setUserPassword(s, cmd, user, cmd.args[0])
+	}
+	password, err := readPassword("current password: ")
+	if err != nil {
+		return err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err != nil {
+		return authError("wrong password for %s", user.Name)
+	}
+	newPassword, err := readNewPassword(cmd, "new password: ")
+	if err != nil {
+		return err
+	}
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.SetUserPassword(context.Background(), database.SetUserPasswordParams{ID: user.ID, PasswordHash: hash})
+	if err != nil {
+		return dbError(err, "could not set password for %s", user.Name)
+	}
+	err = s.db.DeleteOtherSessions(context.Background(), database.DeleteOtherSessionsParams{UserID: user.ID, TokenHash: hashSessionToken(s.config.SessionToken)})
+	if err != nil {
+		return dbError(err, "could not end other sessions")
+	}
+	fmt.Println("password changed, other sessions were logged out")
+	return nil
+}
+
+func setUserPassword(s *state, cmd command, admin database.User, name string) error {
+	//func that lets an admin set another user's password, without knowing the old one
+	//every session of that user is ended, so whoever had the account has to log in with the new password
+	if !admin.IsAdmin {
+		return authError("only an admin can set the password of another user")
+	}
+	user, err := s.db.GetUser(context.Background(), name)
+	if err != nil {
+		return dbError(err, "user %s", name)
+	}
+	password, err := readNewPassword(cmd, fmt.Sprintf("new password for %s: ", user.Name))
+	if err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.SetUserPassword(context.Background(), database.SetUserPasswordParams{ID: user.ID, PasswordHash: hash})
+	if err != nil {
+		return dbError(err, "could not set password for %s", user.Name)
+	}
+	err = s.db.DeleteUserSessions(context.Background(), user.ID)
+	if err != nil {
+		return dbError(err, "could not end sessions of %s", user.Name)
+	}
+	fmt.Printf("password of %s set, their sessions were logged out\n", user.Name)
+	return nil
+}
+
+func getCurrentUser(s *state) (database.User, error) {
+	//func that gets the user of the session in the config, keeping the session alive
+	if s.config.SessionToken == "" {
+		return database.User{}, authError("no user is logged in, run \"gator login <username>\" first")
+	}
+	user, err := s.db.GetSessionUser(context.Background(), database.GetSessionUserParams{TokenHash: hashSessionToken(s.config.SessionToken),
+		LifetimeSeconds: int32(sessionLifetime / time.Second),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, authError("your session has expired or was logged out, run \"gator login <username>\" again")
+	}
+	if err != nil {
+		return database.User{}, dbError(err, "could not get current user")
+	}
+	return user, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"internal/config"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+func TestHashPassword(t *testing.T) {
+	for _, password := range []string{"correct horse", strings.Repeat("x", maxPasswordLength)} {
+		hash, err := hashPassword(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			t.Errorf("hash of %q does not match it: %v", password, err)
+		}
+		//the last byte is changed rather than one added, since bcrypt ignores bytes past the 72nd
+		wrong := password[:len(password)-1] + "!"
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(wrong)); err == nil {
+			t.Errorf("hash of %q matches another password", password)
+		}
+		//hashes are salted, so the same password hashes differently each time
+		again, err := hashPassword(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again == hash {
+			t.Errorf("hashing %q twice gave the same hash", password)
+		}
+	}
+}
+
+func TestReadNewPassword(t *testing.T) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		t.Skip("stdin is a terminal, so passwords would be read from it")
+	}
+	saved := stdinReader
+	t.Cleanup(func() { stdinReader = saved })
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"7 bytes is too short", "1234567\n", "", true},
+		{"8 bytes", "12345678\n", "12345678", false},
+		{"72 bytes", strings.Repeat("a", 72) + "\n", strings.Repeat("a", 72), false},
+		{"73 bytes is too long", strings.Repeat("a", 73) + "\n", "", true},
+		{"length is in bytes, not characters", strings.Repeat("é", 36) + "\n", strings.Repeat("é", 36), false},
+		{"multibyte password over 72 bytes", strings.Repeat("é", 37) + "\n", "", true},
+		{"windows line ending", "password\r\n", "password", false},
+		{"no trailing newline", "password", "password", false},
+		{"empty", "", "", true},
+	}
+	cmd := command{name: "register"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdinReader = bufio.NewReader(strings.NewReader(tt.input))
+			got, err := readNewPassword(cmd, "password: ")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("readNewPassword = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("readNewPassword = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadNewPasswordLengthIsUsageError(t *testing.T) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		t.Skip("stdin is a terminal, so passwords would be read from it")
+	}
+	saved := stdinReader
+	t.Cleanup(func() { stdinReader = saved })
+
+	stdinReader = bufio.NewReader(strings.NewReader("short\n"))
+	_, err := readNewPassword(command{name: "register"}, "password: ")
+	var usage *usageError
+	if !errors.As(err, &usage) {
+		t.Fatalf("err = %v, want a usage error", err)
+	}
+	if !strings.Contains(usage.msg, "8 to 72 bytes") {
+		t.Errorf("msg = %q, want it to give the allowed lengths", usage.msg)
+	}
+}
+
+func TestHashSessionToken(t *testing.T) {
+	//sessions are looked up by the sha-256 of the token in the config, so the hash has to be stable
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+	for _, tt := range tests {
+		if got := hashSessionToken(tt.token); got != tt.want {
+			t.Errorf("hashSessionToken(%q) = %s, want %s", tt.token, got, tt.want)
+		}
+	}
+	if hashSessionToken("abc") != hashSessionToken("abc") {
+		t.Error("hashSessionToken is not deterministic")
+	}
+	if hashSessionToken("abc") == hashSessionToken("abd") {
+		t.Error("different tokens hash the same")
+	}
+}
+
+func TestGetCurrentUserWithoutSession(t *testing.T) {
+	//with no token in the config, there is nothing to look up and the database isn't touched
+	s := &state{config: &config.Config{}}
+	_, err := getCurrentUser(s)
+	if err == nil {
+		t.Fatal("getCurrentUser succeeded without a session")
+	}
+	if code := exitCode(err); code != exitAuth {
+		t.Errorf("exit code = %d, want %d", code, exitAuth)
+	}
+}
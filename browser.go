@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+func browserCommand(url string) (cmd *exec.Cmd, fromEnv bool) {
+	//func that returns the command that opens a url in the user's browser
+	//$BROWSER wins if it is set, and may hold a "%s" where the url goes; otherwise the platform's opener is used
+	if browser := strings.TrimSpace(strings.Split(os.Getenv("BROWSER"), ":")[0]); browser != "" {
+		fields := strings.Fields(browser)
+		hasURL := false
+		for i, field := range fields {
+			if strings.Contains(field, "%s") {
+				fields[i] = strings.ReplaceAll(field, "%s", url)
+				hasURL = true
+			}
+		}
+		if !hasURL {
+			fields = append(fields, url)
+		}
+		return exec.Command(fields[0], fields[1:]...), true
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url), false
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url), false
+	default:
+		return exec.Command("xdg-open", url), false
+	}
+}
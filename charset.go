@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// matches the encoding attribute of an xml declaration such as <?xml version="1.0" encoding="Shift_JIS"?>
+var xmlEncodingPattern = regexp.MustCompile(`^\s*<\?xml[^>]*?\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+func unmarshalFeedXML(body []byte, contentType string, v any) error {
+	//func that transcodes a feed body to utf-8 and then unmarshals it
+	//the charset from the Content-Type header wins over the xml declaration, as in RFC 7303
+	body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+
+	label := contentTypeCharset(contentType)
+	if label == "" {
+		label = xmlDeclarationEncoding(body)
+	}
+
+	reader := io.Reader(bytes.NewReader(body))
+	if label != "" {
+		encoding, name := charset.Lookup(label)
+		if encoding == nil {
+			return fmt.Errorf("unsupported character set: %s", label)
+		}
+		if name != "utf-8" {
+			reader = encoding.NewDecoder().Reader(reader)
+		}
+	}
+
+	decoder := xml.NewDecoder(reader)
+	//the body has already been transcoded, so the encoding in the xml declaration is ignored
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder.Decode(v)
+}
+
+func contentTypeCharset(contentType string) string {
+	//func that returns the charset parameter of a Content-Type header, if any
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(params["charset"])
+}
+
+func xmlDeclarationEncoding(body []byte) string {
+	//func that returns the encoding named in the xml declaration, if any
+	if len(body) > 1024 {
+		body = body[:1024]
+	}
+	match := xmlEncodingPattern.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return string(match[1])
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestUnmarshalFeedXML(t *testing.T) {
+	feedXML := func(declaration, title string) []byte {
+		return []byte(declaration + "<rss><channel><title>" + title + "</title></channel></rss>")
+	}
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		want        string
+		wantErr     bool
+	}{
+		{name: "utf-8 without a charset", body: feedXML(`<?xml version="1.0"?>`, "café"), want: "café"},
+		{name: "utf-8 with a byte order mark", body: feedXML("\xef\xbb\xbf"+`<?xml version="1.0" encoding="UTF-8"?>`, "café"), want: "café"},
+		{name: "iso-8859-1 from the declaration", body: feedXML(`<?xml version="1.0" encoding="ISO-8859-1"?>`, "caf\xe9"), want: "café"},
+		{name: "windows-1252 from the declaration", body: feedXML(`<?xml version='1.0' encoding='windows-1252'?>`, "\x93quoted\x94"), want: "“quoted”"},
+		{name: "shift_jis from the declaration", body: feedXML(`<?xml version="1.0" encoding="Shift_JIS"?>`, "\x93\xfa\x96\x7b"), want: "日本"},
+		{name: "koi8-r from the header", body: feedXML(`<?xml version="1.0"?>`, "\xf0\xd2\xc9\xd7\xc5\xd4"), contentType: "application/rss+xml; charset=KOI8-R", want: "Привет"},
+		{
+			name:        "the header wins over the declaration",
+			body:        feedXML(`<?xml version="1.0" encoding="ISO-8859-1"?>`, "café"),
+			contentType: "text/xml; charset=utf-8",
+			want:        "café",
+		},
+		{
+			name:        "the header wins the other way too",
+			body:        feedXML(`<?xml version="1.0" encoding="UTF-8"?>`, "caf\xe9"),
+			contentType: `application/xml; charset="iso-8859-1"`,
+			want:        "café",
+		},
+		{
+			name:        "a header without a charset falls back to the declaration",
+			body:        feedXML(`<?xml version="1.0" encoding="ISO-8859-1"?>`, "caf\xe9"),
+			contentType: "application/rss+xml",
+			want:        "café",
+		},
+		{name: "unknown charset", body: feedXML(`<?xml version="1.0" encoding="x-klingon"?>`, "qapla"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var feed RSSFeed
+			err := unmarshalFeedXML(tt.body, tt.contentType, &feed)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want an error, got title %q", feed.Channel.Title)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if feed.Channel.Title != tt.want {
+				t.Errorf("title = %q, want %q", feed.Channel.Title, tt.want)
+			}
+		})
+	}
+}
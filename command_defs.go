@@ -0,0 +1,461 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/joncaudill/gator/internal/database"
+)
+
+type commandDef struct {
+	//struct that describes a command: what it does, the flags and args it takes and how to run it
+	name        string
+	summary     string
+	description string
+	args        []argDef
+	flags       []flagDef
+	//exactly one of handler and loggedInHandler is set, loggedInHandler for commands that need a login
+	handler         func(*state, command) error
+	loggedInHandler func(*state, command, database.User) error
+	//hidden commands are left out of help, and rawArgs commands get their args without any flag parsing
+	hidden  bool
+	rawArgs bool
+	//listing commands take --output (or -o) to print machine-readable records
+	output bool
+}
+
+type argDef struct {
+	//a positional argument, which may be left off when optional is set
+	name     string
+	help     string
+	optional bool
+	//returns the values offered by shell completion for this argument, if set
+	complete func(*state) ([]string, error)
+}
+
+type flagDef struct {
+	//a flag, which is a boolean switch when isBool is set and takes a value otherwise
+	name   string
+	help   string
+	value  string
+	isBool bool
+}
+
+type usageError struct {
+	//error returned when a command is called with the wrong flags or args
+	command commandDef
+	msg     string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func (c command) flag(name string) string {
+	//func that returns the value of a string flag, or its default if it was not given
+	return c.flags[name]
+}
+
+func (c command) flagBool(name string) bool {
+	//func that reports whether a boolean flag was set
+	return c.flags[name] == "true"
+}
+
+func (d commandDef) needsLogin() bool {
+	return d.loggedInHandler != nil
+}
+
+func (d commandDef) parse(args []string) (command, error) {
+	//func that splits args into flags and positional args, checking them against the definition
+	//flags may come before, after or between positional args
+	fs := flag.NewFlagSet(d.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	values := make(map[string]flag.Value)
+	for _, f := range d.flags {
+		if f.isBool {
+			fs.Bool(f.name, f.value == "true", f.help)
+		} else {
+			fs.String(f.name, f.value, f.help)
+		}
+		values[f.name] = fs.Lookup(f.name).Value
+	}
+	var format *string
+	if d.output {
+		format = fs.String("output", outputText, "")
+		fs.StringVar(format, "o", outputText, "")
+	}
+
+	var positional []string
+	rest := args
+	for {
+		err := fs.Parse(rest)
+		if err == flag.ErrHelp {
+			return command{}, err
+		}
+		if err != nil {
+			return command{}, &usageError{command: d, msg: err.Error()}
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+
+	var required []string
+	for _, a := range d.args {
+		if !a.optional {
+			required = append(required, a.name)
+		}
+	}
+	if len(positional) < len(required) {
+		return command{}, &usageError{command: d, msg: fmt.Sprintf("%s: missing %s", d.name, strings.Join(required, " and "))}
+	}
+	if len(positional) > len(d.args) {
+		return command{}, &usageError{command: d, msg: fmt.Sprintf("%s: too many arguments", d.name)}
+	}
+
+	flags := make(map[string]string, len(values))
+	for name, value := range values {
+		flags[name] = value.String()
+	}
+	if format != nil {
+		output, err := parseOutputFormat(*format)
+		if err != nil {
+			return command{}, &usageError{command: d, msg: err.Error()}
+		}
+		flags["output"] = output
+	}
+	return command{name: d.name, args: positional, flags: flags, def: d}, nil
+}
+
+func (d commandDef) usage() string {
+	//func that returns the one line usage of a command, e.g. "addfeed [name] <url>"
+	parts := []string{d.name}
+	if len(d.flags) > 0 {
+		parts = append(parts, "[flags]")
+	}
+	for _, a := range d.args {
+		if a.optional {
+			parts = append(parts, "["+a.name+"]")
+		} else {
+			parts = append(parts, "<"+a.name+">")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (d commandDef) help() string {
+	//func that returns the full help text of a command
+	var b strings.Builder
+	fmt.Fprintf(&b, "usage: gator %s\n\n", d.usage())
+	description := d.description
+	if description == "" {
+		description = d.summary
+	}
+	fmt.Fprintf(&b, "%s\n", description)
+	if d.needsLogin() {
+		b.WriteString("\nthis command needs a logged in user (see \"gator login\").\n")
+	}
+	if len(d.args) > 0 {
+		b.WriteString("\narguments:\n")
+		for _, a := range d.args {
+			fmt.Fprintf(&b, "  %-14s %s\n", a.name, a.help)
+		}
+	}
+	b.WriteString("\nflags:\n")
+	for _, f := range d.flags {
+		name := "--" + f.name
+		if !f.isBool {
+			name += " <value>"
+		}
+		help := f.help
+		if !f.isBool && f.value != "" {
+			help += fmt.Sprintf(" (default %s)", f.value)
+		}
+		fmt.Fprintf(&b, "  %-22s %s\n", name, help)
+	}
+	if d.output {
+		fmt.Fprintf(&b, "  %-22s %s\n", "--output <format>", "print as text, json, csv, tsv or yaml (default text)")
+	}
+	fmt.Fprintf(&b, "  %-22s %s\n", "--help", "show this help")
+	return b.String()
+}
+
+func (c *commands) help() string {
+	//func that returns the list of all commands for "gator help"
+	var b strings.Builder
+	b.WriteString("gator is an rss aggregator.\n\nusage: gator <command> [flags] [args]\n\ncommands:\n")
+	for _, name := range c.order {
+		if c.names[name].hidden {
+			continue
+		}
+		fmt.Fprintf(&b, "  %-12s %s\n", name, c.names[name].summary)
+	}
+	b.WriteString("\nrun \"gator help <command>\" or \"gator <command> --help\" for more about a command.\n")
+	return b.String()
+}
+
+func handlerHelp(c *commands) func(*state, command) error {
+	//func that returns the handler for the help command, which needs the list of commands
+	return func(s *state, cmd command) error {
+		if len(cmd.args) == 0 {
+			fmt.Print(c.help())
+			return nil
+		}
+		def, ok := c.names[cmd.args[0]]
+		if !ok {
+			return &usageError{msg: fmt.Sprintf("command not found: %s (run \"gator help\" for a list of commands)", cmd.args[0])}
+		}
+		fmt.Print(def.help())
+		return nil
+	}
+}
+
+func registerCommands(c *commands) {
+	//registers every command gator knows about, in the order help lists them
+	c.register(commandDef{name: "help",
+		summary: "show the list of commands, or help for one command",
+		args:    []argDef{{name: "command", help: "the command to show help for", optional: true, complete: completeCommands(c)}},
+		handler: handlerHelp(c),
+	})
+	c.register(commandDef{name: "register",
+		summary: "create a profile and log in to it",
+		description: "create a profile, asking for its password, and log in to it.\n" +
+			"when stdin is not a terminal the password is read from its first line.",
+		args:    []argDef{{name: "username", help: "the name of the new profile"}},
+		handler: handlerRegister,
+	})
+	c.register(commandDef{name: "login",
+		summary: "log in to a profile with its password",
+		description: "log in to a profile, asking for its password, and save the session in the config file.\n" +
+			"a profile made before gator had passwords can't log in until an admin sets one with \"gator passwd <username>\",\n" +
+			"except for an admin, who chooses one the first time they log in.\n" +
+			"sessions end after 30 days without use.",
+		args:    []argDef{{name: "username", help: "the name of the profile", complete: completeUserNames}},
+		handler: handlerLogin,
+	})
+	c.register(commandDef{name: "logout",
+		summary: "end the current session",
+		handler: handlerLogout,
+	})
+	c.register(commandDef{name: "passwd",
+		summary: "change the password of the current user, or as an admin of another user",
+		description: "change the password of the current user, asking for the current one first.\n" +
+			"every other session of the user is logged out.\n" +
+			"an admin can give a username to set that user's password, e.g. for a profile made before gator had passwords,\n" +
+			"which logs out every session of that user.",
+		args:            []argDef{{name: "username", help: "the user to set the password of (admins only)", optional: true, complete: completeUserNames}},
+		loggedInHandler: handlerPasswd,
+	})
+	c.register(commandDef{name: "users",
+		summary:         "list all profiles",
+		loggedInHandler: handlerList,
+		output:          true,
+	})
+	c.register(commandDef{name: "reset",
+		summary:         "delete all data from gator (admins only)",
+		description:     "delete all users, feeds, follows and posts. this cannot be undone.",
+		loggedInHandler: handlerReset,
+	})
+	c.register(commandDef{name: "agg",
+		summary: "fetch feeds every interval, or every feed once with --once",
+		description: "fetch the least recently fetched feed every interval until stopped with ctrl-c.\n" +
+			"the interval is a number followed by a unit such as \"1h\" or \"30m\", and is at least 10m.",
+		args:    []argDef{{name: "interval", help: "time between fetches, e.g. 1h (not needed with --once)", optional: true}},
+		flags:   []flagDef{{name: "once", help: "fetch every feed once and exit, for running from cron", isBool: true}},
+		handler: handlerAgg,
+	})
+	c.register(commandDef{name: "addfeed",
+		summary: "add a feed and follow it",
+		description: "add a feed and follow it. the feed is fetched once to check that it is valid,\n" +
+			"and its title is used as the name if no name is given.",
+		args: []argDef{
+			{name: "name", help: "the name of the feed (default is the feed's title)", optional: true},
+			{name: "url", help: "the url of the feed"},
+		},
+		flags:           []flagDef{{name: "full-content", help: "fetch the full article of every new post (see fullcontent)", isBool: true}},
+		loggedInHandler: handlerAddFeed,
+	})
+	c.register(commandDef{name: "feeds",
+		summary:         "list all feeds",
+		loggedInHandler: handlerFeeds,
+		output:          true,
+	})
+	c.register(commandDef{name: "follow",
+		summary:         "follow a feed that has already been added",
+		args:            []argDef{{name: "url", help: "the url of the feed", complete: completeFeedURLs}},
+		loggedInHandler: handlerAddFollow,
+	})
+	c.register(commandDef{name: "following",
+		summary:         "list the feeds the current profile follows",
+		loggedInHandler: handlerFollowing,
+		output:          true,
+	})
+	c.register(commandDef{name: "unfollow",
+		summary:         "stop following a feed",
+		args:            []argDef{{name: "url", help: "the url of the feed", complete: completeFollowedFeedURLs}},
+		loggedInHandler: handlerDeleteFollow,
+	})
+	c.register(commandDef{name: "fullcontent",
+		summary: "turn fetching the full article of a feed's posts on or off",
+		description: "for feeds that only give a teaser, agg can fetch the page each new post links to and keep its\n" +
+			"main content, which show, the tui and posts --output then use. with no setting, show whether it is on.",
+		args: []argDef{
+			{name: "url", help: "the url of the feed", complete: completeFeedURLs},
+			{name: "setting", help: "on or off", optional: true, complete: completeOnOff},
+		},
+		loggedInHandler: handlerFullContent,
+	})
+	c.register(commandDef{name: "posts",
+		summary:         "show the most recent posts from followed feeds",
+		args:            []argDef{{name: "limit", help: "how many posts to show (default 2)", optional: true}},
+		flags:           []flagDef{{name: "muted", help: "include posts hidden by mute rules", isBool: true}},
+		loggedInHandler: handlerBrowse,
+		output:          true,
+	})
+	c.register(commandDef{name: "open",
+		summary:         "open a post in the browser and mark it read",
+		description:     "open a post in the browser ($BROWSER if set, otherwise the system's default) and mark it read.",
+		args:            []argDef{{name: "id", help: "the post's id, as shown by \"gator posts\""}},
+		loggedInHandler: handlerOpen,
+	})
+	c.register(commandDef{name: "show",
+		summary:         "show a post as readable text and mark it read",
+		description:     "show a post's title, link and description as readable text through $PAGER (less by default), and mark it read.",
+		args:            []argDef{{name: "id", help: "the post's id, as shown by \"gator posts\""}},
+		loggedInHandler: handlerShow,
+	})
+	c.register(commandDef{name: "download",
+		summary: "download podcast episodes",
+		description: "download the enclosure (e.g. the audio of a podcast episode) of a post, or with --feed the latest\n" +
+			"episode of a feed, or with --feed and --new every episode of the feed that has not been downloaded yet.\n" +
+			"files go to download_dir from the config file (default ~/Podcasts), in a folder per feed.\n" +
+			"a download that is cut off picks up where it left off the next time it is run.",
+		args: []argDef{{name: "id", help: "the post's id, as shown by \"gator posts\"", optional: true}},
+		flags: []flagDef{
+			{name: "feed", help: "the url of a feed to download episodes of"},
+			{name: "new", help: "with --feed, download every episode that has not been downloaded yet", isBool: true},
+		},
+		loggedInHandler: handlerDownload,
+	})
+	c.register(commandDef{name: "tui",
+		summary: "read posts from followed feeds in a full screen reader",
+		description: "read posts from followed feeds in a full screen reader. new posts fetched by agg show up as they come in.\n\n" +
+			"keys:\n" +
+			"  tab, h, l     switch between the feed and post lists\n" +
+			"  j, k, arrows  move up and down\n" +
+			"  enter         mark the post read\n" +
+			"  r             mark the post read or unread\n" +
+			"  s             star or unstar the post\n" +
+			"  o             open the post in the browser ($BROWSER if set) and mark it read\n" +
+			"  space, b      scroll the preview down and up\n" +
+			"  R             reload now\n" +
+			"  q             quit",
+		loggedInHandler: handlerTUI,
+	})
+	c.register(commandDef{name: "digest",
+		summary: "email a digest of unread posts, or set up daily or weekly digests",
+		description: "email the current profile a digest of its unread posts, grouped by feed, through the smtp server\n" +
+			"in the config file. posts that were in an earlier digest are left out of the next one.\n\n" +
+			"set the address and how often agg sends digests with --email and --every, e.g.\n" +
+			"  gator digest --email jo@example.com --every daily\n" +
+			"agg sends the digests that are due when agg_send_digests is set in the config file, or run\n" +
+			"\"gator digest --due\" from cron instead.",
+		flags: []flagDef{
+			{name: "email", help: "set the address digests are sent to (\"none\" to remove it)"},
+			{name: "every", help: "send digests daily, weekly or off"},
+			{name: "due", help: "send the digest of every profile whose digest is due (admins only)", isBool: true},
+			{name: "dry-run", help: "print the digest instead of sending it", isBool: true},
+		},
+		loggedInHandler: handlerDigest,
+	})
+	c.register(commandDef{name: "addrule",
+		summary: "add a rule to mute, highlight, mark read or star posts",
+		description: "add a rule for the current profile. the action is one of:\n" +
+			"  mute       hide matching posts from posts and the tui (see them with \"gator posts --muted\")\n" +
+			"  highlight  mark matching posts with ! in posts, and in color in the tui\n" +
+			"  read       mark new matching posts read as agg stores them\n" +
+			"  star       star new matching posts as agg stores them\n\n" +
+			"and the match is one of:\n" +
+			"  keyword    the pattern appears in the title or description, ignoring case\n" +
+			"  regex      the title or description matches the pattern as a postgres regex, ignoring case\n" +
+			"  author     the pattern appears in the author's name, ignoring case\n" +
+			"  category   the post has the pattern as a category, ignoring case\n" +
+			"  feed       every post of the feed whose url is the pattern\n\n" +
+			"e.g. gator addrule mute keyword sponsored --feed https://example.com/feed",
+		args: []argDef{
+			{name: "action", help: "mute, highlight, read or star", complete: completeRuleActions},
+			{name: "match", help: "keyword, regex, author, category or feed", complete: completeRuleFields},
+			{name: "pattern", help: "what to match, or the feed url for the feed match", optional: true},
+		},
+		flags:           []flagDef{{name: "feed", help: "only apply the rule to posts from this feed"}},
+		loggedInHandler: handlerAddRule,
+	})
+	c.register(commandDef{name: "rules",
+		summary:         "list the current profile's rules",
+		loggedInHandler: handlerRules,
+		output:          true,
+	})
+	c.register(commandDef{name: "deleterule",
+		summary:         "delete a rule",
+		args:            []argDef{{name: "id", help: "the rule's id, as shown by \"gator rules\""}},
+		loggedInHandler: handlerDeleteRule,
+	})
+	c.register(commandDef{name: "addwebhook",
+		summary: "send new posts from followed feeds to a webhook",
+		description: "send each new post agg stores from the current profile's feeds to a webhook. the kind is one of:\n" +
+			"  json     a json event with the post and its feed, posted to the url\n" +
+			"  slack    a slack incoming webhook url\n" +
+			"  discord  a discord webhook url\n" +
+			"  matrix   a matrix homeserver url, with --room and --token for the room to post in\n\n" +
+			"every delivery is signed: X-Gator-Signature is \"sha256=\" and the hex hmac-sha256, keyed with the secret,\n" +
+			"of the X-Gator-Timestamp header, a dot and the body. failed deliveries are retried for about 15 hours.",
+		args: []argDef{
+			{name: "kind", help: "json, slack, discord or matrix", complete: completeWebhookKinds},
+			{name: "url", help: "the url to send posts to"},
+		},
+		flags: []flagDef{
+			{name: "feed", help: "only send posts from this feed"},
+			{name: "rule", help: "only send posts that match this rule, as shown by \"gator rules\""},
+			{name: "secret", help: "the secret deliveries are signed with (default is a random one)"},
+			{name: "room", help: "the matrix room id, e.g. !abc123:example.org"},
+			{name: "token", help: "the matrix access token"},
+		},
+		loggedInHandler: handlerAddWebhook,
+	})
+	c.register(commandDef{name: "webhooks",
+		summary:         "list the current profile's webhooks",
+		loggedInHandler: handlerWebhooks,
+		output:          true,
+	})
+	c.register(commandDef{name: "deletewebhook",
+		summary:         "delete a webhook",
+		args:            []argDef{{name: "id", help: "the webhook's id, as shown by \"gator webhooks\""}},
+		loggedInHandler: handlerDeleteWebhook,
+	})
+	c.register(commandDef{name: "webhooklog",
+		summary:         "show the latest webhook deliveries and how they went",
+		args:            []argDef{{name: "id", help: "only show deliveries of this webhook", optional: true}},
+		flags:           []flagDef{{name: "limit", help: "how many deliveries to show (default 20)"}},
+		loggedInHandler: handlerWebhookLog,
+		output:          true,
+	})
+	c.register(commandDef{name: "completion",
+		summary: "print a shell completion script for bash, zsh or fish",
+		description: "print a shell completion script. to use it, add one of these to your shell's startup file:\n" +
+			"  bash: source <(gator completion bash)\n" +
+			"  zsh:  source <(gator completion zsh)\n" +
+			"  fish: gator completion fish | source",
+		args:    []argDef{{name: "shell", help: "bash, zsh or fish", complete: completeShells}},
+		handler: handlerCompletion,
+	})
+	c.register(commandDef{name: "__complete",
+		summary: "print completions for the words on a command line, used by the completion scripts",
+		hidden:  true,
+		rawArgs: true,
+		handler: handlerComplete(c),
+	})
+}
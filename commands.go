@@ -2,51 +2,43 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/joncaudill/gator/internal/database"
 )
 
-func handlerLogin(s *state, cmd command) error {
-	//func that handles the login command
-	if len(cmd.args) == 0 {
-		return fmt.Errorf("login command requires 1 argument")
-	}
-
-	_, err := s.db.GetUser(context.Background(), cmd.args[0])
+func handlerRegister(s *state, cmd command) error {
+	//func that handles the register command
+	//the new user chooses a password and is logged in
+	password, err := readNewPassword(cmd, "password: ")
 	if err != nil {
-		fmt.Printf("could not get user: %s", err)
-		os.Exit(1)
+		return err
 	}
-	err = s.config.SetUser(cmd.args[0])
+	hash, err := hashPassword(password)
 	if err != nil {
-		return fmt.Errorf("could not set user name: %w", err)
-	}
-	fmt.Println("user name set to:", cmd.args[0])
-	return nil
-}
-
-func handlerRegister(s *state, cmd command) error {
-	//func that handles the register command
-	if len(cmd.args) == 0 {
-		return fmt.Errorf("register command requires 1 argument")
+		return err
 	}
-
 	user, err := s.db.CreateUser(context.Background(),
 		database.CreateUserParams{ID: uuid.New(),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-			Name:      cmd.args[0]})
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+			Name:         cmd.args[0],
+			PasswordHash: hash})
 
 	if err != nil {
-		fmt.Printf("could not create user: %s", err)
-		os.Exit(1)
+		return dbError(err, "user %s", cmd.args[0])
+	}
+	err = startSession(s, user)
+	if err != nil {
+		return err
 	}
-	s.config.SetUser(user.Name)
 	fmt.Println("user was created.")
 	fmt.Printf("user id: %s\n", user.ID)
 	fmt.Printf("user name: %s\n", user.Name)
@@ -56,44 +48,65 @@ func handlerRegister(s *state, cmd command) error {
 	return nil
 }
 
-func handlerReset(s *state, cmd command) error {
+func handlerReset(s *state, cmd command, user database.User) error {
 	//func that resets the user table and feeds table
-	//this is a dangerous command and should not be used in production
+	//this is a dangerous command and should not be used in production, so only admins may run it
+	if !user.IsAdmin {
+		return authError("only an admin can reset gator")
+	}
 	err := s.db.ResetUsers(context.Background())
 	if err != nil {
-		fmt.Printf("could not reset users: %s", err)
-		os.Exit(1)
+		return dbError(err, "could not reset users")
 	}
 	fmt.Println("users table was reset")
 
 	err = s.db.ResetFeeds(context.Background())
 	if err != nil {
-		fmt.Printf("could not reset feeds: %s", err)
-		os.Exit(1)
+		return dbError(err, "could not reset feeds")
 	}
 	fmt.Println("feeds table was reset")
 
 	err = s.db.ResetFeedFollows(context.Background())
 	if err != nil {
-		fmt.Printf("could not reset feed follows: %s", err)
-		os.Exit(1)
+		return dbError(err, "could not reset feed follows")
 	}
 	fmt.Println("feed follows table was reset")
 
+	//the session went with the users
+	err = s.config.SetSession("")
+	if err != nil {
+		return fmt.Errorf("could not clear session: %w", err)
+	}
 	return nil
 }
 
-func handlerList(s *state, cmd command) error {
+func handlerList(s *state, cmd command, current database.User) error {
 	//func that lists all the users in the user table
 	users, err := s.db.GetUsers(context.Background())
 	if err != nil {
-		fmt.Printf("could not get users: %s", err)
-		os.Exit(1)
+		return dbError(err, "could not get users")
+	}
+
+	if s.output != outputText {
+		table := outputTable{columns: []string{"id", "name", "current", "admin", "created_at", "updated_at"}}
+		for _, user := range users {
+			table.add(user.ID.String(),
+				user.Name,
+				user.ID == current.ID,
+				user.IsAdmin,
+				formatTime(user.CreatedAt),
+				formatTime(user.UpdatedAt))
+		}
+		return writeTable(s, table)
 	}
+
 	for _, user := range users {
 		status := ""
-		if user.Name == s.config.UserName {
-			status = " (current)"
+		if user.IsAdmin {
+			status += " (admin)"
+		}
+		if user.ID == current.ID {
+			status += " (current)"
 		}
 		fmt.Printf("* %s%s\n", user.Name, status)
 	}
@@ -102,94 +115,162 @@ func handlerList(s *state, cmd command) error {
 
 func handlerAgg(s *state, cmd command) error {
 	//func that aggregates the RSS feeds
+	//it runs until SIGINT/SIGTERM, or scrapes every feed once and exits with --once
 
-	//the fake feed URL is used for testing
-	//remove in production
-	//cmd.args = []string{"https://www.wagslane.dev/index.xml"}
-
-	if len(cmd.args) == 0 {
-		return fmt.Errorf("agg command requires 1 or more arguments")
+	once := cmd.flagBool("once")
+	time_between_reqs := ""
+	if len(cmd.args) > 0 {
+		time_between_reqs = cmd.args[0]
+	}
+	if time_between_reqs == "" && !once {
+		return &usageError{command: cmd.def, msg: "agg: missing interval (or use --once)"}
 	}
 
-	time_between_reqs := cmd.args[0]
-	ticker_duration, err := time.ParseDuration(time_between_reqs)
 	ticker_min, _ := time.ParseDuration("10m")
-	if ticker_duration < ticker_min {
-		ticker_duration = ticker_min
+	ticker_duration := ticker_min
+	if time_between_reqs != "" {
+		var err error
+		ticker_duration, err = time.ParseDuration(time_between_reqs)
+		if err != nil {
+			return &usageError{command: cmd.def, msg: fmt.Sprintf("agg: invalid interval %q, use a number and a unit such as 1h or 30m", time_between_reqs)}
+		}
+		if ticker_duration < ticker_min {
+			ticker_duration = ticker_min
+		}
 	}
+
+	hooks, err := newPostHooks(s.config)
 	if err != nil {
-		return fmt.Errorf("could not parse time duration: %w", err)
+		return fmt.Errorf("invalid post_hooks: %w", err)
 	}
+	s.hooks.Store(hooks)
 
-	fmt.Printf("Collecting feeds every %s\n", ticker_duration)
-
-	//do an initial scrape of the feeds	before starting the ticker
-	err = scrapeFeeds(s)
+	pidFile, err := aggPidFilePath(s.config)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockPidFile(pidFile)
 	if err != nil {
-		return fmt.Errorf("could not scrape feeds: %w", err)
+		return err
 	}
+	defer unlock()
 
-	ticker := time.NewTicker(ticker_duration)
-	for ; ; <-ticker.C {
-		err := scrapeFeeds(s)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := watchSignals(ctx, s, cancel)
+	//waited for before cancel runs, so a clean stop lets deliveries and hooks finish, and a second signal cuts them short
+	s.workers = startAggWorkers(ctx, s)
+	defer s.workers.wait()
+
+	if s.config.MetricsAddr != "" {
+		stopMetrics, err := startMetricsServer(s, s.config.MetricsAddr)
 		if err != nil {
-			return fmt.Errorf("could not scrape feeds: %w", err)
+			return err
 		}
+		defer stopMetrics()
+	}
+	//pushes can only be taken while agg keeps running
+	if !once && (s.config.WebSubAddr != "" || s.config.WebSubCallbackURL != "") {
+		stopWebSub, err := startWebSubServer(s, s.config.WebSubAddr, s.config.WebSubCallbackURL)
+		if err != nil {
+			return err
+		}
+		defer stopWebSub()
+	}
+
+	if once {
+		s.logger.Info("collecting every feed once")
+		return runAggOnce(ctx, s, signals)
 	}
 
-	// old code used to test feed aggregation -- TODO remove eventually
-	// for _, feedURL := range cmd.args {
-	// 	feed, err := fetchFeed(context.Background(), feedURL)
-	// 	if err != nil {
-	// 		fmt.Printf("could not fetch feed: %s", err)
-	// 		os.Exit(1)
-	// 	}
-	// 	fmt.Printf("Feed: %s\n", feed.Channel.Title)
-	// 	fmt.Printf("Link: %s\n", feed.Channel.Link[0])
-	// 	fmt.Printf("Description: %s\n", feed.Channel.Description)
-	// 	fmt.Println("Items:")
-	// 	for _, item := range feed.Channel.Item {
-	// 		fmt.Printf("  * %s\n", item.Title)
-	// 		fmt.Printf("    %s\n", item.Link)
-	// 		fmt.Printf("    %s\n", item.Description)
-	// 		fmt.Printf("    %s\n", item.PubDate)
-	// 	}
-	// }
-	// return nil
+	s.logger.Info("collecting feeds", "interval", ticker_duration)
+	err = runAggLoop(ctx, s, signals, ticker_duration)
+	s.logger.Info("aggregator stopped")
+	return err
 }
 
 func handlerAddFeed(s *state, cmd command, user database.User) error {
 	//func that adds a feed to the feeds table
-	if len(cmd.args) != 2 {
-		fmt.Println("addfeed command requires 2 arguments")
-		os.Exit(1)
+	//the name is optional and defaults to the title of the feed's channel
+	feedName := ""
+	feedURL := cmd.args[0]
+	if len(cmd.args) == 2 {
+		feedName = cmd.args[0]
+		feedURL = cmd.args[1]
+	}
+
+	feedURL, err := normalizeFeedURL(feedURL)
+	if err != nil {
+		return &usageError{command: cmd.def, msg: fmt.Sprintf("addfeed: invalid feed url: %s", err)}
+	}
+
+	//fetch the feed once to make sure it actually parses before storing it
+	feedRSS, err := fetchFeed(context.Background(), s, feedURL)
+	if errors.Is(err, errParseFeed) {
+		return fmt.Errorf("%s is not a valid rss feed: %w", feedURL, err)
+	}
+	if err != nil {
+		return networkError(err, "could not fetch feed")
+	}
+	if feedRSS.MovedTo != "" {
+		feedURL, err = normalizeFeedURL(feedRSS.MovedTo)
+		if err != nil {
+			return fmt.Errorf("feed moved to an invalid url: %w", err)
+		}
+	}
+
+	urlKey, err := feedURLKey(feedURL)
+	if err != nil {
+		return fmt.Errorf("invalid feed url: %w", err)
+	}
+	existing, err := s.db.GetFeedByUrl(context.Background(), urlKey)
+	if err == nil {
+		return alreadyExistsError("feed already exists: %s (%s)", existing.Name, existing.Url)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return dbError(err, "could not look up feed")
+	}
+	if feedName == "" {
+		feedName = strings.TrimSpace(feedRSS.Channel.Title)
+	}
+	if feedName == "" {
+		return &usageError{command: cmd.def, msg: "addfeed: the feed has no title, please provide a name"}
 	}
 
-	feedid := uuid.New()
 	timeNow := time.Now()
 
 	feed, err := s.db.CreateFeed(context.Background(),
 		database.CreateFeedParams{ID: uuid.New(),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-			Name:      cmd.args[0],
-			Url:       cmd.args[1],
-			UserID:    user.ID,
+			CreatedAt:   timeNow,
+			UpdatedAt:   timeNow,
+			Name:        feedName,
+			Url:         feedURL,
+			UserID:      user.ID,
+			Description: strings.TrimSpace(feedRSS.Channel.Description),
+			SiteLink:    siteLink(feedRSS),
+			Language:    strings.TrimSpace(feedRSS.Channel.Language),
+			ImageUrl:    strings.TrimSpace(feedRSS.Channel.Image.URL),
+			UrlKey:      urlKey,
 		})
 
 	if err != nil {
-		fmt.Printf("could not create feed: %s", err)
-		os.Exit(1)
+		return dbError(err, "feed %s", feedName)
+	}
+	if cmd.flagBool("full-content") {
+		err = s.db.SetFeedFetchFullContent(context.Background(), database.SetFeedFetchFullContentParams{ID: feed.ID, FetchFullContent: true})
+		if err != nil {
+			return dbError(err, "could not turn on full content for %s", feed.Name)
+		}
 	}
 
 	//print the fields of the newly created feed
 	fmt.Println("feed was created.")
-	fmt.Printf("ID: %s\n", feedid)
-	fmt.Printf("Created At: %s\n", timeNow)
-	fmt.Printf("Updated At: %s\n", timeNow)
-	fmt.Printf("Name: %s\n", cmd.args[0])
-	fmt.Printf("URL: %s\n", cmd.args[1])
-	fmt.Printf("User ID: %s\n", user.ID)
+	fmt.Printf("ID: %s\n", feed.ID)
+	fmt.Printf("Created At: %s\n", feed.CreatedAt)
+	fmt.Printf("Updated At: %s\n", feed.UpdatedAt)
+	fmt.Printf("Name: %s\n", feed.Name)
+	fmt.Printf("URL: %s\n", feed.Url)
+	fmt.Printf("User ID: %s\n", feed.UserID)
 
 	_, err = s.db.CreateFeedFollow(context.Background(),
 		database.CreateFeedFollowParams{ID: uuid.New(),
@@ -200,44 +281,128 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 		})
 
 	if err != nil {
-		fmt.Printf("could not create feed follow: %s", err)
-		os.Exit(1)
+		return dbError(err, "could not follow feed %s", feed.Name)
 	}
 
 	return nil
 }
 
-func handlerFeeds(s *state, cmd command) error {
+func handlerFeeds(s *state, cmd command, user database.User) error {
 	//func that lists all the feeds in the feeds table
 	feeds, err := s.db.GetFeeds(context.Background())
 	if err != nil {
-		fmt.Printf("could not get feeds: %s", err)
-		os.Exit(1)
+		return dbError(err, "could not get feeds")
+	}
+
+	if s.output != outputText {
+		table := outputTable{columns: []string{"id", "name", "url", "site_link", "description", "language", "image_url",
+			"created_by", "created_at", "updated_at", "last_fetched_at", "last_fetch_status", "last_fetch_error", "fetch_full_content", "websub"}}
+		for _, feed := range feeds {
+			feedUser, err := getUserById(s, feed.UserID)
+			if err != nil {
+				return err
+			}
+			webSub, err := webSubStatus(s, feed.ID)
+			if err != nil {
+				return err
+			}
+			table.add(feed.ID.String(),
+				feed.Name,
+				feed.Url,
+				feed.SiteLink,
+				feed.Description,
+				feed.Language,
+				feed.ImageUrl,
+				feedUser.Name,
+				formatTime(feed.CreatedAt),
+				formatTime(feed.UpdatedAt),
+				nullTime(feed.LastFetchedAt),
+				nullInt32(feed.LastFetchStatus),
+				feed.LastFetchError,
+				feed.FetchFullContent,
+				webSub)
+		}
+		return writeTable(s, table)
 	}
+
 	for _, feed := range feeds {
 		fmt.Printf("*Feed Name: %s\n", feed.Name)
 		fmt.Printf("Feed URL:  %s\n", feed.Url)
 		feedUser, err := getUserById(s, feed.UserID)
 		if err != nil {
-			fmt.Printf("could not get user by id: %s", err)
-			os.Exit(1)
+			return err
 		}
 		fmt.Printf("Created By: %s\n", feedUser.Name)
+		if feed.Description != "" {
+			fmt.Printf("Description: %s\n", feed.Description)
+		}
+		if feed.SiteLink != "" {
+			fmt.Printf("Site: %s\n", feed.SiteLink)
+		}
+		if feed.Language != "" {
+			fmt.Printf("Language: %s\n", feed.Language)
+		}
+		if feed.ImageUrl != "" {
+			fmt.Printf("Image: %s\n", feed.ImageUrl)
+		}
+		if feed.FetchFullContent {
+			fmt.Println("Full Content: on")
+		}
+		webSub, err := webSubStatus(s, feed.ID)
+		if err != nil {
+			return err
+		}
+		if webSub != "" {
+			fmt.Printf("WebSub: %s\n", webSub)
+		}
+		if feed.LastFetchError != "" {
+			fmt.Printf("Last Fetch Error: %s\n", feed.LastFetchError)
+		}
 	}
 	return nil
 }
 
-func handlerAddFollow(s *state, cmd command, user database.User) error {
-	//func that adds a follow to the feed follows table
-	if len(cmd.args) == 0 {
-		fmt.Println("addfollow command requires 1 argument")
-		os.Exit(1)
+func handlerFullContent(s *state, cmd command, user database.User) error {
+	//func that turns fetching the full article of every new post of a feed on or off,
+	//or shows whether it is on when neither is given
+	feed, err := getFeedByURL(s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	if len(cmd.args) == 1 {
+		fmt.Printf("full content for %s is %s\n", feed.Name, onOff(feed.FetchFullContent))
+		return nil
+	}
+
+	var enabled bool
+	switch strings.ToLower(cmd.args[1]) {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		return &usageError{command: cmd.def, msg: fmt.Sprintf("fullcontent: invalid setting %q, use on or off", cmd.args[1])}
+	}
+	err = s.db.SetFeedFetchFullContent(context.Background(), database.SetFeedFetchFullContentParams{ID: feed.ID, FetchFullContent: enabled})
+	if err != nil {
+		return dbError(err, "could not update %s", feed.Name)
 	}
+	fmt.Printf("full content for %s is now %s\n", feed.Name, onOff(enabled))
+	return nil
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
 
-	feed, err := s.db.GetFeedByUrl(context.Background(), cmd.args[0])
+func handlerAddFollow(s *state, cmd command, user database.User) error {
+	//func that adds a follow to the feed follows table
+	feed, err := getFeedByURL(s, cmd.args[0])
 	if err != nil {
-		fmt.Printf("could not get feed by URL: %s", err)
-		os.Exit(1)
+		return err
 	}
 
 	timeNow := time.Now()
@@ -252,8 +417,7 @@ func handlerAddFollow(s *state, cmd command, user database.User) error {
 		})
 
 	if err != nil {
-		fmt.Printf("could not create feed follow: %s", err)
-		os.Exit(1)
+		return dbError(err, "follow of %s", feed.Name)
 	}
 
 	return nil
@@ -261,15 +425,9 @@ func handlerAddFollow(s *state, cmd command, user database.User) error {
 
 func handlerDeleteFollow(s *state, cmd command, user database.User) error {
 	//func that deletes a follow from the feed follows table
-	if len(cmd.args) == 0 {
-		fmt.Println("deletefollow command requires 1 argument")
-		os.Exit(1)
-	}
-
-	feed, err := s.db.GetFeedByUrl(context.Background(), cmd.args[0])
+	feed, err := getFeedByURL(s, cmd.args[0])
 	if err != nil {
-		fmt.Printf("could not get feed by URL: %s", err)
-		os.Exit(1)
+		return err
 	}
 
 	err = s.db.DeleteFeedFollow(context.Background(),
@@ -278,8 +436,7 @@ func handlerDeleteFollow(s *state, cmd command, user database.User) error {
 		})
 
 	if err != nil {
-		fmt.Printf("could not delete feed follow: %s", err)
-		os.Exit(1)
+		return dbError(err, "could not unfollow feed %s", feed.Name)
 	}
 
 	fmt.Printf("Unfollowed feed: %s\n", feed.Name)
@@ -292,8 +449,20 @@ func handlerFollowing(s *state, cmd command, user database.User) error {
 
 	follows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
 	if err != nil {
-		fmt.Printf("could not get feed follows by user: %s", err)
-		os.Exit(1)
+		return dbError(err, "could not get followed feeds")
+	}
+
+	if s.output != outputText {
+		table := outputTable{columns: []string{"id", "feed_id", "feed_name", "feed_url", "user_name", "created_at"}}
+		for _, follow := range follows {
+			table.add(follow.ID.String(),
+				follow.FeedID.String(),
+				follow.FeedName,
+				follow.FeedUrl,
+				follow.UserName,
+				formatTime(follow.CreatedAt))
+		}
+		return writeTable(s, table)
 	}
 
 	if len(follows) == 0 {
@@ -313,37 +482,264 @@ func handlerBrowse(s *state, cmd command, user database.User) error {
 	//func that takes a limit parameter and lists all the posts in the posts table
 	//that the current user is following, limited by the limit parameter
 
-	if len(cmd.args) == 0 {
-		cmd.args = append(cmd.args, "2")
-	}
-
-	limit, err := strconv.Atoi(cmd.args[0])
-	if err != nil {
-		limit = 2
+	limit := 2
+	if len(cmd.args) > 0 {
+		var err error
+		limit, err = strconv.Atoi(cmd.args[0])
+		if err != nil || limit < 1 {
+			return &usageError{command: cmd.def, msg: fmt.Sprintf("posts: invalid limit %q, use a positive number", cmd.args[0])}
+		}
 	}
 
-	posts, err := s.db.GetPostsForUser(context.Background(),
+	rows, err := s.db.GetPostsForUser(context.Background(),
 		database.GetPostsForUserParams{UserID: user.ID,
-			Limit: int32(limit),
+			Limit:        int32(limit),
+			IncludeMuted: cmd.flagBool("muted"),
 		})
 
 	if err != nil {
-		fmt.Printf("could not get posts for user: %s", err)
-		os.Exit(1)
+		return dbError(err, "could not get posts")
+	}
+
+	postIDs := make([]uuid.UUID, 0, len(rows))
+	storyIDs := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		postIDs = append(postIDs, row.Post.ID)
+		storyIDs = append(storyIDs, postStoryID(row.Post))
+	}
+	categories, err := getPostCategories(s, postIDs)
+	if err != nil {
+		return err
+	}
+	stories, err := getStoryFeeds(s, user, storyIDs)
+	if err != nil {
+		return err
+	}
+
+	if s.output != outputText {
+		table := outputTable{columns: []string{"id", "short_id", "title", "url", "summary", "description", "content",
+			"full_content", "author", "categories", "guid", "comments_url", "enclosure_url", "enclosure_type", "enclosure_length",
+			"highlighted", "story_id", "also_in", "published_at", "feed_id", "created_at", "updated_at"}}
+		for _, row := range rows {
+			post := row.Post
+			table.add(post.ID.String(),
+				post.ShortID,
+				post.Title,
+				post.Url,
+				postSummary(post),
+				post.Description,
+				post.Content,
+				post.FullContent,
+				post.Author,
+				strings.Join(categories[post.ID], ", "),
+				post.Guid,
+				post.CommentsUrl,
+				post.EnclosureUrl,
+				post.EnclosureType,
+				post.EnclosureLength,
+				row.Highlighted,
+				postStoryID(post).String(),
+				strings.Join(alsoIn(post, stories), ", "),
+				formatTime(post.PublishedAt),
+				post.FeedID.String(),
+				formatTime(post.CreatedAt),
+				formatTime(post.UpdatedAt))
+		}
+		return writeTable(s, table)
 	}
 
-	if len(posts) == 0 {
+	if len(rows) == 0 {
 		fmt.Println("No posts to display.")
 		return nil
 	}
 
 	fmt.Println("Posts:")
-	for _, post := range posts {
-		fmt.Printf("* %s\n", post.Title)
+	for _, row := range rows {
+		post := row.Post
+		//highlighted posts are marked with ! instead of *
+		bullet := "*"
+		if row.Highlighted {
+			bullet = "!"
+		}
+		fmt.Printf("%s [%d] %s\n", bullet, post.ShortID, post.Title)
 		fmt.Printf("  %s\n", post.Url)
-		fmt.Printf("  %s\n", post.Description)
+		if byline := postByline(post, categories[post.ID]); byline != "" {
+			fmt.Printf("  %s\n", byline)
+		}
+		if summary := postSummary(post); summary != "" {
+			fmt.Printf("  %s\n", summary)
+		}
+		if post.EnclosureUrl != "" {
+			fmt.Printf("  enclosure: %s\n", postEnclosure(post))
+		}
+		if post.CommentsUrl != "" {
+			fmt.Printf("  comments: %s\n", post.CommentsUrl)
+		}
+		if feeds := alsoIn(post, stories); len(feeds) > 0 {
+			fmt.Printf("  also in: %s\n", strings.Join(feeds, ", "))
+		}
 		fmt.Printf("  %s\n", post.PublishedAt)
 	}
 
 	return nil
 }
+
+func getPostCategories(s *state, postIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	//func that gets the categories of a list of posts, keyed by post id
+	rows, err := s.db.GetCategoriesForPosts(context.Background(), postIDs)
+	if err != nil {
+		return nil, dbError(err, "could not get post categories")
+	}
+	categories := make(map[uuid.UUID][]string)
+	for _, row := range rows {
+		categories[row.PostID] = append(categories[row.PostID], row.Name)
+	}
+	return categories, nil
+}
+
+func postByline(post database.Post, categories []string) string {
+	//func that returns the "by author · in categories" line of a post, leaving out whichever it does not have
+	var parts []string
+	if post.Author != "" {
+		parts = append(parts, "by "+post.Author)
+	}
+	if len(categories) > 0 {
+		parts = append(parts, "in "+strings.Join(categories, ", "))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func postEnclosure(post database.Post) string {
+	//func that describes a post's enclosure, e.g. "https://example.com/ep1.mp3 (audio/mpeg, 12.3 MB)"
+	var details []string
+	if post.EnclosureType != "" {
+		details = append(details, post.EnclosureType)
+	}
+	if post.EnclosureLength > 0 {
+		details = append(details, formatBytes(post.EnclosureLength))
+	}
+	if len(details) == 0 {
+		return post.EnclosureUrl
+	}
+	return fmt.Sprintf("%s (%s)", post.EnclosureUrl, strings.Join(details, ", "))
+}
+
+func episodeSummary(episode database.Episode) string {
+	//func that describes the podcast details of an episode, e.g. "season 2, episode 5 · 1:02:03 · explicit"
+	var parts []string
+	switch {
+	case episode.Season.Valid && episode.Episode.Valid:
+		parts = append(parts, fmt.Sprintf("season %d, episode %d", episode.Season.Int32, episode.Episode.Int32))
+	case episode.Episode.Valid:
+		parts = append(parts, fmt.Sprintf("episode %d", episode.Episode.Int32))
+	case episode.Season.Valid:
+		parts = append(parts, fmt.Sprintf("season %d", episode.Season.Int32))
+	}
+	if episode.DurationSeconds.Valid {
+		d := episode.DurationSeconds.Int32
+		if d >= 3600 {
+			parts = append(parts, fmt.Sprintf("%d:%02d:%02d", d/3600, d/60%60, d%60))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d:%02d", d/60, d%60))
+		}
+	}
+	if episode.Explicit.Valid && episode.Explicit.Bool {
+		parts = append(parts, "explicit")
+	}
+	return strings.Join(parts, " · ")
+}
+
+func formatBytes(n int64) string {
+	//func that formats a size in bytes for people, e.g. 12.3 MB
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+func postSummary(post database.Post) string {
+	//func that returns the summary of a post, working it out for posts stored before summaries were
+	if post.Summary != "" {
+		return post.Summary
+	}
+	return summarizeHTML(post.Description)
+}
+
+func handlerOpen(s *state, cmd command, user database.User) error {
+	//func that opens a post in the browser by its short id and marks it read
+	post, err := getPostByShortID(s, cmd, user)
+	if err != nil {
+		return err
+	}
+	//a browser from $BROWSER may be a terminal one, so it gets the terminal,
+	//while the platform's opener only needs somewhere to report errors
+	browser, fromEnv := browserCommand(post.Post.Url)
+	browser.Stderr = os.Stderr
+	if fromEnv {
+		browser.Stdin, browser.Stdout = os.Stdin, os.Stdout
+	}
+	if err := browser.Run(); err != nil {
+		return fmt.Errorf("could not open %s: %w", post.Post.Url, err)
+	}
+	return markPostRead(s, user, post.Post.ID)
+}
+
+func handlerShow(s *state, cmd command, user database.User) error {
+	//func that shows a post as readable text through the pager by its short id and marks it read
+	post, err := getPostByShortID(s, cmd, user)
+	if err != nil {
+		return err
+	}
+	categories, err := getPostCategories(s, []uuid.UUID{post.Post.ID})
+	if err != nil {
+		return err
+	}
+	var episode *database.Episode
+	if post.Post.EnclosureUrl != "" {
+		found, err := s.db.GetEpisodeForPost(context.Background(), post.Post.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return dbError(err, "could not get episode")
+		}
+		if err == nil {
+			episode = &found
+		}
+	}
+	if err := showInPager(renderPost(post.Post, post.FeedName, categories[post.Post.ID], episode, terminalWidth())); err != nil {
+		return err
+	}
+	return markPostRead(s, user, post.Post.ID)
+}
+
+func getPostByShortID(s *state, cmd command, user database.User) (database.GetPostByShortIdRow, error) {
+	//func that looks up the post named by the first arg, which is the id shown by "gator posts", e.g. 12 or #12
+	//only posts of feeds the user follows are found
+	shortID, err := strconv.ParseInt(strings.TrimPrefix(cmd.args[0], "#"), 10, 64)
+	if err != nil || shortID < 1 {
+		return database.GetPostByShortIdRow{}, &usageError{command: cmd.def, msg: fmt.Sprintf("%s: invalid post id %q, use the number shown by \"gator posts\"", cmd.name, cmd.args[0])}
+	}
+	post, err := s.db.GetPostByShortId(context.Background(), database.GetPostByShortIdParams{UserID: user.ID, ShortID: shortID})
+	if err != nil {
+		return database.GetPostByShortIdRow{}, dbError(err, "post %d", shortID)
+	}
+	return post, nil
+}
+
+func markPostRead(s *state, user database.User, postID uuid.UUID) error {
+	//func that marks a post read for a user
+	err := s.db.SetPostRead(context.Background(), database.SetPostReadParams{
+		ID:     uuid.New(),
+		UserID: user.ID,
+		PostID: postID,
+		ReadAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		return dbError(err, "could not mark post read")
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const bashCompletion = `# bash completion for gator
+_gator_completion() {
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null 2>&1; then
+        # keep urls in one piece even though ':' is in COMP_WORDBREAKS
+        _get_comp_words_by_ref -n =: cur words cword
+    else
+        cur="${COMP_WORDS[COMP_CWORD]}"
+        words=("${COMP_WORDS[@]}")
+        cword=$COMP_CWORD
+    fi
+
+    local IFS=$'\n'
+    COMPREPLY=($(gator __complete "${words[@]:1:cword}" 2>/dev/null))
+
+    if declare -F __ltrim_colon_completions >/dev/null 2>&1; then
+        __ltrim_colon_completions "$cur"
+    fi
+}
+complete -F _gator_completion gator
+`
+
+const zshCompletion = `#compdef gator
+# zsh completion for gator
+_gator() {
+    local -a completions
+    completions=(${(f)"$(gator __complete "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    (( ${#completions} )) && compadd -Q -a completions
+}
+
+if [ "$funcstack[1]" = "_gator" ]; then
+    _gator "$@"
+else
+    compdef _gator gator
+fi
+`
+
+const fishCompletion = `# fish completion for gator
+function __gator_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    gator __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c gator -f -a '(__gator_complete)'
+`
+
+func handlerCompletion(s *state, cmd command) error {
+	//func that prints the completion script for a shell
+	switch cmd.args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		return &usageError{command: cmd.def, msg: fmt.Sprintf("completion: unsupported shell %q, use bash, zsh or fish", cmd.args[0])}
+	}
+	return nil
+}
+
+func handlerComplete(c *commands) func(*state, command) error {
+	//func that returns the handler the completion scripts call back into
+	//the args are the words typed after "gator", the last one being the word being completed
+	return func(s *state, cmd command) error {
+		words := cmd.args
+		if len(words) == 0 {
+			words = []string{""}
+		}
+		toComplete := words[len(words)-1]
+		prior := words[:len(words)-1]
+
+		candidates, err := completeWords(c, s, prior, toComplete)
+		if err != nil {
+			//completion runs in the background of the shell, so errors just mean no suggestions
+			return nil
+		}
+		for _, candidate := range candidates {
+			if strings.HasPrefix(candidate, toComplete) {
+				fmt.Println(candidate)
+			}
+		}
+		return nil
+	}
+}
+
+func completeWords(c *commands, s *state, prior []string, toComplete string) ([]string, error) {
+	//func that returns every value that could go in the word being completed
+	if len(prior) == 0 {
+		return completeCommands(c)(s)
+	}
+	def, ok := c.names[prior[0]]
+	if !ok || def.rawArgs {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(toComplete, "-") {
+		candidates := []string{"--help"}
+		if def.output {
+			candidates = append(candidates, "--output")
+		}
+		for _, f := range def.flags {
+			candidates = append(candidates, "--"+f.name)
+		}
+		return candidates, nil
+	}
+
+	//work out which positional arg is being completed, skipping flags and their values
+	position := 0
+	for i := 1; i < len(prior); i++ {
+		word := prior[i]
+		if !strings.HasPrefix(word, "-") {
+			position++
+			continue
+		}
+		if strings.Contains(word, "=") {
+			continue
+		}
+		if flagTakesValue(def, word) {
+			if i == len(prior)-1 {
+				//the word being completed is the value of this flag
+				if def.output && (strings.TrimLeft(word, "-") == "output" || word == "-o") {
+					return []string{outputText, outputJSON, outputCSV, outputTSV, outputYAML}, nil
+				}
+				return nil, nil
+			}
+			i++
+		}
+	}
+
+	if position >= len(def.args) || def.args[position].complete == nil {
+		return nil, nil
+	}
+	return def.args[position].complete(s)
+}
+
+func flagTakesValue(def commandDef, word string) bool {
+	//func that reports whether a flag word is followed by a separate value
+	name := strings.TrimLeft(word, "-")
+	if def.output && (name == "output" || word == "-o") {
+		return true
+	}
+	for _, f := range def.flags {
+		if f.name == name {
+			return !f.isBool
+		}
+	}
+	return false
+}
+
+func completeCommands(c *commands) func(*state) ([]string, error) {
+	return func(s *state) ([]string, error) {
+		var names []string
+		for _, name := range c.order {
+			if !c.names[name].hidden {
+				names = append(names, name)
+			}
+		}
+		return names, nil
+	}
+}
+
+func completeShells(s *state) ([]string, error) {
+	return []string{"bash", "zsh", "fish"}, nil
+}
+
+func completeOnOff(s *state) ([]string, error) {
+	return []string{"on", "off"}, nil
+}
+
+func completeWebhookKinds(s *state) ([]string, error) {
+	return webhookKinds, nil
+}
+
+func completeUserNames(s *state) ([]string, error) {
+	users, err := s.db.GetUsers(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, user.Name)
+	}
+	return names, nil
+}
+
+func completeFeedURLs(s *state) ([]string, error) {
+	feeds, err := s.db.GetFeeds(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, 0, len(feeds))
+	for _, feed := range feeds {
+		urls = append(urls, feed.Url)
+	}
+	return urls, nil
+}
+
+func completeFollowedFeedURLs(s *state) ([]string, error) {
+	user, err := getCurrentUser(s)
+	if err != nil {
+		return nil, err
+	}
+	follows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, 0, len(follows))
+	for _, follow := range follows {
+		urls = append(urls, follow.FeedUrl)
+	}
+	return urls, nil
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"internal/config"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/gator/internal/database"
+)
+
+const (
+	//most posts put in one digest, and how long talking to the smtp server may take
+	digestMaxPosts = 200
+	smtpTimeout    = 30 * time.Second
+)
+
+var digestFrequencies = []string{"off", "daily", "weekly"}
+
+var digestTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 0 auto; color: #222;">
+<h1 style="font-size: 1.4em;">{{.Subject}}</h1>
+{{range .Feeds}}<h2 style="font-size: 1.15em; border-bottom: 1px solid #ddd; padding-bottom: 0.2em;">{{.Name}}</h2>
+{{range .Posts}}<p style="margin: 0 0 1em 0;"><a href="{{.URL}}" style="font-weight: bold;">{{.Title}}</a><br>
+<small style="color: #666;">[{{.ShortID}}] {{.PublishedAt}}</small>{{if .Summary}}<br>{{.Summary}}{{end}}</p>
+{{end}}{{end}}<p style="color: #666; font-size: 0.85em;">sent by gator. see a post with "gator show id", or change how often digests come with "gator digest --every".</p>
+</body></html>
+`))
+
+type digest struct {
+	//the posts of a digest grouped by feed, ready to be written out as text or html
+	Subject string
+	Feeds   []digestFeed
+	postIDs []uuid.UUID
+}
+
+type digestFeed struct {
+	Name  string
+	Posts []digestPost
+}
+
+type digestPost struct {
+	ShortID     int64
+	Title       string
+	URL         string
+	Summary     string
+	PublishedAt string
+}
+
+type smtpSettings struct {
+	//the smtp server from the config, with defaults filled in
+	host     string
+	port     int
+	security string
+	username string
+	password string
+	from     *mail.Address
+}
+
+func handlerDigest(s *state, cmd command, user database.User) error {
+	//func that emails the current user a digest of their unread posts now, or with --due the digest of every
+	//user whose digest is due, which only admins may do, or with --email/--every changes where and how often digests are sent
+	email, every := strings.TrimSpace(cmd.flag("email")), strings.ToLower(cmd.flag("every"))
+	if email != "" || every != "" {
+		return setDigestSettings(s, cmd, user, email, every)
+	}
+
+	ctx := context.Background()
+	dryRun := cmd.flagBool("dry-run")
+	if cmd.flagBool("due") {
+		if dryRun {
+			return &usageError{command: cmd.def, msg: "digest: --dry-run does not work with --due"}
+		}
+		if !user.IsAdmin {
+			return authError("only an admin can send the digests of every user")
+		}
+		sent, err := sendDueDigests(ctx, s)
+		fmt.Printf("sent %d digests\n", sent)
+		return err
+	}
+
+	if user.Email == "" && !dryRun {
+		return &usageError{command: cmd.def, msg: "digest: no email address set, add one with \"gator digest --email address\""}
+	}
+	var smtpConfig smtpSettings
+	if !dryRun {
+		var err error
+		smtpConfig, err = newSMTPSettings(s.config)
+		if err != nil {
+			return err
+		}
+	}
+	d, err := buildDigest(ctx, s, user, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(d.postIDs) == 0 {
+		fmt.Println("no unread posts to send")
+		return nil
+	}
+	if dryRun {
+		fmt.Print(d.text())
+		return nil
+	}
+	err = sendDigest(ctx, s, smtpConfig, user, d)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("sent a digest of %d posts to %s\n", len(d.postIDs), user.Email)
+	return nil
+}
+
+func setDigestSettings(s *state, cmd command, user database.User, email, every string) error {
+	//func that stores the address digests go to and how often they are sent
+	if email == "" {
+		email = user.Email
+	} else if email == "none" {
+		email = ""
+	} else {
+		address, err := mail.ParseAddress(email)
+		if err != nil {
+			return &usageError{command: cmd.def, msg: fmt.Sprintf("digest: invalid email address %q", email)}
+		}
+		email = address.Address
+	}
+	if every == "" {
+		every = user.DigestFrequency
+	}
+	if !slices.Contains(digestFrequencies, every) {
+		return &usageError{command: cmd.def, msg: fmt.Sprintf("digest: invalid --every %q, use daily, weekly or off", every)}
+	}
+	if every != "off" && email == "" {
+		return &usageError{command: cmd.def, msg: "digest: set an email address with --email before turning digests on"}
+	}
+
+	updated, err := s.db.SetUserDigestSettings(context.Background(), database.SetUserDigestSettingsParams{ID: user.ID, Email: email, DigestFrequency: every})
+	if err != nil {
+		return dbError(err, "could not update digest settings")
+	}
+	switch {
+	case updated.DigestFrequency == "off" && updated.Email == "":
+		fmt.Println("digests are off")
+	case updated.DigestFrequency == "off":
+		fmt.Printf("digests are off, \"gator digest\" sends one to %s\n", updated.Email)
+	default:
+		fmt.Printf("digests go to %s %s\n", updated.Email, updated.DigestFrequency)
+	}
+	return nil
+}
+
+func sendDueDigests(ctx context.Context, s *state) (int, error) {
+	//func that sends the digest of every user whose daily or weekly digest is due, returning how many were sent
+	//users with no unread posts are skipped until their next digest is due
+	users, err := s.db.GetUsersDueDigest(ctx)
+	if err != nil {
+		return 0, dbError(err, "could not get users due a digest")
+	}
+	if len(users) == 0 {
+		return 0, nil
+	}
+	smtpConfig, err := newSMTPSettings(s.config)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs []error
+	for _, user := range users {
+		log := s.logger.With("user", user.Name)
+		d, err := buildDigest(ctx, s, user, time.Now())
+		if err == nil && len(d.postIDs) == 0 {
+			err = s.db.RecordDigestSent(ctx, database.RecordDigestSentParams{UserID: user.ID, PostIds: []uuid.UUID{}})
+			if err == nil {
+				log.Debug("no unread posts for digest")
+				continue
+			}
+		}
+		if err == nil {
+			err = sendDigest(ctx, s, smtpConfig, user, d)
+		}
+		if err != nil {
+			log.Warn("could not send digest", "err", err)
+			errs = append(errs, err)
+			continue
+		}
+		log.Info("digest sent", "to", user.Email, "posts", len(d.postIDs))
+		sent++
+	}
+	if len(errs) > 0 {
+		return sent, fmt.Errorf("could not send %d of %d digests: %w", len(errs), len(users), errors.Join(errs...))
+	}
+	return sent, nil
+}
+
+func buildDigest(ctx context.Context, s *state, user database.User, now time.Time) (digest, error) {
+	//func that gathers the unread posts a user has not had in a digest yet, from the last day or week
+	//or since their last digest if that was longer ago
+	window := 7 * 24 * time.Hour
+	if user.DigestFrequency == "daily" {
+		window = 24 * time.Hour
+	}
+	since := now.Add(-window)
+	if user.LastDigestAt.Valid && user.LastDigestAt.Time.Before(since) {
+		since = user.LastDigestAt.Time
+	}
+
+	rows, err := s.db.GetDigestPosts(ctx, database.GetDigestPostsParams{UserID: user.ID, Limit: digestMaxPosts, Since: since})
+	if err != nil {
+		return digest{}, dbError(err, "could not get posts for digest")
+	}
+	var d digest
+	for _, row := range rows {
+		if len(d.Feeds) == 0 || d.Feeds[len(d.Feeds)-1].Name != row.FeedName {
+			d.Feeds = append(d.Feeds, digestFeed{Name: row.FeedName})
+		}
+		feed := &d.Feeds[len(d.Feeds)-1]
+		feed.Posts = append(feed.Posts, digestPost{
+			ShortID:     row.Post.ShortID,
+			Title:       singleLine(row.Post.Title),
+			URL:         row.Post.Url,
+			Summary:     postSummary(row.Post),
+			PublishedAt: row.Post.PublishedAt.Format("Mon Jan 2 15:04"),
+		})
+		d.postIDs = append(d.postIDs, row.Post.ID)
+	}
+	d.Subject = fmt.Sprintf("gator digest: %d unread %s from %d %s", len(rows), plural(len(rows), "post", "posts"),
+		len(d.Feeds), plural(len(d.Feeds), "feed", "feeds"))
+	return d, nil
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+func (d digest) text() string {
+	//func that writes a digest out as plain text
+	var b strings.Builder
+	b.WriteString(d.Subject + "\n")
+	for _, feed := range d.Feeds {
+		b.WriteString("\n" + feed.Name + "\n" + strings.Repeat("=", len([]rune(feed.Name))) + "\n")
+		for _, post := range feed.Posts {
+			fmt.Fprintf(&b, "* [%d] %s\n  %s\n  %s\n", post.ShortID, post.Title, post.URL, post.PublishedAt)
+			if post.Summary != "" {
+				for _, line := range wrapText(post.Summary, 74) {
+					b.WriteString("  " + line + "\n")
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+func (d digest) html() (string, error) {
+	//func that writes a digest out as an html page
+	var b strings.Builder
+	err := digestTemplate.Execute(&b, d)
+	if err != nil {
+		return "", fmt.Errorf("could not render digest: %w", err)
+	}
+	return b.String(), nil
+}
+
+func sendDigest(ctx context.Context, s *state, smtpConfig smtpSettings, user database.User, d digest) error {
+	//func that emails a digest to a user and records its posts as sent, so the next digest leaves them out
+	to, err := mail.ParseAddress(user.Email)
+	if err != nil {
+		return fmt.Errorf("invalid email address for %s: %w", user.Name, err)
+	}
+	to.Name = user.Name
+	htmlBody, err := d.html()
+	if err != nil {
+		return err
+	}
+	message, err := composeMessage(smtpConfig.from, to, d.Subject, d.text(), htmlBody, time.Now())
+	if err != nil {
+		return err
+	}
+	err = sendMail(ctx, smtpConfig, to.Address, message)
+	if err != nil {
+		return err
+	}
+	err = s.db.RecordDigestSent(ctx, database.RecordDigestSentParams{UserID: user.ID, PostIds: d.postIDs})
+	if err != nil {
+		return dbError(err, "could not record digest for %s", user.Name)
+	}
+	return nil
+}
+
+func composeMessage(from, to *mail.Address, subject, text, htmlBody string, now time.Time) ([]byte, error) {
+	//func that builds a multipart/alternative email with a plain text and an html version of the same message
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", htmlBody},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not write message: %w", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("could not write message: %w", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("could not write message: %w", err)
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("could not write message: %w", err)
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("could not make message id: %w", err)
+	}
+	_, domain, _ := strings.Cut(from.Address, "@")
+	var message bytes.Buffer
+	for _, header := range [][2]string{
+		{"From", from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"Message-ID", "<" + hex.EncodeToString(id) + "@" + domain + ">"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": parts.Boundary()})},
+	} {
+		message.WriteString(header[0] + ": " + header[1] + "\r\n")
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+func newSMTPSettings(cfg *config.Config) (smtpSettings, error) {
+	//func that reads the smtp settings from the config, checking that the ones needed are there
+	settings := smtpSettings{host: strings.TrimSpace(cfg.SMTPHost),
+		port:     cfg.SMTPPort,
+		security: strings.ToLower(strings.TrimSpace(cfg.SMTPSecurity)),
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword,
+	}
+	if settings.host == "" {
+		return smtpSettings{}, errors.New("smtp_host is not set in the config file")
+	}
+	if cfg.SMTPFrom == "" {
+		return smtpSettings{}, errors.New("smtp_from is not set in the config file")
+	}
+	from, err := mail.ParseAddress(cfg.SMTPFrom)
+	if err != nil {
+		return smtpSettings{}, fmt.Errorf("invalid smtp_from: %w", err)
+	}
+	settings.from = from
+
+	defaultPort := 0
+	switch settings.security {
+	case "", "starttls":
+		settings.security, defaultPort = "starttls", 587
+	case "tls":
+		defaultPort = 465
+	case "none":
+		defaultPort = 25
+	default:
+		return smtpSettings{}, fmt.Errorf("invalid smtp_security %q, use starttls, tls or none", cfg.SMTPSecurity)
+	}
+	if settings.port == 0 {
+		settings.port = defaultPort
+	}
+	return settings, nil
+}
+
+func sendMail(ctx context.Context, settings smtpSettings, to string, message []byte) error {
+	//func that hands a message to the smtp server
+	//with security "none" nothing is encrypted, which is only meant for a local test server
+	addr := net.JoinHostPort(settings.host, strconv.Itoa(settings.port))
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	var err error
+	if settings.security == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: settings.host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return networkError(err, "could not connect to smtp server %s", addr)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, settings.host)
+	if err != nil {
+		conn.Close()
+		return networkError(err, "could not talk to smtp server %s", addr)
+	}
+	defer client.Close()
+
+	if settings.security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server %s does not support STARTTLS, set smtp_security to tls or none", addr)
+		}
+		err = client.StartTLS(&tls.Config{ServerName: settings.host})
+		if err != nil {
+			return networkError(err, "could not start tls with smtp server %s", addr)
+		}
+	}
+	if settings.username != "" {
+		//smtp.PlainAuth refuses to send the password unencrypted, except to localhost
+		err = client.Auth(smtp.PlainAuth("", settings.username, settings.password, settings.host))
+		if err != nil {
+			return fmt.Errorf("could not log in to smtp server %s: %w", addr, err)
+		}
+	}
+
+	if err := client.Mail(settings.from.Address); err != nil {
+		return fmt.Errorf("smtp server %s refused sender %s: %w", addr, settings.from.Address, err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("smtp server %s refused recipient %s: %w", addr, to, err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return networkError(err, "could not send message to smtp server %s", addr)
+	}
+	if _, err := w.Write(message); err != nil {
+		return networkError(err, "could not send message to smtp server %s", addr)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp server %s did not accept the message: %w", addr, err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+type smtpCapture struct {
+	//what the stand-in smtp server was sent
+	from, to string
+	data     string
+}
+
+func startSMTPServer(t *testing.T) (string, int, <-chan smtpCapture) {
+	//func that starts an smtp server on localhost that accepts one message, for sendMail to talk to
+	//it only knows the commands sendMail uses without tls or auth
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	captured := make(chan smtpCapture, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+		var capture smtpCapture
+		reply("220 localhost test server")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			verb := strings.ToUpper(strings.Fields(line + " ")[0])
+			switch verb {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "MAIL":
+				capture.from = line
+				reply("250 ok")
+			case "RCPT":
+				capture.to = line
+				reply("250 ok")
+			case "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					//undo the dot stuffing of lines that start with a dot
+					data.WriteString(strings.TrimPrefix(line, "."))
+				}
+				capture.data = data.String()
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				captured <- capture
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, captured
+}
+
+func TestSendMail(t *testing.T) {
+	host, port, captured := startSMTPServer(t)
+	from := &mail.Address{Name: "Gator", Address: "gator@example.com"}
+	to := &mail.Address{Name: "Jo", Address: "jo@example.com"}
+	now := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	subject := "Your gator digest: 3 new posts – café"
+	text := "New posts:\n.a line starting with a dot\n" + strings.Repeat("long ", 30)
+	htmlBody := `<p>New posts: <a href="https://example.com/a?x=1&amp;y=2">café</a></p>`
+
+	message, err := composeMessage(from, to, subject, text, htmlBody, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := smtpSettings{host: host, port: port, security: "none", from: from}
+	if err := sendMail(context.Background(), settings, to.Address, message); err != nil {
+		t.Fatal(err)
+	}
+
+	var capture smtpCapture
+	select {
+	case capture = <-captured:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the smtp server got no message")
+	}
+	//the server did not offer any extensions, so sendMail adds no parameters such as BODY=8BITMIME
+	if capture.from != "MAIL FROM:<gator@example.com>" {
+		t.Errorf("MAIL command = %q", capture.from)
+	}
+	if capture.to != "RCPT TO:<jo@example.com>" {
+		t.Errorf("RCPT command = %q", capture.to)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(capture.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for header, want := range map[string]string{
+		"From":         `"Gator" <gator@example.com>`,
+		"To":           `"Jo" <jo@example.com>`,
+		"Date":         "Wed, 01 May 2024 08:30:00 +0000",
+		"MIME-Version": "1.0",
+	} {
+		if got := msg.Header.Get(header); got != want {
+			t.Errorf("%s header = %q, want %q", header, got, want)
+		}
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || decoded != subject {
+		t.Errorf("Subject header = %q (%v), want %q", decoded, err, subject)
+	}
+	if id := msg.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID header = %q", id)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type header = %q (%v)", msg.Header.Get("Content-Type"), err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for i, want := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", htmlBody},
+	} {
+		part, err := parts.NextRawPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i+1, err)
+		}
+		if got := part.Header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("part %d Content-Type = %q, want %q", i+1, got, want.contentType)
+		}
+		if got := part.Header.Get("Content-Transfer-Encoding"); got != "quoted-printable" {
+			t.Errorf("part %d Content-Transfer-Encoding = %q, want quoted-printable", i+1, got)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatalf("part %d: %v", i+1, err)
+		}
+		//smtp carries lines ending in crlf
+		if got := strings.ReplaceAll(string(body), "\r\n", "\n"); got != want.body {
+			t.Errorf("part %d body = %q, want %q", i+1, got, want.body)
+		}
+	}
+	if _, err := parts.NextRawPart(); err != io.EOF {
+		t.Errorf("want two parts, got more (%v)", err)
+	}
+}
+
+func TestSendMailRefused(t *testing.T) {
+	//a server that is not listening is a network error, so scripts can tell it apart
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	settings := smtpSettings{host: "127.0.0.1", port: port, security: "none", from: &mail.Address{Address: "gator@example.com"}}
+	err = sendMail(context.Background(), settings, "jo@example.com", []byte("Subject: x\r\n\r\nx\r\n"))
+	if exitCode(err) != exitNetwork {
+		t.Errorf("sendMail to a closed port = %v (exit %d), want exit %d", err, exitCode(err), exitNetwork)
+	}
+}
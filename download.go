@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/gator/internal/database"
+)
+
+const (
+	//longest file or folder name made from a title, in characters
+	maxFileNameLength = 100
+)
+
+func handlerDownload(s *state, cmd command, user database.User) error {
+	//func that downloads the enclosure of a post, or episodes of a feed with --feed
+	feedURL := cmd.flag("feed")
+	onlyNew := cmd.flagBool("new")
+	switch {
+	case len(cmd.args) == 0 && feedURL == "":
+		return &usageError{command: cmd.def, msg: "download: give a post id or --feed"}
+	case len(cmd.args) > 0 && feedURL != "":
+		return &usageError{command: cmd.def, msg: "download: give a post id or --feed, not both"}
+	case onlyNew && feedURL == "":
+		return &usageError{command: cmd.def, msg: "download: --new only works with --feed"}
+	}
+
+	dir, err := downloadDir(s)
+	if err != nil {
+		return err
+	}
+	//stop cleanly on ctrl-c, leaving the partial file to be resumed next time
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if feedURL == "" {
+		post, err := getPostByShortID(s, cmd, user)
+		if err != nil {
+			return err
+		}
+		return downloadEpisode(ctx, s, user, dir, post.Post, post.FeedName)
+	}
+
+	feed, err := getFeedByURL(s, feedURL)
+	if err != nil {
+		return err
+	}
+	episodes, err := s.db.GetFeedEpisodes(ctx, database.GetFeedEpisodesParams{UserID: user.ID, FeedID: feed.ID})
+	if err != nil {
+		return dbError(err, "could not get episodes of %s", feed.Name)
+	}
+	if len(episodes) == 0 {
+		return notFoundError("feed %s has no episodes to download", feed.Name)
+	}
+	if !onlyNew {
+		//just the latest episode
+		return downloadEpisode(ctx, s, user, dir, episodes[0].Post, episodes[0].FeedName)
+	}
+
+	var errs []error
+	downloaded := 0
+	//oldest first, so the files are made in the order the episodes came out
+	for i := len(episodes) - 1; i >= 0; i-- {
+		if episodes[i].Downloaded {
+			continue
+		}
+		err := downloadEpisode(ctx, s, user, dir, episodes[i].Post, episodes[i].FeedName)
+		if ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gator:", err)
+			errs = append(errs, err)
+			continue
+		}
+		downloaded++
+	}
+	if downloaded == 0 && len(errs) == 0 {
+		fmt.Println("no new episodes to download")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("could not download %d of %d episodes: %w", len(errs), len(errs)+downloaded, errors.Join(errs...))
+	}
+	return nil
+}
+
+func downloadDir(s *state) (string, error) {
+	//func that returns the directory episodes are downloaded to, from the config or ~/Podcasts
+	dir := s.config.DownloadDir
+	home, err := os.UserHomeDir()
+	if err != nil && (dir == "" || strings.HasPrefix(dir, "~")) {
+		return "", fmt.Errorf("could not find home directory: %w", err)
+	}
+	switch {
+	case dir == "":
+		dir = filepath.Join(home, "Podcasts")
+	case dir == "~":
+		dir = home
+	case strings.HasPrefix(dir, "~/"):
+		dir = filepath.Join(home, dir[2:])
+	}
+	return dir, nil
+}
+
+func downloadEpisode(ctx context.Context, s *state, user database.User, dir string, post database.Post, feedName string) error {
+	//func that downloads the enclosure of one post, unless it has already been downloaded,
+	//and keeps a record of the download
+	if post.EnclosureUrl == "" {
+		return notFoundError("post %d has no enclosure to download", post.ShortID)
+	}
+
+	filePath := episodePath(dir, feedName, post)
+	record, err := s.db.GetDownload(ctx, database.GetDownloadParams{UserID: user.ID, PostID: post.ID})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return dbError(err, "could not check downloads")
+	default:
+		if _, statErr := os.Stat(record.Path); statErr == nil && record.CompletedAt.Valid {
+			fmt.Printf("already downloaded %s to %s\n", post.Title, record.Path)
+			return nil
+		}
+		//pick up the partial file of an earlier download
+		if !record.CompletedAt.Valid {
+			filePath = record.Path
+		}
+	}
+
+	err = s.db.StartDownload(ctx, database.StartDownloadParams{
+		ID:     uuid.New(),
+		UserID: user.ID,
+		PostID: post.ID,
+		Path:   filePath,
+	})
+	if err != nil {
+		return dbError(err, "could not record download")
+	}
+
+	fmt.Printf("downloading %s\n", post.Title)
+	size, err := fetchEnclosure(ctx, s, post.EnclosureUrl, filePath)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.CompleteDownload(ctx, database.CompleteDownloadParams{UserID: user.ID, PostID: post.ID, Bytes: size})
+	if err != nil {
+		return dbError(err, "could not record download")
+	}
+	fmt.Printf("downloaded %s to %s (%s)\n", post.Title, filePath, formatBytes(size))
+	return nil
+}
+
+func fetchEnclosure(ctx context.Context, s *state, enclosureURL, filePath string) (int64, error) {
+	//func that downloads a url to filePath, returning its size
+	//the data goes to filePath.part first, and a download that was cut off is resumed with a range request
+	err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err != nil {
+		return 0, fmt.Errorf("could not create download directory: %w", err)
+	}
+	partPath := filePath + ".part"
+	offset := int64(0)
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	fetcher := s.fetcher.Load()
+	request, err := http.NewRequestWithContext(ctx, "GET", enclosureURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not create request: %w", err)
+	}
+	request.Header.Set("User-Agent", fetcher.userAgent)
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	release, err := fetcher.limiter.acquire(ctx, strings.ToLower(request.URL.Host))
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	//the feed client does not follow redirects and times out whole requests, neither of which suits big files
+	client := &http.Client{Transport: fetcher.client.Transport}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, networkError(err, "could not download %s", enclosureURL)
+	}
+	defer response.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case response.StatusCode == http.StatusPartialContent && contentRangeStart(response) == offset:
+		flags |= os.O_APPEND
+	case response.StatusCode == http.StatusPartialContent:
+		//not the range that was asked for, so the partial file can't be trusted
+		os.Remove(partPath)
+		return 0, networkError(fmt.Errorf("unexpected Content-Range %q", response.Header.Get("Content-Range")),
+			"could not resume %s, run the command again to start over", enclosureURL)
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		//the partial file already has every byte
+		if err := os.Rename(partPath, filePath); err != nil {
+			return 0, fmt.Errorf("could not save download: %w", err)
+		}
+		return offset, nil
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		//the server sent the whole file, so start over
+		flags |= os.O_TRUNC
+		offset = 0
+	default:
+		return 0, networkError(&fetchStatusError{URL: enclosureURL, StatusCode: response.StatusCode, Status: response.Status}, "could not download %s", enclosureURL)
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("could not open download file: %w", err)
+	}
+	written, err := io.Copy(file, response.Body)
+	closeErr := file.Close()
+	if err != nil {
+		return 0, networkError(err, "download of %s was cut off after %s, run the command again to resume", enclosureURL, formatBytes(offset+written))
+	}
+	if closeErr != nil {
+		return 0, fmt.Errorf("could not write download file: %w", closeErr)
+	}
+	if err := os.Rename(partPath, filePath); err != nil {
+		return 0, fmt.Errorf("could not save download: %w", err)
+	}
+	return offset + written, nil
+}
+
+func contentRangeStart(response *http.Response) int64 {
+	//func that returns the first byte of a 206 response from its Content-Range header, e.g. "bytes 100-199/200"
+	contentRange := strings.TrimPrefix(response.Header.Get("Content-Range"), "bytes ")
+	start, _, ok := strings.Cut(contentRange, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func episodePath(dir, feedName string, post database.Post) string {
+	//func that returns where an episode is saved: a folder per feed and a file named after the date and title
+	name := post.PublishedAt.Format("2006-01-02") + " " + safeFileName(post.Title)
+	return filepath.Join(dir, safeFileName(feedName), name+enclosureExtension(post))
+}
+
+func enclosureExtension(post database.Post) string {
+	//func that picks the file extension of an enclosure from its url, falling back to its mime type
+	if parsed, err := url.Parse(post.EnclosureUrl); err == nil {
+		ext := path.Ext(parsed.Path)
+		if len(ext) > 1 && len(ext) <= 6 && strings.IndexFunc(ext[1:], func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) < 0 {
+			return strings.ToLower(ext)
+		}
+	}
+	if exts, err := mime.ExtensionsByType(post.EnclosureType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+func safeFileName(name string) string {
+	//func that turns a title into something safe to use as a file or folder name
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, singleLine(name))
+	if runes := []rune(name); len(runes) > maxFileNameLength {
+		name = string(runes[:maxFileNameLength])
+	}
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "untitled"
+	}
+	return name
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+type errorKind int
+
+const (
+	kindNotFound errorKind = iota + 1
+	kindAlreadyExists
+	kindNetwork
+	kindDatabase
+	kindAuth
+)
+
+const (
+	//exit codes gator returns, so scripts can tell failures apart
+	exitOK            = 0
+	exitError         = 1
+	exitUsage         = 2
+	exitNotFound      = 3
+	exitAlreadyExists = 4
+	exitNetwork       = 5
+	exitDatabase      = 6
+	exitAuth          = 7
+)
+
+type cliError struct {
+	//error returned by handlers for failures that scripts may want to tell apart
+	kind errorKind
+	msg  string
+	err  error
+}
+
+func (e *cliError) Error() string {
+	if e.err == nil {
+		return e.msg
+	}
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e *cliError) Unwrap() error {
+	return e.err
+}
+
+func notFoundError(format string, args ...any) error {
+	return &cliError{kind: kindNotFound, msg: fmt.Sprintf(format, args...)}
+}
+
+func alreadyExistsError(format string, args ...any) error {
+	return &cliError{kind: kindAlreadyExists, msg: fmt.Sprintf(format, args...)}
+}
+
+func authError(format string, args ...any) error {
+	return &cliError{kind: kindAuth, msg: fmt.Sprintf(format, args...)}
+}
+
+func networkError(err error, format string, args ...any) error {
+	return &cliError{kind: kindNetwork, msg: fmt.Sprintf(format, args...), err: err}
+}
+
+func dbError(err error, format string, args ...any) error {
+	//func that wraps an error from a query, turning missing rows and unique violations into their own kinds
+	msg := fmt.Sprintf(format, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &cliError{kind: kindNotFound, msg: msg + ": not found"}
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return &cliError{kind: kindAlreadyExists, msg: msg + ": already exists"}
+	}
+	return &cliError{kind: kindDatabase, msg: msg, err: err}
+}
+
+func exitCode(err error) int {
+	//func that maps an error returned by a command to the exit code of the process
+	if err == nil {
+		return exitOK
+	}
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		return exitUsage
+	}
+	var cliErr *cliError
+	if errors.As(err, &cliErr) {
+		switch cliErr.kind {
+		case kindNotFound:
+			return exitNotFound
+		case kindAlreadyExists:
+			return exitAlreadyExists
+		case kindNetwork:
+			return exitNetwork
+		case kindDatabase:
+			return exitDatabase
+		case kindAuth:
+			return exitAuth
+		}
+	}
+	return exitError
+}
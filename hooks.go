@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"internal/config"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/gator/internal/database"
+)
+
+const (
+	defaultPostHookTimeout     = 30 * time.Second
+	defaultPostHookConcurrency = 4
+	//how much of a hook's output is kept for the log
+	postHookMaxOutput = 4 << 10
+)
+
+type postHooks struct {
+	//the post hooks from the config, and the slots that limit how many run at once
+	hooks []postHook
+	slots chan struct{}
+}
+
+type postHook struct {
+	//a post hook from the config, with its timeout parsed and its feeds turned into url keys
+	command  []string
+	feedKeys map[string]bool
+	batch    bool
+	timeout  time.Duration
+}
+
+type hookPost struct {
+	//a new post as it is given to hooks on stdin
+	ID          uuid.UUID      `json:"id"`
+	ShortID     int64          `json:"short_id"`
+	Title       string         `json:"title"`
+	URL         string         `json:"url"`
+	Summary     string         `json:"summary"`
+	Description string         `json:"description"`
+	Content     string         `json:"content,omitempty"`
+	Author      string         `json:"author,omitempty"`
+	Categories  []string       `json:"categories,omitempty"`
+	GUID        string         `json:"guid,omitempty"`
+	CommentsURL string         `json:"comments_url,omitempty"`
+	Enclosure   *hookEnclosure `json:"enclosure,omitempty"`
+	PublishedAt time.Time      `json:"published_at"`
+	Feed        webhookFeed    `json:"feed"`
+}
+
+type hookEnclosure struct {
+	URL    string `json:"url"`
+	Type   string `json:"type,omitempty"`
+	Length int64  `json:"length,omitempty"`
+}
+
+func newPostHooks(cfg *config.Config) (*postHooks, error) {
+	//func that reads the post hooks from the config, checking their commands, feeds and timeouts
+	concurrency := cfg.PostHookConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultPostHookConcurrency
+	}
+	hooks := &postHooks{slots: make(chan struct{}, concurrency)}
+	for i, hook := range cfg.PostHooks {
+		if len(hook.Command) == 0 || strings.TrimSpace(hook.Command[0]) == "" {
+			return nil, fmt.Errorf("post hook %d has no command", i+1)
+		}
+		timeout, err := configDuration(hook.Timeout, defaultPostHookTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("post hook %d has an invalid timeout: %w", i+1, err)
+		}
+		feedKeys := make(map[string]bool)
+		for _, feedURL := range hook.Feeds {
+			key, err := feedURLKey(feedURL)
+			if err != nil {
+				return nil, fmt.Errorf("post hook %d has an invalid feed url %q: %w", i+1, feedURL, err)
+			}
+			feedKeys[key] = true
+		}
+		hooks.hooks = append(hooks.hooks, postHook{command: hook.Command, feedKeys: feedKeys, batch: hook.Batch, timeout: timeout})
+	}
+	return hooks, nil
+}
+
+func runPostHooks(ctx context.Context, s *state, feed database.Feed, posts []hookPost, log *slog.Logger) {
+	//func that runs every post hook that wants the new posts of a feed, and waits for them to finish
+	//per post hooks get one post as a json object, batch hooks get them all as a json array
+	hooks := s.hooks.Load()
+	if hooks == nil || len(posts) == 0 {
+		return
+	}
+	feedEnv := []string{"GATOR_FEED_ID=" + feed.ID.String(), "GATOR_FEED_NAME=" + feed.Name, "GATOR_FEED_URL=" + feed.Url}
+
+	var wg sync.WaitGroup
+	for _, hook := range hooks.hooks {
+		if len(hook.feedKeys) > 0 && !hook.feedKeys[feed.UrlKey] {
+			continue
+		}
+		if hook.batch {
+			env := append([]string{"GATOR_EVENT=posts.created", "GATOR_POST_COUNT=" + strconv.Itoa(len(posts))}, feedEnv...)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				hooks.run(ctx, hook, posts, env, log)
+			}()
+			continue
+		}
+		for _, post := range posts {
+			env := append([]string{"GATOR_EVENT=post.created",
+				"GATOR_POST_ID=" + post.ID.String(),
+				"GATOR_POST_SHORT_ID=" + strconv.FormatInt(post.ShortID, 10),
+				"GATOR_POST_TITLE=" + singleLine(post.Title),
+				"GATOR_POST_URL=" + post.URL,
+			}, feedEnv...)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				hooks.run(ctx, hook, post, env, log)
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func (h *postHooks) run(ctx context.Context, hook postHook, payload any, env []string, log *slog.Logger) {
+	//func that runs a hook command once it gets a slot, with payload as json on stdin
+	//a hook that runs past its timeout is killed, and its output is logged when it fails
+	stdin, err := json.Marshal(payload)
+	if err != nil {
+		log.Error("could not encode post hook input", "err", err)
+		return
+	}
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	defer func() { <-h.slots }()
+
+	ctx, cancel := context.WithTimeout(ctx, hook.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, hook.command[0], hook.command[1:]...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Env = append(os.Environ(), env...)
+	output := &limitedBuffer{limit: postHookMaxOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	//don't wait forever on a child process that keeps the output open after the hook is killed
+	cmd.WaitDelay = 5 * time.Second
+
+	log = log.With("hook", strings.Join(hook.command, " "))
+	started := time.Now()
+	err = cmd.Run()
+	duration := time.Since(started)
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		log.Warn("post hook timed out", "timeout", hook.timeout, "output", output.String())
+	case err != nil:
+		log.Warn("post hook failed", "duration", duration, "err", err, "output", output.String())
+	default:
+		log.Debug("post hook ran", "duration", duration, "output", output.String())
+	}
+}
+
+type limitedBuffer struct {
+	//writer that keeps the first limit bytes written to it and drops the rest
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return strings.TrimSpace(b.buf.String())
+}
+
+func newHookPost(post database.UpsertPostRow, params database.UpsertPostParams, categories []string, feed database.Feed) hookPost {
+	//func that builds what hooks are given for a post agg has just stored
+	p := hookPost{ID: post.ID,
+		ShortID:     post.ShortID,
+		Title:       params.Title,
+		URL:         params.Url,
+		Summary:     params.Summary,
+		Description: params.Description,
+		Content:     params.Content,
+		Author:      params.Author,
+		GUID:        params.Guid,
+		CommentsURL: params.CommentsUrl,
+		PublishedAt: params.PublishedAt,
+		Feed:        webhookFeed{ID: feed.ID, Name: feed.Name, URL: feed.Url},
+	}
+	for _, category := range categories {
+		if category = strings.TrimSpace(category); category != "" {
+			p.Categories = append(p.Categories, category)
+		}
+	}
+	if params.EnclosureUrl != "" {
+		p.Enclosure = &hookEnclosure{URL: params.EnclosureUrl, Type: params.EnclosureType, Length: params.EnclosureLength}
+	}
+	return p
+}
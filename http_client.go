@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"internal/config"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	defaultConnectTimeout = 10 * time.Second
+	defaultReadTimeout    = 30 * time.Second
+	defaultMaxBodyBytes   = 10 << 20
+	maxRedirects          = 10
+)
+
+type feedFetcher struct {
+	//struct that holds the http client and limits used to fetch feeds
+	client       *http.Client
+	maxBodyBytes int64
+	userAgent    string
+	limiter      *hostLimiter
+	//nil unless robots.txt checks are turned on in the config
+	robots *robotsCache
+}
+
+type fetchStatusError struct {
+	//error returned when a feed responds with a non-2xx status code
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *fetchStatusError) Error() string {
+	return fmt.Sprintf("unexpected status fetching %s: %s", e.URL, e.Status)
+}
+
+var errBodyTooLarge = errors.New("response body is too large")
+
+func newFeedFetcher(cfg *config.Config) (*feedFetcher, error) {
+	//func that builds the feed fetcher from the config, using defaults for unset values
+	connectTimeout, err := configDuration(cfg.FetchConnectTimeout, defaultConnectTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fetch_connect_timeout: %w", err)
+	}
+	readTimeout, err := configDuration(cfg.FetchReadTimeout, defaultReadTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fetch_read_timeout: %w", err)
+	}
+	maxBodyBytes := cfg.FetchMaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultMaxBodyBytes
+	}
+	hostInterval, err := configDuration(cfg.FetchHostInterval, defaultHostInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fetch_host_interval: %w", err)
+	}
+	hostConcurrency := cfg.FetchHostConcurrency
+	if hostConcurrency <= 0 {
+		hostConcurrency = defaultHostConcurrency
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: connectTimeout}).DialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: readTimeout,
+		//encodings are requested and decoded by hand so deflate and brotli work too
+		DisableCompression: true,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		//the whole request, including reading the body, has to finish in this time
+		Timeout: connectTimeout + readTimeout,
+		//redirects are followed by fetchFeed so it can tell permanent ones apart
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	fetcher := &feedFetcher{client: client,
+		maxBodyBytes: maxBodyBytes,
+		userAgent:    buildUserAgent(cfg.FetchUserAgent, cfg.FetchContact),
+		limiter:      newHostLimiter(hostInterval, hostConcurrency),
+	}
+	if cfg.FetchRespectRobots {
+		fetcher.robots = newRobotsCache()
+	}
+	return fetcher, nil
+}
+
+func configDuration(value string, fallback time.Duration) (time.Duration, error) {
+	//func that parses a duration from the config, returning fallback when it is empty
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive: %s", value)
+	}
+	return d, nil
+}
+
+func readBody(response *http.Response, maxBytes int64) ([]byte, error) {
+	//func that decodes and reads a response body, failing if it is larger than maxBytes
+	body, err := decodeBody(response.Body, response.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not read response body: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", errBodyTooLarge, maxBytes)
+	}
+	return data, nil
+}
+
+func decodeBody(body io.Reader, contentEncoding string) (io.Reader, error) {
+	//func that undoes the content encodings of a response body
+	//encodings are listed in the order they were applied, so they are removed in reverse
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch strings.ToLower(strings.TrimSpace(encodings[i])) {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			r, err := gzip.NewReader(body)
+			if err != nil {
+				return nil, fmt.Errorf("could not decode gzip body: %w", err)
+			}
+			body = r
+		case "deflate":
+			//deflate should be zlib wrapped, but some servers send raw deflate data
+			buffered := bufio.NewReader(body)
+			header, err := buffered.Peek(2)
+			if err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+				r, err := zlib.NewReader(buffered)
+				if err != nil {
+					return nil, fmt.Errorf("could not decode deflate body: %w", err)
+				}
+				body = r
+			} else {
+				body = flate.NewReader(buffered)
+			}
+		case "br":
+			body = brotli.NewReader(body)
+		default:
+			return nil, fmt.Errorf("unsupported content encoding: %s", encodings[i])
+		}
+	}
+	return body, nil
+}
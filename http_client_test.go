@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func encodeBody(t *testing.T, encoding string, data []byte) []byte {
+	//func that compresses data with one content encoding, for decodeBody to undo
+	t.Helper()
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "zlib":
+		w = zlib.NewWriter(&b)
+	case "raw deflate":
+		fw, err := flate.NewWriter(&b, flate.DefaultCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = fw
+	case "br":
+		w = brotli.NewWriter(&b)
+	default:
+		t.Fatalf("unknown encoding %s", encoding)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	feed := []byte(`<?xml version="1.0"?><rss><channel><title>test</title></channel></rss>`)
+	tests := []struct {
+		name            string
+		body            []byte
+		contentEncoding string
+		wantErr         bool
+	}{
+		{name: "none", body: feed, contentEncoding: ""},
+		{name: "identity", body: feed, contentEncoding: "identity"},
+		{name: "gzip", body: encodeBody(t, "gzip", feed), contentEncoding: "gzip"},
+		{name: "x-gzip", body: encodeBody(t, "gzip", feed), contentEncoding: "X-Gzip"},
+		{name: "zlib deflate", body: encodeBody(t, "zlib", feed), contentEncoding: "deflate"},
+		{name: "raw deflate", body: encodeBody(t, "raw deflate", feed), contentEncoding: "deflate"},
+		{name: "brotli", body: encodeBody(t, "br", feed), contentEncoding: "br"},
+		{name: "gzip then brotli", body: encodeBody(t, "br", encodeBody(t, "gzip", feed)), contentEncoding: "gzip, br"},
+		{name: "unknown", body: feed, contentEncoding: "compress", wantErr: true},
+		{name: "bad gzip", body: feed, contentEncoding: "gzip", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := decodeBody(bytes.NewReader(tt.body), tt.contentEncoding)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, feed) {
+				t.Errorf("decoded body = %q, want %q", got, feed)
+			}
+		})
+	}
+}
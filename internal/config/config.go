@@ -9,8 +9,58 @@ import (
 
 type Config struct {
 	//struct that represents the JSON file structure
-	DbUrl    string `json:"db_url"`
-	UserName string `json:"current_user_name"`
+	DbUrl string `json:"db_url"`
+	//token of the session login started, which says who the current user is
+	SessionToken string `json:"session_token,omitempty"`
+	//optional settings for fetching feeds
+	//timeouts are durations such as "10s", the body size is in bytes
+	FetchConnectTimeout string `json:"fetch_connect_timeout,omitempty"`
+	FetchReadTimeout    string `json:"fetch_read_timeout,omitempty"`
+	FetchMaxBodyBytes   int64  `json:"fetch_max_body_bytes,omitempty"`
+	//optional settings to keep gator polite to the sites it fetches from
+	FetchUserAgent       string `json:"fetch_user_agent,omitempty"`
+	FetchContact         string `json:"fetch_contact,omitempty"`
+	FetchHostInterval    string `json:"fetch_host_interval,omitempty"`
+	FetchHostConcurrency int    `json:"fetch_host_concurrency,omitempty"`
+	FetchRespectRobots   bool   `json:"fetch_respect_robots,omitempty"`
+	//optional path of the pid file that keeps two aggregators from running at once
+	AggPidFile string `json:"agg_pid_file,omitempty"`
+	//optional logging settings, the format is "text" or "json" and the level is debug, info, warn or error
+	LogFormat string `json:"log_format,omitempty"`
+	LogLevel  string `json:"log_level,omitempty"`
+	LogFile   string `json:"log_file,omitempty"`
+	//optional address such as ":9090" for agg to serve prometheus metrics on,
+	//and how long after its last fetch a feed counts as overdue
+	MetricsAddr         string `json:"metrics_addr,omitempty"`
+	MetricsOverdueAfter string `json:"metrics_overdue_after,omitempty"`
+	//optional directory podcast episodes are downloaded to, ~/Podcasts by default
+	DownloadDir string `json:"download_dir,omitempty"`
+	//optional smtp server digests are sent through, security is "starttls" (the default), "tls" or "none",
+	//and agg sends the digests that are due as it runs when agg_send_digests is set
+	SMTPHost       string `json:"smtp_host,omitempty"`
+	SMTPPort       int    `json:"smtp_port,omitempty"`
+	SMTPUsername   string `json:"smtp_username,omitempty"`
+	SMTPPassword   string `json:"smtp_password,omitempty"`
+	SMTPFrom       string `json:"smtp_from,omitempty"`
+	SMTPSecurity   string `json:"smtp_security,omitempty"`
+	AggSendDigests bool   `json:"agg_send_digests,omitempty"`
+	//optional commands agg runs for new posts, and how many of them may run at once
+	PostHooks           []PostHook `json:"post_hooks,omitempty"`
+	PostHookConcurrency int        `json:"post_hook_concurrency,omitempty"`
+	//optional address such as ":8080" for agg to take websub pushes on, and the public url hubs reach it at
+	WebSubAddr        string `json:"websub_addr,omitempty"`
+	WebSubCallbackURL string `json:"websub_callback_url,omitempty"`
+}
+
+type PostHook struct {
+	//a command agg runs for new posts, given as the program and its args
+	//it runs once per post with the post as json on stdin, or with batch once per fetch of a feed
+	//with all of its new posts as a json array; feeds limits it to posts from those feed urls,
+	//and timeout is a duration such as "30s"
+	Command []string `json:"command"`
+	Feeds   []string `json:"feeds,omitempty"`
+	Batch   bool     `json:"batch,omitempty"`
+	Timeout string   `json:"timeout,omitempty"`
 }
 
 func Read() (Config, error) {
@@ -40,9 +90,9 @@ func Read() (Config, error) {
 	return cfg, nil
 }
 
-func (c Config) SetUser(name string) error {
-	//func that sets the current user name
-	c.UserName = name
+func (c Config) SetSession(token string) error {
+	//func that sets the session token of the current user, or logs out with an empty token
+	c.SessionToken = token
 	err := write(c)
 	if err != nil {
 		return fmt.Errorf("could not write config: %w", err)
@@ -66,11 +116,15 @@ func write(cfg Config) error {
 		return fmt.Errorf("could not get config file path: %w", err)
 	}
 
-	configFile, err := os.Create(configFilePath)
+	//the config holds the session token and smtp password, so only the owner may read it
+	configFile, err := os.OpenFile(configFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
 	if err != nil {
 		return fmt.Errorf("could not create config file: %w", err)
 	}
 	defer configFile.Close()
+	if err := configFile.Chmod(0o600); err != nil {
+		return fmt.Errorf("could not set config file permissions: %w", err)
+	}
 
 	jsonData, err := json.Marshal(cfg)
 	if err != nil {
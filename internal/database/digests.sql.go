@@ -0,0 +1,194 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: digests.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const getDigestPosts = `-- name: GetDigestPosts :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.short_id, posts.summary, posts.content, posts.author, posts.guid, posts.comments_url, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length, posts.canonical_url, posts.story_id, posts.full_content, posts.full_content_fetched_at, posts.plain_text, feeds.name AS feed_name
+FROM posts
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = $1
+INNER JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = $1
+WHERE post_states.read_at IS NULL
+AND posts.created_at >= $3
+AND NOT EXISTS (
+    SELECT 1 FROM digest_posts
+    WHERE digest_posts.user_id = $1 AND digest_posts.post_id = posts.id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.user_id = $1 AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'mute'
+)
+AND NOT EXISTS (
+    SELECT 1 FROM posts earlier
+    INNER JOIN feed_follows earlier_follows ON earlier_follows.feed_id = earlier.feed_id AND earlier_follows.user_id = $1
+    WHERE COALESCE(earlier.story_id, earlier.id) = COALESCE(posts.story_id, posts.id)
+    AND (earlier.published_at, earlier.id) < (posts.published_at, posts.id)
+)
+ORDER BY feeds.name, posts.published_at DESC
+LIMIT $2
+`
+
+type GetDigestPostsParams struct {
+	UserID uuid.UUID
+	Limit  int32
+	Since  time.Time
+}
+
+type GetDigestPostsRow struct {
+	Post     Post
+	FeedName string
+}
+
+// a story that came in from several followed feeds is sent once, as its first post
+func (q *Queries) GetDigestPosts(ctx context.Context, arg GetDigestPostsParams) ([]GetDigestPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDigestPosts, arg.UserID, arg.Limit, arg.Since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDigestPostsRow
+	for rows.Next() {
+		var i GetDigestPostsRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.ShortID,
+			&i.Post.Summary,
+			&i.Post.Content,
+			&i.Post.Author,
+			&i.Post.Guid,
+			&i.Post.CommentsUrl,
+			&i.Post.EnclosureUrl,
+			&i.Post.EnclosureType,
+			&i.Post.EnclosureLength,
+			&i.Post.CanonicalUrl,
+			&i.Post.StoryID,
+			&i.Post.FullContent,
+			&i.Post.FullContentFetchedAt,
+			&i.Post.PlainText,
+			&i.FeedName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersDueDigest = `-- name: GetUsersDueDigest :many
+SELECT id, created_at, updated_at, name, email, digest_frequency, last_digest_at, password_hash, is_admin FROM users
+WHERE email <> '' AND digest_frequency <> 'off'
+AND (last_digest_at IS NULL OR last_digest_at <= NOW() - CASE digest_frequency
+    WHEN 'daily' THEN INTERVAL '23 hours'
+    ELSE INTERVAL '167 hours'
+END)
+ORDER BY name
+`
+
+// a little under a day or a week, so a digest does not slip later each time agg runs a bit late
+func (q *Queries) GetUsersDueDigest(ctx context.Context) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersDueDigest)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Email,
+			&i.DigestFrequency,
+			&i.LastDigestAt,
+			&i.PasswordHash,
+			&i.IsAdmin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordDigestSent = `-- name: RecordDigestSent :exec
+WITH sent AS (
+    INSERT INTO digest_posts (user_id, post_id)
+    SELECT $1::uuid, unnest($2::uuid[])
+    ON CONFLICT DO NOTHING
+)
+UPDATE users SET last_digest_at = NOW() WHERE id = $1::uuid
+`
+
+type RecordDigestSentParams struct {
+	UserID  uuid.UUID
+	PostIds []uuid.UUID
+}
+
+func (q *Queries) RecordDigestSent(ctx context.Context, arg RecordDigestSentParams) error {
+	_, err := q.db.ExecContext(ctx, recordDigestSent, arg.UserID, pq.Array(arg.PostIds))
+	return err
+}
+
+const setUserDigestSettings = `-- name: SetUserDigestSettings :one
+UPDATE users SET
+    email = $2,
+    digest_frequency = $3,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, email, digest_frequency, last_digest_at, password_hash, is_admin
+`
+
+type SetUserDigestSettingsParams struct {
+	ID              uuid.UUID
+	Email           string
+	DigestFrequency string
+}
+
+func (q *Queries) SetUserDigestSettings(ctx context.Context, arg SetUserDigestSettingsParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserDigestSettings, arg.ID, arg.Email, arg.DigestFrequency)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Email,
+		&i.DigestFrequency,
+		&i.LastDigestAt,
+		&i.PasswordHash,
+		&i.IsAdmin,
+	)
+	return i, err
+}
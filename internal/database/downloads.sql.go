@@ -0,0 +1,86 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: downloads.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const completeDownload = `-- name: CompleteDownload :exec
+UPDATE downloads SET bytes = $3, completed_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND post_id = $2
+`
+
+type CompleteDownloadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	Bytes  int64
+}
+
+func (q *Queries) CompleteDownload(ctx context.Context, arg CompleteDownloadParams) error {
+	_, err := q.db.ExecContext(ctx, completeDownload, arg.UserID, arg.PostID, arg.Bytes)
+	return err
+}
+
+const getDownload = `-- name: GetDownload :one
+SELECT id, created_at, updated_at, user_id, post_id, path, bytes, completed_at FROM downloads WHERE user_id = $1 AND post_id = $2
+`
+
+type GetDownloadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) GetDownload(ctx context.Context, arg GetDownloadParams) (Download, error) {
+	row := q.db.QueryRowContext(ctx, getDownload, arg.UserID, arg.PostID)
+	var i Download
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.PostID,
+		&i.Path,
+		&i.Bytes,
+		&i.CompletedAt,
+	)
+	return i, err
+}
+
+const startDownload = `-- name: StartDownload :exec
+INSERT INTO downloads (id, created_at, updated_at, user_id, post_id, path)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (user_id, post_id) DO UPDATE SET
+    path = EXCLUDED.path,
+    completed_at = NULL,
+    updated_at = NOW()
+`
+
+type StartDownloadParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	PostID uuid.UUID
+	Path   string
+}
+
+func (q *Queries) StartDownload(ctx context.Context, arg StartDownloadParams) error {
+	_, err := q.db.ExecContext(ctx, startDownload,
+		arg.ID,
+		arg.UserID,
+		arg.PostID,
+		arg.Path,
+	)
+	return err
+}
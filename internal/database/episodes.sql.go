@@ -0,0 +1,148 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: episodes.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const getEpisodeForPost = `-- name: GetEpisodeForPost :one
+SELECT id, created_at, updated_at, post_id, duration_seconds, episode, season, image_url, explicit FROM episodes WHERE post_id = $1
+`
+
+func (q *Queries) GetEpisodeForPost(ctx context.Context, postID uuid.UUID) (Episode, error) {
+	row := q.db.QueryRowContext(ctx, getEpisodeForPost, postID)
+	var i Episode
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PostID,
+		&i.DurationSeconds,
+		&i.Episode,
+		&i.Season,
+		&i.ImageUrl,
+		&i.Explicit,
+	)
+	return i, err
+}
+
+const getFeedEpisodes = `-- name: GetFeedEpisodes :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.short_id, posts.summary, posts.content, posts.author, posts.guid, posts.comments_url, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length, posts.canonical_url, posts.story_id, posts.full_content, posts.full_content_fetched_at, posts.plain_text, feeds.name AS feed_name,
+    (downloads.completed_at IS NOT NULL)::boolean AS downloaded
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN downloads ON downloads.post_id = posts.id AND downloads.user_id = $1
+WHERE posts.feed_id = $2 AND posts.enclosure_url <> ''
+ORDER BY posts.published_at DESC
+`
+
+type GetFeedEpisodesParams struct {
+	UserID uuid.UUID
+	FeedID uuid.UUID
+}
+
+type GetFeedEpisodesRow struct {
+	Post       Post
+	FeedName   string
+	Downloaded bool
+}
+
+func (q *Queries) GetFeedEpisodes(ctx context.Context, arg GetFeedEpisodesParams) ([]GetFeedEpisodesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedEpisodes, arg.UserID, arg.FeedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFeedEpisodesRow
+	for rows.Next() {
+		var i GetFeedEpisodesRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.ShortID,
+			&i.Post.Summary,
+			&i.Post.Content,
+			&i.Post.Author,
+			&i.Post.Guid,
+			&i.Post.CommentsUrl,
+			&i.Post.EnclosureUrl,
+			&i.Post.EnclosureType,
+			&i.Post.EnclosureLength,
+			&i.Post.CanonicalUrl,
+			&i.Post.StoryID,
+			&i.Post.FullContent,
+			&i.Post.FullContentFetchedAt,
+			&i.Post.PlainText,
+			&i.FeedName,
+			&i.Downloaded,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertEpisode = `-- name: UpsertEpisode :exec
+INSERT INTO episodes (id, created_at, updated_at, post_id, duration_seconds, episode, season, image_url, explicit)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+ON CONFLICT (post_id) DO UPDATE SET
+    duration_seconds = EXCLUDED.duration_seconds,
+    episode = EXCLUDED.episode,
+    season = EXCLUDED.season,
+    image_url = EXCLUDED.image_url,
+    explicit = EXCLUDED.explicit,
+    updated_at = NOW()
+`
+
+type UpsertEpisodeParams struct {
+	ID              uuid.UUID
+	PostID          uuid.UUID
+	DurationSeconds sql.NullInt32
+	Episode         sql.NullInt32
+	Season          sql.NullInt32
+	ImageUrl        string
+	Explicit        sql.NullBool
+}
+
+func (q *Queries) UpsertEpisode(ctx context.Context, arg UpsertEpisodeParams) error {
+	_, err := q.db.ExecContext(ctx, upsertEpisode,
+		arg.ID,
+		arg.PostID,
+		arg.DurationSeconds,
+		arg.Episode,
+		arg.Season,
+		arg.ImageUrl,
+		arg.Explicit,
+	)
+	return err
+}
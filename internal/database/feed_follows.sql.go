@@ -87,7 +87,7 @@ func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowPara
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
-SELECT ff.id, ff.created_at, feeds.name AS feed_name, users.name AS user_name
+SELECT ff.id, ff.created_at, ff.feed_id, feeds.name AS feed_name, feeds.url AS feed_url, users.name AS user_name
 FROM feed_follows ff
 INNER JOIN feeds ON ff.feed_id = feeds.id
 INNER JOIN users ON ff.user_id = users.id
@@ -97,7 +97,9 @@ WHERE ff.user_id = $1
 type GetFeedFollowsForUserRow struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
+	FeedID    uuid.UUID
 	FeedName  string
+	FeedUrl   string
 	UserName  string
 }
 
@@ -113,7 +115,9 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
+			&i.FeedID,
 			&i.FeedName,
+			&i.FeedUrl,
 			&i.UserName,
 		); err != nil {
 			return nil, err
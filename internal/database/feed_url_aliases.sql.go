@@ -0,0 +1,46 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: feed_url_aliases.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createFeedUrlAlias = `-- name: CreateFeedUrlAlias :exec
+INSERT INTO feed_url_aliases (id, created_at, url, url_key, feed_id)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+ON CONFLICT (url_key) DO UPDATE SET
+    url = EXCLUDED.url,
+    feed_id = EXCLUDED.feed_id
+`
+
+type CreateFeedUrlAliasParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	Url       string
+	UrlKey    string
+	FeedID    uuid.UUID
+}
+
+func (q *Queries) CreateFeedUrlAlias(ctx context.Context, arg CreateFeedUrlAliasParams) error {
+	_, err := q.db.ExecContext(ctx, createFeedUrlAlias,
+		arg.ID,
+		arg.CreatedAt,
+		arg.Url,
+		arg.UrlKey,
+		arg.FeedID,
+	)
+	return err
+}
@@ -7,31 +7,42 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, description, site_link, language, image_url, url_key)
 VALUES (
     $1,
     $2,
     $3,
     $4,
     $5,
-    $6
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, description, site_link, language, image_url, url_key, last_fetch_status, last_fetch_error, fetch_full_content
 `
 
 type CreateFeedParams struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Name      string
-	Url       string
-	UserID    uuid.UUID
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Name        string
+	Url         string
+	UserID      uuid.UUID
+	Description string
+	SiteLink    string
+	Language    string
+	ImageUrl    string
+	UrlKey      string
 }
 
 func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
@@ -42,6 +53,11 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		arg.Name,
 		arg.Url,
 		arg.UserID,
+		arg.Description,
+		arg.SiteLink,
+		arg.Language,
+		arg.ImageUrl,
+		arg.UrlKey,
 	)
 	var i Feed
 	err := row.Scan(
@@ -52,16 +68,55 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Description,
+		&i.SiteLink,
+		&i.Language,
+		&i.ImageUrl,
+		&i.UrlKey,
+		&i.LastFetchStatus,
+		&i.LastFetchError,
+		&i.FetchFullContent,
+	)
+	return i, err
+}
+
+const getFeedById = `-- name: GetFeedById :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, description, site_link, language, image_url, url_key, last_fetch_status, last_fetch_error, fetch_full_content FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) GetFeedById(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedById, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Description,
+		&i.SiteLink,
+		&i.Language,
+		&i.ImageUrl,
+		&i.UrlKey,
+		&i.LastFetchStatus,
+		&i.LastFetchError,
+		&i.FetchFullContent,
 	)
 	return i, err
 }
 
 const getFeedByUrl = `-- name: GetFeedByUrl :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds WHERE url = $1
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, description, site_link, language, image_url, url_key, last_fetch_status, last_fetch_error, fetch_full_content FROM feeds
+WHERE feeds.url_key = $1
+    OR feeds.id IN (SELECT feed_id FROM feed_url_aliases WHERE feed_url_aliases.url_key = $1)
+LIMIT 1
 `
 
-func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getFeedByUrl, url)
+func (q *Queries) GetFeedByUrl(ctx context.Context, urlKey string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByUrl, urlKey)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -71,16 +126,50 @@ func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Description,
+		&i.SiteLink,
+		&i.Language,
+		&i.ImageUrl,
+		&i.UrlKey,
+		&i.LastFetchStatus,
+		&i.LastFetchError,
+		&i.FetchFullContent,
 	)
 	return i, err
 }
 
+const getFeedFetchLag = `-- name: GetFeedFetchLag :one
+SELECT
+    COUNT(*) FILTER (WHERE last_fetched_at IS NULL OR last_fetched_at < $1::timestamp) AS overdue,
+    COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(COALESCE(last_fetched_at, created_at))), 0)::float8 AS lag_seconds
+FROM feeds
+`
+
+type GetFeedFetchLagRow struct {
+	Overdue    int64
+	LagSeconds float64
+}
+
+func (q *Queries) GetFeedFetchLag(ctx context.Context, overdueBefore time.Time) (GetFeedFetchLagRow, error) {
+	row := q.db.QueryRowContext(ctx, getFeedFetchLag, overdueBefore)
+	var i GetFeedFetchLagRow
+	err := row.Scan(&i.Overdue, &i.LagSeconds)
+	return i, err
+}
+
 const getFeedToFetch = `-- name: GetFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds 
-ORDER BY last_fetched_at ASC NULLS FIRST
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, description, site_link, language, image_url, url_key, last_fetch_status, last_fetch_error, fetch_full_content FROM feeds
+ORDER BY COALESCE(last_fetched_at > NOW() - interval '1 day' AND EXISTS (
+        SELECT 1 FROM websub_subscriptions
+        WHERE websub_subscriptions.feed_id = feeds.id
+            AND websub_subscriptions.status = 'active'
+            AND websub_subscriptions.lease_expires_at > NOW()
+    ), false) ASC,
+    last_fetched_at ASC NULLS FIRST
 LIMIT 1
 `
 
+// feeds a websub hub pushes to are only polled once a day, as a fallback, so the others come first
 func (q *Queries) GetFeedToFetch(ctx context.Context) (Feed, error) {
 	row := q.db.QueryRowContext(ctx, getFeedToFetch)
 	var i Feed
@@ -92,12 +181,20 @@ func (q *Queries) GetFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Description,
+		&i.SiteLink,
+		&i.Language,
+		&i.ImageUrl,
+		&i.UrlKey,
+		&i.LastFetchStatus,
+		&i.LastFetchError,
+		&i.FetchFullContent,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, description, site_link, language, image_url, url_key, last_fetch_status, last_fetch_error, fetch_full_content FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -117,6 +214,14 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Description,
+			&i.SiteLink,
+			&i.Language,
+			&i.ImageUrl,
+			&i.UrlKey,
+			&i.LastFetchStatus,
+			&i.LastFetchError,
+			&i.FetchFullContent,
 		); err != nil {
 			return nil, err
 		}
@@ -151,3 +256,57 @@ func (q *Queries) ResetFeeds(ctx context.Context) error {
 	_, err := q.db.ExecContext(ctx, resetFeeds)
 	return err
 }
+
+const setFeedFetchFullContent = `-- name: SetFeedFetchFullContent :exec
+UPDATE feeds SET
+    fetch_full_content = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type SetFeedFetchFullContentParams struct {
+	ID               uuid.UUID
+	FetchFullContent bool
+}
+
+func (q *Queries) SetFeedFetchFullContent(ctx context.Context, arg SetFeedFetchFullContentParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedFetchFullContent, arg.ID, arg.FetchFullContent)
+	return err
+}
+
+const setFeedFetchResult = `-- name: SetFeedFetchResult :exec
+UPDATE feeds SET
+    last_fetch_status = $2,
+    last_fetch_error = $3
+WHERE id = $1
+`
+
+type SetFeedFetchResultParams struct {
+	ID              uuid.UUID
+	LastFetchStatus sql.NullInt32
+	LastFetchError  string
+}
+
+func (q *Queries) SetFeedFetchResult(ctx context.Context, arg SetFeedFetchResultParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedFetchResult, arg.ID, arg.LastFetchStatus, arg.LastFetchError)
+	return err
+}
+
+const updateFeedUrl = `-- name: UpdateFeedUrl :exec
+UPDATE feeds SET
+    url = $2,
+    url_key = $3,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedUrlParams struct {
+	ID     uuid.UUID
+	Url    string
+	UrlKey string
+}
+
+func (q *Queries) UpdateFeedUrl(ctx context.Context, arg UpdateFeedUrlParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedUrl, arg.ID, arg.Url, arg.UrlKey)
+	return err
+}
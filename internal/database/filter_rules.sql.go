@@ -0,0 +1,191 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: filter_rules.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const applyReadRules = `-- name: ApplyReadRules :exec
+INSERT INTO post_states (id, created_at, updated_at, user_id, post_id, read_at)
+SELECT gen_random_uuid(), NOW(), NOW(), matches.user_id, matches.post_id, NOW()
+FROM (
+    SELECT DISTINCT post_rule_matches.user_id, post_rule_matches.post_id
+    FROM post_rule_matches
+    INNER JOIN posts ON post_rule_matches.post_id = posts.id
+    INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = post_rule_matches.user_id
+    WHERE post_rule_matches.post_id = $1 AND post_rule_matches.action = 'read'
+) matches
+ON CONFLICT (user_id, post_id) DO UPDATE SET
+    read_at = COALESCE(post_states.read_at, EXCLUDED.read_at),
+    updated_at = NOW()
+`
+
+func (q *Queries) ApplyReadRules(ctx context.Context, postID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, applyReadRules, postID)
+	return err
+}
+
+const applyStarRules = `-- name: ApplyStarRules :exec
+INSERT INTO post_states (id, created_at, updated_at, user_id, post_id, starred)
+SELECT gen_random_uuid(), NOW(), NOW(), matches.user_id, matches.post_id, TRUE
+FROM (
+    SELECT DISTINCT post_rule_matches.user_id, post_rule_matches.post_id
+    FROM post_rule_matches
+    INNER JOIN posts ON post_rule_matches.post_id = posts.id
+    INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = post_rule_matches.user_id
+    WHERE post_rule_matches.post_id = $1 AND post_rule_matches.action = 'star'
+) matches
+ON CONFLICT (user_id, post_id) DO UPDATE SET
+    starred = TRUE,
+    updated_at = NOW()
+`
+
+func (q *Queries) ApplyStarRules(ctx context.Context, postID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, applyStarRules, postID)
+	return err
+}
+
+const checkRegex = `-- name: CheckRegex :one
+SELECT ''::text ~* $1::text AS matches
+`
+
+func (q *Queries) CheckRegex(ctx context.Context, pattern string) (interface{}, error) {
+	row := q.db.QueryRowContext(ctx, checkRegex, pattern)
+	var matches interface{}
+	err := row.Scan(&matches)
+	return matches, err
+}
+
+const createFilterRule = `-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, created_at, updated_at, user_id, feed_id, field, pattern, action)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+RETURNING id, created_at, updated_at, short_id, user_id, feed_id, field, pattern, action
+`
+
+type CreateFilterRuleParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	FeedID    uuid.NullUUID
+	Field     string
+	Pattern   string
+	Action    string
+}
+
+func (q *Queries) CreateFilterRule(ctx context.Context, arg CreateFilterRuleParams) (FilterRule, error) {
+	row := q.db.QueryRowContext(ctx, createFilterRule,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.UserID,
+		arg.FeedID,
+		arg.Field,
+		arg.Pattern,
+		arg.Action,
+	)
+	var i FilterRule
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ShortID,
+		&i.UserID,
+		&i.FeedID,
+		&i.Field,
+		&i.Pattern,
+		&i.Action,
+	)
+	return i, err
+}
+
+const deleteFilterRule = `-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules WHERE user_id = $1 AND short_id = $2
+`
+
+type DeleteFilterRuleParams struct {
+	UserID  uuid.UUID
+	ShortID int64
+}
+
+func (q *Queries) DeleteFilterRule(ctx context.Context, arg DeleteFilterRuleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFilterRule, arg.UserID, arg.ShortID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getFilterRulesForUser = `-- name: GetFilterRulesForUser :many
+SELECT filter_rules.id, filter_rules.created_at, filter_rules.updated_at, filter_rules.short_id, filter_rules.user_id, filter_rules.feed_id, filter_rules.field, filter_rules.pattern, filter_rules.action, feeds.name AS feed_name, feeds.url AS feed_url
+FROM filter_rules
+LEFT JOIN feeds ON filter_rules.feed_id = feeds.id
+WHERE filter_rules.user_id = $1
+ORDER BY filter_rules.short_id
+`
+
+type GetFilterRulesForUserRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ShortID   int64
+	UserID    uuid.UUID
+	FeedID    uuid.NullUUID
+	Field     string
+	Pattern   string
+	Action    string
+	FeedName  sql.NullString
+	FeedUrl   sql.NullString
+}
+
+func (q *Queries) GetFilterRulesForUser(ctx context.Context, userID uuid.UUID) ([]GetFilterRulesForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFilterRulesForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFilterRulesForUserRow
+	for rows.Next() {
+		var i GetFilterRulesForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ShortID,
+			&i.UserID,
+			&i.FeedID,
+			&i.Field,
+			&i.Pattern,
+			&i.Action,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
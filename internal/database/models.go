@@ -11,14 +11,51 @@ import (
 	"github.com/google/uuid"
 )
 
+type DigestPost struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	SentAt time.Time
+}
+
+type Download struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	PostID      uuid.UUID
+	Path        string
+	Bytes       int64
+	CompletedAt sql.NullTime
+}
+
+type Episode struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	PostID          uuid.UUID
+	DurationSeconds sql.NullInt32
+	Episode         sql.NullInt32
+	Season          sql.NullInt32
+	ImageUrl        string
+	Explicit        sql.NullBool
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Name             string
+	Url              string
+	UserID           uuid.UUID
+	LastFetchedAt    sql.NullTime
+	Description      string
+	SiteLink         string
+	Language         string
+	ImageUrl         string
+	UrlKey           string
+	LastFetchStatus  sql.NullInt32
+	LastFetchError   string
+	FetchFullContent bool
 }
 
 type FeedFollow struct {
@@ -29,20 +66,137 @@ type FeedFollow struct {
 	FeedID    uuid.UUID
 }
 
+type FeedUrlAlias struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	Url       string
+	UrlKey    string
+	FeedID    uuid.UUID
+}
+
+type FilterRule struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ShortID   int64
+	UserID    uuid.UUID
+	FeedID    uuid.NullUUID
+	Field     string
+	Pattern   string
+	Action    string
+}
+
 type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description string
-	PublishedAt time.Time
-	FeedID      uuid.UUID
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Title                string
+	Url                  string
+	Description          string
+	PublishedAt          time.Time
+	FeedID               uuid.UUID
+	ShortID              int64
+	Summary              string
+	Content              string
+	Author               string
+	Guid                 string
+	CommentsUrl          string
+	EnclosureUrl         string
+	EnclosureType        string
+	EnclosureLength      int64
+	CanonicalUrl         string
+	StoryID              uuid.NullUUID
+	FullContent          string
+	FullContentFetchedAt sql.NullTime
+	PlainText            string
+}
+
+type PostCategory struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	PostID    uuid.UUID
+	Name      string
+}
+
+type PostRuleMatch struct {
+	RuleID uuid.UUID
+	UserID uuid.UUID
+	Action string
+	PostID uuid.UUID
+}
+
+type PostState struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	ReadAt    sql.NullTime
+	Starred   bool
+}
+
+type Session struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	TokenHash  string
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
 }
 
 type User struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Name            string
+	Email           string
+	DigestFrequency string
+	LastDigestAt    sql.NullTime
+	PasswordHash    string
+	IsAdmin         bool
+}
+
+type Webhook struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Name      string
+	ShortID   int64
+	UserID    uuid.UUID
+	Kind      string
+	Url       string
+	Secret    string
+	Room      string
+	Token     string
+	FeedID    uuid.NullUUID
+	RuleID    uuid.NullUUID
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	WebhookID      uuid.UUID
+	PostID         uuid.UUID
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastStatusCode sql.NullInt32
+	LastError      string
+	DeliveredAt    sql.NullTime
+}
+
+type WebsubSubscription struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	FeedID         uuid.UUID
+	HubUrl         string
+	TopicUrl       string
+	Secret         string
+	Status         string
+	RequestedAt    time.Time
+	LeaseSeconds   sql.NullInt32
+	LeaseExpiresAt sql.NullTime
+	LastError      string
+	LastPushAt     sql.NullTime
 }
@@ -0,0 +1,78 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: post_categories.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createPostCategory = `-- name: CreatePostCategory :exec
+INSERT INTO post_categories (id, created_at, post_id, name)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3
+)
+ON CONFLICT (post_id, name) DO NOTHING
+`
+
+type CreatePostCategoryParams struct {
+	ID     uuid.UUID
+	PostID uuid.UUID
+	Name   string
+}
+
+func (q *Queries) CreatePostCategory(ctx context.Context, arg CreatePostCategoryParams) error {
+	_, err := q.db.ExecContext(ctx, createPostCategory, arg.ID, arg.PostID, arg.Name)
+	return err
+}
+
+const deletePostCategories = `-- name: DeletePostCategories :exec
+DELETE FROM post_categories WHERE post_id = $1
+`
+
+func (q *Queries) DeletePostCategories(ctx context.Context, postID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deletePostCategories, postID)
+	return err
+}
+
+const getCategoriesForPosts = `-- name: GetCategoriesForPosts :many
+SELECT post_id, name FROM post_categories
+WHERE post_id = ANY($1::uuid[])
+ORDER BY post_id, name
+`
+
+type GetCategoriesForPostsRow struct {
+	PostID uuid.UUID
+	Name   string
+}
+
+func (q *Queries) GetCategoriesForPosts(ctx context.Context, postIds []uuid.UUID) ([]GetCategoriesForPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getCategoriesForPosts, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCategoriesForPostsRow
+	for rows.Next() {
+		var i GetCategoriesForPostsRow
+		if err := rows.Scan(&i.PostID, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,224 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: post_states.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const getFollowedFeedsWithUnread = `-- name: GetFollowedFeedsWithUnread :many
+SELECT feeds.id, feeds.name, feeds.url,
+    COUNT(posts.id) FILTER (WHERE post_states.read_at IS NULL) AS unread
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+LEFT JOIN posts ON posts.feed_id = feeds.id AND NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.user_id = feed_follows.user_id AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'mute'
+)
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+GROUP BY feeds.id, feeds.name, feeds.url
+ORDER BY feeds.name
+`
+
+type GetFollowedFeedsWithUnreadRow struct {
+	ID     uuid.UUID
+	Name   string
+	Url    string
+	Unread int64
+}
+
+func (q *Queries) GetFollowedFeedsWithUnread(ctx context.Context, userID uuid.UUID) ([]GetFollowedFeedsWithUnreadRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedFeedsWithUnread, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFollowedFeedsWithUnreadRow
+	for rows.Next() {
+		var i GetFollowedFeedsWithUnreadRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Url,
+			&i.Unread,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLastPostUpdate = `-- name: GetLastPostUpdate :one
+SELECT COALESCE(MAX(updated_at), 'epoch'::timestamp)::timestamp AS last_update FROM posts
+`
+
+func (q *Queries) GetLastPostUpdate(ctx context.Context) (time.Time, error) {
+	row := q.db.QueryRowContext(ctx, getLastPostUpdate)
+	var last_update time.Time
+	err := row.Scan(&last_update)
+	return last_update, err
+}
+
+const getReaderPosts = `-- name: GetReaderPosts :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.short_id, posts.summary, posts.content, posts.author, posts.guid, posts.comments_url, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length, posts.canonical_url, posts.story_id, posts.full_content, posts.full_content_fetched_at, posts.plain_text, feeds.name AS feed_name,
+    (post_states.read_at IS NOT NULL)::boolean AS is_read,
+    COALESCE(post_states.starred, FALSE)::boolean AS starred,
+    EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.user_id = $1 AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'highlight'
+    ) AS highlighted
+FROM posts
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = $1
+INNER JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = $1
+WHERE ($3::uuid IS NULL OR posts.feed_id = $3::uuid)
+AND NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.user_id = $1 AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'mute'
+)
+ORDER BY posts.published_at DESC
+LIMIT $2
+`
+
+type GetReaderPostsParams struct {
+	UserID uuid.UUID
+	Limit  int32
+	FeedID uuid.NullUUID
+}
+
+type GetReaderPostsRow struct {
+	Post        Post
+	FeedName    string
+	IsRead      bool
+	Starred     bool
+	Highlighted bool
+}
+
+func (q *Queries) GetReaderPosts(ctx context.Context, arg GetReaderPostsParams) ([]GetReaderPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getReaderPosts, arg.UserID, arg.Limit, arg.FeedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetReaderPostsRow
+	for rows.Next() {
+		var i GetReaderPostsRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.ShortID,
+			&i.Post.Summary,
+			&i.Post.Content,
+			&i.Post.Author,
+			&i.Post.Guid,
+			&i.Post.CommentsUrl,
+			&i.Post.EnclosureUrl,
+			&i.Post.EnclosureType,
+			&i.Post.EnclosureLength,
+			&i.Post.CanonicalUrl,
+			&i.Post.StoryID,
+			&i.Post.FullContent,
+			&i.Post.FullContentFetchedAt,
+			&i.Post.PlainText,
+			&i.FeedName,
+			&i.IsRead,
+			&i.Starred,
+			&i.Highlighted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setPostRead = `-- name: SetPostRead :exec
+INSERT INTO post_states (id, created_at, updated_at, user_id, post_id, read_at)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (user_id, post_id) DO UPDATE SET
+    read_at = EXCLUDED.read_at,
+    updated_at = NOW()
+`
+
+type SetPostReadParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt sql.NullTime
+}
+
+func (q *Queries) SetPostRead(ctx context.Context, arg SetPostReadParams) error {
+	_, err := q.db.ExecContext(ctx, setPostRead,
+		arg.ID,
+		arg.UserID,
+		arg.PostID,
+		arg.ReadAt,
+	)
+	return err
+}
+
+const setPostStarred = `-- name: SetPostStarred :exec
+INSERT INTO post_states (id, created_at, updated_at, user_id, post_id, starred)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (user_id, post_id) DO UPDATE SET
+    starred = EXCLUDED.starred,
+    updated_at = NOW()
+`
+
+type SetPostStarredParams struct {
+	ID      uuid.UUID
+	UserID  uuid.UUID
+	PostID  uuid.UUID
+	Starred bool
+}
+
+func (q *Queries) SetPostStarred(ctx context.Context, arg SetPostStarredParams) error {
+	_, err := q.db.ExecContext(ctx, setPostStarred,
+		arg.ID,
+		arg.UserID,
+		arg.PostID,
+		arg.Starred,
+	)
+	return err
+}
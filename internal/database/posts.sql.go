@@ -13,7 +13,7 @@ import (
 )
 
 const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, summary, published_at, feed_id)
 VALUES (
     $1,
     $2,
@@ -22,9 +22,10 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9
 )
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, short_id, summary, content, author, guid, comments_url, enclosure_url, enclosure_type, enclosure_length, canonical_url, story_id, full_content, full_content_fetched_at, plain_text
 `
 
 type CreatePostParams struct {
@@ -34,6 +35,7 @@ type CreatePostParams struct {
 	Title       string
 	Url         string
 	Description string
+	Summary     string
 	PublishedAt time.Time
 	FeedID      uuid.UUID
 }
@@ -46,6 +48,7 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		arg.Title,
 		arg.Url,
 		arg.Description,
+		arg.Summary,
 		arg.PublishedAt,
 		arg.FeedID,
 	)
@@ -59,41 +62,141 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.ShortID,
+		&i.Summary,
+		&i.Content,
+		&i.Author,
+		&i.Guid,
+		&i.CommentsUrl,
+		&i.EnclosureUrl,
+		&i.EnclosureType,
+		&i.EnclosureLength,
+		&i.CanonicalUrl,
+		&i.StoryID,
+		&i.FullContent,
+		&i.FullContentFetchedAt,
+		&i.PlainText,
+	)
+	return i, err
+}
+
+const getPostByShortId = `-- name: GetPostByShortId :one
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.short_id, posts.summary, posts.content, posts.author, posts.guid, posts.comments_url, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length, posts.canonical_url, posts.story_id, posts.full_content, posts.full_content_fetched_at, posts.plain_text, feeds.name AS feed_name
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = $1
+WHERE posts.short_id = $2
+`
+
+type GetPostByShortIdParams struct {
+	UserID  uuid.UUID
+	ShortID int64
+}
+
+type GetPostByShortIdRow struct {
+	Post     Post
+	FeedName string
+}
+
+func (q *Queries) GetPostByShortId(ctx context.Context, arg GetPostByShortIdParams) (GetPostByShortIdRow, error) {
+	row := q.db.QueryRowContext(ctx, getPostByShortId, arg.UserID, arg.ShortID)
+	var i GetPostByShortIdRow
+	err := row.Scan(
+		&i.Post.ID,
+		&i.Post.CreatedAt,
+		&i.Post.UpdatedAt,
+		&i.Post.Title,
+		&i.Post.Url,
+		&i.Post.Description,
+		&i.Post.PublishedAt,
+		&i.Post.FeedID,
+		&i.Post.ShortID,
+		&i.Post.Summary,
+		&i.Post.Content,
+		&i.Post.Author,
+		&i.Post.Guid,
+		&i.Post.CommentsUrl,
+		&i.Post.EnclosureUrl,
+		&i.Post.EnclosureType,
+		&i.Post.EnclosureLength,
+		&i.Post.CanonicalUrl,
+		&i.Post.StoryID,
+		&i.Post.FullContent,
+		&i.Post.FullContentFetchedAt,
+		&i.Post.PlainText,
+		&i.FeedName,
 	)
 	return i, err
 }
 
 const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT id, created_at, updated_at, title, url, description, published_at, feed_id FROM posts WHERE feed_id IN (
-    SELECT id FROM feeds WHERE user_id = $1
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.short_id, posts.summary, posts.content, posts.author, posts.guid, posts.comments_url, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length, posts.canonical_url, posts.story_id, posts.full_content, posts.full_content_fetched_at, posts.plain_text,
+    EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.user_id = $1 AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'highlight'
+    ) AS highlighted
+FROM posts WHERE feed_id IN (
+    SELECT feed_id FROM feed_follows WHERE user_id = $1
+)
+AND ($3::boolean OR NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.user_id = $1 AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'mute'
+))
+AND NOT EXISTS (
+    SELECT 1 FROM posts earlier
+    WHERE COALESCE(earlier.story_id, earlier.id) = COALESCE(posts.story_id, posts.id)
+    AND earlier.feed_id IN (SELECT feed_id FROM feed_follows WHERE user_id = $1)
+    AND (earlier.published_at, earlier.id) < (posts.published_at, posts.id)
 )
 ORDER BY published_at DESC
 LIMIT $2
 `
 
 type GetPostsForUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+	UserID       uuid.UUID
+	Limit        int32
+	IncludeMuted bool
+}
+
+type GetPostsForUserRow struct {
+	Post        Post
+	Highlighted bool
 }
 
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+// a story that came in from several feeds is shown once, as its first post
+func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit, arg.IncludeMuted)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []GetPostsForUserRow
 	for rows.Next() {
-		var i Post
+		var i GetPostsForUserRow
 		if err := rows.Scan(
-			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Title,
-			&i.Url,
-			&i.Description,
-			&i.PublishedAt,
-			&i.FeedID,
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.ShortID,
+			&i.Post.Summary,
+			&i.Post.Content,
+			&i.Post.Author,
+			&i.Post.Guid,
+			&i.Post.CommentsUrl,
+			&i.Post.EnclosureUrl,
+			&i.Post.EnclosureType,
+			&i.Post.EnclosureLength,
+			&i.Post.CanonicalUrl,
+			&i.Post.StoryID,
+			&i.Post.FullContent,
+			&i.Post.FullContentFetchedAt,
+			&i.Post.PlainText,
+			&i.Highlighted,
 		); err != nil {
 			return nil, err
 		}
@@ -116,3 +219,126 @@ func (q *Queries) ResetPosts(ctx context.Context) error {
 	_, err := q.db.ExecContext(ctx, resetPosts)
 	return err
 }
+
+const setPostFullContent = `-- name: SetPostFullContent :exec
+UPDATE posts SET
+    full_content = $2,
+    canonical_url = CASE WHEN $3::text = '' THEN canonical_url ELSE $3::text END,
+    full_content_fetched_at = NOW()
+WHERE id = $1
+`
+
+type SetPostFullContentParams struct {
+	ID           uuid.UUID
+	FullContent  string
+	CanonicalUrl string
+}
+
+func (q *Queries) SetPostFullContent(ctx context.Context, arg SetPostFullContentParams) error {
+	_, err := q.db.ExecContext(ctx, setPostFullContent, arg.ID, arg.FullContent, arg.CanonicalUrl)
+	return err
+}
+
+const upsertPost = `-- name: UpsertPost :one
+INSERT INTO posts (id, created_at, updated_at, title, url, description, summary, published_at, feed_id,
+    content, author, guid, comments_url, enclosure_url, enclosure_type, enclosure_length, canonical_url, plain_text)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11,
+    $12,
+    $13,
+    $14,
+    $15,
+    $16,
+    $17,
+    $18
+)
+ON CONFLICT (feed_id, url) DO UPDATE SET
+    title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    summary = EXCLUDED.summary,
+    plain_text = EXCLUDED.plain_text,
+    content = EXCLUDED.content,
+    author = EXCLUDED.author,
+    guid = EXCLUDED.guid,
+    comments_url = EXCLUDED.comments_url,
+    enclosure_url = EXCLUDED.enclosure_url,
+    enclosure_type = EXCLUDED.enclosure_type,
+    enclosure_length = EXCLUDED.enclosure_length,
+    -- the canonical url from the article page wins over the one worked out from the item
+    canonical_url = CASE WHEN posts.full_content_fetched_at IS NULL THEN EXCLUDED.canonical_url ELSE posts.canonical_url END,
+    updated_at = EXCLUDED.updated_at
+WHERE (posts.title, posts.description, posts.content, posts.author, posts.guid, posts.comments_url,
+        posts.enclosure_url, posts.enclosure_type, posts.enclosure_length)
+    IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.description, EXCLUDED.content, EXCLUDED.author, EXCLUDED.guid,
+        EXCLUDED.comments_url, EXCLUDED.enclosure_url, EXCLUDED.enclosure_type, EXCLUDED.enclosure_length)
+RETURNING id, short_id, (xmax = 0)::boolean AS inserted, (full_content_fetched_at IS NOT NULL)::boolean AS full_content_fetched
+`
+
+type UpsertPostParams struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Title           string
+	Url             string
+	Description     string
+	Summary         string
+	PublishedAt     time.Time
+	FeedID          uuid.UUID
+	Content         string
+	Author          string
+	Guid            string
+	CommentsUrl     string
+	EnclosureUrl    string
+	EnclosureType   string
+	EnclosureLength int64
+	CanonicalUrl    string
+	PlainText       string
+}
+
+type UpsertPostRow struct {
+	ID                 uuid.UUID
+	ShortID            int64
+	Inserted           bool
+	FullContentFetched bool
+}
+
+func (q *Queries) UpsertPost(ctx context.Context, arg UpsertPostParams) (UpsertPostRow, error) {
+	row := q.db.QueryRowContext(ctx, upsertPost,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Title,
+		arg.Url,
+		arg.Description,
+		arg.Summary,
+		arg.PublishedAt,
+		arg.FeedID,
+		arg.Content,
+		arg.Author,
+		arg.Guid,
+		arg.CommentsUrl,
+		arg.EnclosureUrl,
+		arg.EnclosureType,
+		arg.EnclosureLength,
+		arg.CanonicalUrl,
+		arg.PlainText,
+	)
+	var i UpsertPostRow
+	err := row.Scan(
+		&i.ID,
+		&i.ShortID,
+		&i.Inserted,
+		&i.FullContentFetched,
+	)
+	return i, err
+}
@@ -0,0 +1,110 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: sessions.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createSession = `-- name: CreateSession :exec
+INSERT INTO sessions (id, user_id, token_hash, expires_at)
+VALUES ($1, $2, $3, NOW() + make_interval(secs => $4::integer))
+`
+
+type CreateSessionParams struct {
+	ID              uuid.UUID
+	UserID          uuid.UUID
+	TokenHash       string
+	LifetimeSeconds int32
+}
+
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) error {
+	_, err := q.db.ExecContext(ctx, createSession,
+		arg.ID,
+		arg.UserID,
+		arg.TokenHash,
+		arg.LifetimeSeconds,
+	)
+	return err
+}
+
+const deleteExpiredSessions = `-- name: DeleteExpiredSessions :exec
+DELETE FROM sessions WHERE expires_at <= NOW()
+`
+
+func (q *Queries) DeleteExpiredSessions(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredSessions)
+	return err
+}
+
+const deleteOtherSessions = `-- name: DeleteOtherSessions :exec
+DELETE FROM sessions WHERE user_id = $1 AND token_hash <> $2
+`
+
+type DeleteOtherSessionsParams struct {
+	UserID    uuid.UUID
+	TokenHash string
+}
+
+func (q *Queries) DeleteOtherSessions(ctx context.Context, arg DeleteOtherSessionsParams) error {
+	_, err := q.db.ExecContext(ctx, deleteOtherSessions, arg.UserID, arg.TokenHash)
+	return err
+}
+
+const deleteSession = `-- name: DeleteSession :exec
+DELETE FROM sessions WHERE token_hash = $1
+`
+
+func (q *Queries) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, deleteSession, tokenHash)
+	return err
+}
+
+const deleteUserSessions = `-- name: DeleteUserSessions :exec
+DELETE FROM sessions WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserSessions(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUserSessions, userID)
+	return err
+}
+
+const getSessionUser = `-- name: GetSessionUser :one
+WITH session AS (
+    UPDATE sessions SET
+        last_used_at = NOW(),
+        expires_at = NOW() + make_interval(secs => $1::integer)
+    WHERE token_hash = $2 AND expires_at > NOW()
+    RETURNING user_id
+)
+SELECT users.id, users.created_at, users.updated_at, users.name, users.email, users.digest_frequency, users.last_digest_at, users.password_hash, users.is_admin FROM users
+JOIN session ON users.id = session.user_id
+`
+
+type GetSessionUserParams struct {
+	LifetimeSeconds int32
+	TokenHash       string
+}
+
+// using a session keeps it alive for another lifetime
+func (q *Queries) GetSessionUser(ctx context.Context, arg GetSessionUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, getSessionUser, arg.LifetimeSeconds, arg.TokenHash)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Email,
+		&i.DigestFrequency,
+		&i.LastDigestAt,
+		&i.PasswordHash,
+		&i.IsAdmin,
+	)
+	return i, err
+}
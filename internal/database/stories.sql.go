@@ -0,0 +1,139 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: stories.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const findStoryByCanonicalUrl = `-- name: FindStoryByCanonicalUrl :one
+SELECT COALESCE(story_id, id)::uuid AS story_id
+FROM posts
+WHERE canonical_url = $1 AND id <> $2
+ORDER BY published_at
+LIMIT 1
+`
+
+type FindStoryByCanonicalUrlParams struct {
+	CanonicalUrl string
+	ID           uuid.UUID
+}
+
+func (q *Queries) FindStoryByCanonicalUrl(ctx context.Context, arg FindStoryByCanonicalUrlParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, findStoryByCanonicalUrl, arg.CanonicalUrl, arg.ID)
+	var story_id uuid.UUID
+	err := row.Scan(&story_id)
+	return story_id, err
+}
+
+const getStoryCandidates = `-- name: GetStoryCandidates :many
+SELECT id, title, COALESCE(story_id, id)::uuid AS story_id
+FROM posts
+WHERE feed_id <> $1 AND id <> $2 AND published_at BETWEEN $3 AND $4
+ORDER BY published_at
+`
+
+type GetStoryCandidatesParams struct {
+	FeedID        uuid.UUID
+	ID            uuid.UUID
+	PublishedFrom time.Time
+	PublishedTo   time.Time
+}
+
+type GetStoryCandidatesRow struct {
+	ID      uuid.UUID
+	Title   string
+	StoryID uuid.UUID
+}
+
+func (q *Queries) GetStoryCandidates(ctx context.Context, arg GetStoryCandidatesParams) ([]GetStoryCandidatesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStoryCandidates,
+		arg.FeedID,
+		arg.ID,
+		arg.PublishedFrom,
+		arg.PublishedTo,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetStoryCandidatesRow
+	for rows.Next() {
+		var i GetStoryCandidatesRow
+		if err := rows.Scan(&i.ID, &i.Title, &i.StoryID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getStoryFeeds = `-- name: GetStoryFeeds :many
+SELECT COALESCE(posts.story_id, posts.id)::uuid AS story_id, posts.id AS post_id, feeds.name AS feed_name
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = $1
+WHERE COALESCE(posts.story_id, posts.id) = ANY($2::uuid[])
+ORDER BY posts.published_at
+`
+
+type GetStoryFeedsParams struct {
+	UserID   uuid.UUID
+	StoryIds []uuid.UUID
+}
+
+type GetStoryFeedsRow struct {
+	StoryID  uuid.UUID
+	PostID   uuid.UUID
+	FeedName string
+}
+
+func (q *Queries) GetStoryFeeds(ctx context.Context, arg GetStoryFeedsParams) ([]GetStoryFeedsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStoryFeeds, arg.UserID, pq.Array(arg.StoryIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetStoryFeedsRow
+	for rows.Next() {
+		var i GetStoryFeedsRow
+		if err := rows.Scan(&i.StoryID, &i.PostID, &i.FeedName); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setPostStory = `-- name: SetPostStory :exec
+UPDATE posts SET story_id = $2 WHERE id = $1
+`
+
+type SetPostStoryParams struct {
+	ID      uuid.UUID
+	StoryID uuid.NullUUID
+}
+
+func (q *Queries) SetPostStory(ctx context.Context, arg SetPostStoryParams) error {
+	_, err := q.db.ExecContext(ctx, setPostStory, arg.ID, arg.StoryID)
+	return err
+}
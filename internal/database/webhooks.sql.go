@@ -0,0 +1,417 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: webhooks.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createWebhook = `-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, updated_at, user_id, kind, url, secret, room, token, feed_id, rule_id)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11
+)
+RETURNING id, created_at, updated_at, short_id, user_id, kind, url, secret, room, token, feed_id, rule_id
+`
+
+type CreateWebhookParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Kind      string
+	Url       string
+	Secret    string
+	Room      string
+	Token     string
+	FeedID    uuid.NullUUID
+	RuleID    uuid.NullUUID
+}
+
+func (q *Queries) CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, createWebhook,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.UserID,
+		arg.Kind,
+		arg.Url,
+		arg.Secret,
+		arg.Room,
+		arg.Token,
+		arg.FeedID,
+		arg.RuleID,
+	)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ShortID,
+		&i.UserID,
+		&i.Kind,
+		&i.Url,
+		&i.Secret,
+		&i.Room,
+		&i.Token,
+		&i.FeedID,
+		&i.RuleID,
+	)
+	return i, err
+}
+
+const deleteWebhook = `-- name: DeleteWebhook :execrows
+DELETE FROM webhooks WHERE user_id = $1 AND short_id = $2
+`
+
+type DeleteWebhookParams struct {
+	UserID  uuid.UUID
+	ShortID int64
+}
+
+func (q *Queries) DeleteWebhook(ctx context.Context, arg DeleteWebhookParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteWebhook, arg.UserID, arg.ShortID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getDueWebhookDeliveries = `-- name: GetDueWebhookDeliveries :many
+SELECT webhook_deliveries.id, webhook_deliveries.attempts, webhook_deliveries.created_at,
+    webhooks.id, webhooks.created_at, webhooks.updated_at, webhooks.short_id, webhooks.user_id, webhooks.kind, webhooks.url, webhooks.secret, webhooks.room, webhooks.token, webhooks.feed_id, webhooks.rule_id, posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.short_id, posts.summary, posts.content, posts.author, posts.guid, posts.comments_url, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length, posts.canonical_url, posts.story_id, posts.full_content, posts.full_content_fetched_at, posts.plain_text, feeds.name AS feed_name, feeds.url AS feed_url
+FROM webhook_deliveries
+INNER JOIN webhooks ON webhook_deliveries.webhook_id = webhooks.id
+INNER JOIN posts ON webhook_deliveries.post_id = posts.id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE webhook_deliveries.status = 'pending' AND webhook_deliveries.next_attempt_at <= NOW()
+ORDER BY webhook_deliveries.next_attempt_at, webhook_deliveries.created_at
+LIMIT $1
+`
+
+type GetDueWebhookDeliveriesRow struct {
+	ID        uuid.UUID
+	Attempts  int32
+	CreatedAt time.Time
+	Webhook   Webhook
+	Post      Post
+	FeedName  string
+	FeedUrl   string
+}
+
+func (q *Queries) GetDueWebhookDeliveries(ctx context.Context, limit int32) ([]GetDueWebhookDeliveriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDueWebhookDeliveries, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDueWebhookDeliveriesRow
+	for rows.Next() {
+		var i GetDueWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Attempts,
+			&i.CreatedAt,
+			&i.Webhook.ID,
+			&i.Webhook.CreatedAt,
+			&i.Webhook.UpdatedAt,
+			&i.Webhook.ShortID,
+			&i.Webhook.UserID,
+			&i.Webhook.Kind,
+			&i.Webhook.Url,
+			&i.Webhook.Secret,
+			&i.Webhook.Room,
+			&i.Webhook.Token,
+			&i.Webhook.FeedID,
+			&i.Webhook.RuleID,
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.ShortID,
+			&i.Post.Summary,
+			&i.Post.Content,
+			&i.Post.Author,
+			&i.Post.Guid,
+			&i.Post.CommentsUrl,
+			&i.Post.EnclosureUrl,
+			&i.Post.EnclosureType,
+			&i.Post.EnclosureLength,
+			&i.Post.CanonicalUrl,
+			&i.Post.StoryID,
+			&i.Post.FullContent,
+			&i.Post.FullContentFetchedAt,
+			&i.Post.PlainText,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFilterRuleByShortId = `-- name: GetFilterRuleByShortId :one
+SELECT id, created_at, updated_at, short_id, user_id, feed_id, field, pattern, action FROM filter_rules WHERE user_id = $1 AND short_id = $2
+`
+
+type GetFilterRuleByShortIdParams struct {
+	UserID  uuid.UUID
+	ShortID int64
+}
+
+func (q *Queries) GetFilterRuleByShortId(ctx context.Context, arg GetFilterRuleByShortIdParams) (FilterRule, error) {
+	row := q.db.QueryRowContext(ctx, getFilterRuleByShortId, arg.UserID, arg.ShortID)
+	var i FilterRule
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ShortID,
+		&i.UserID,
+		&i.FeedID,
+		&i.Field,
+		&i.Pattern,
+		&i.Action,
+	)
+	return i, err
+}
+
+const getWebhookDeliveries = `-- name: GetWebhookDeliveries :many
+SELECT webhook_deliveries.id, webhook_deliveries.created_at, webhook_deliveries.updated_at, webhook_deliveries.webhook_id, webhook_deliveries.post_id, webhook_deliveries.status, webhook_deliveries.attempts, webhook_deliveries.next_attempt_at, webhook_deliveries.last_status_code, webhook_deliveries.last_error, webhook_deliveries.delivered_at, webhooks.short_id AS webhook_short_id, posts.short_id AS post_short_id, posts.title AS post_title
+FROM webhook_deliveries
+INNER JOIN webhooks ON webhook_deliveries.webhook_id = webhooks.id
+INNER JOIN posts ON webhook_deliveries.post_id = posts.id
+WHERE webhooks.user_id = $1
+AND ($3::bigint IS NULL OR webhooks.short_id = $3::bigint)
+ORDER BY webhook_deliveries.updated_at DESC
+LIMIT $2
+`
+
+type GetWebhookDeliveriesParams struct {
+	UserID         uuid.UUID
+	Limit          int32
+	WebhookShortID sql.NullInt64
+}
+
+type GetWebhookDeliveriesRow struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	WebhookID      uuid.UUID
+	PostID         uuid.UUID
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastStatusCode sql.NullInt32
+	LastError      string
+	DeliveredAt    sql.NullTime
+	WebhookShortID int64
+	PostShortID    int64
+	PostTitle      string
+}
+
+func (q *Queries) GetWebhookDeliveries(ctx context.Context, arg GetWebhookDeliveriesParams) ([]GetWebhookDeliveriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookDeliveries, arg.UserID, arg.Limit, arg.WebhookShortID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetWebhookDeliveriesRow
+	for rows.Next() {
+		var i GetWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.WebhookID,
+			&i.PostID,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastStatusCode,
+			&i.LastError,
+			&i.DeliveredAt,
+			&i.WebhookShortID,
+			&i.PostShortID,
+			&i.PostTitle,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhooksForUser = `-- name: GetWebhooksForUser :many
+SELECT webhooks.id, webhooks.created_at, webhooks.updated_at, webhooks.short_id, webhooks.user_id, webhooks.kind, webhooks.url, webhooks.secret, webhooks.room, webhooks.token, webhooks.feed_id, webhooks.rule_id, feeds.name AS feed_name, filter_rules.short_id AS rule_short_id,
+    COALESCE((
+        SELECT webhook_deliveries.status
+        FROM webhook_deliveries
+        WHERE webhook_deliveries.webhook_id = webhooks.id AND webhook_deliveries.attempts > 0
+        ORDER BY webhook_deliveries.updated_at DESC
+        LIMIT 1
+    ), '')::text AS last_status
+FROM webhooks
+LEFT JOIN feeds ON webhooks.feed_id = feeds.id
+LEFT JOIN filter_rules ON webhooks.rule_id = filter_rules.id
+WHERE webhooks.user_id = $1
+ORDER BY webhooks.short_id
+`
+
+type GetWebhooksForUserRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ShortID     int64
+	UserID      uuid.UUID
+	Kind        string
+	Url         string
+	Secret      string
+	Room        string
+	Token       string
+	FeedID      uuid.NullUUID
+	RuleID      uuid.NullUUID
+	FeedName    sql.NullString
+	RuleShortID sql.NullInt64
+	LastStatus  string
+}
+
+func (q *Queries) GetWebhooksForUser(ctx context.Context, userID uuid.UUID) ([]GetWebhooksForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhooksForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetWebhooksForUserRow
+	for rows.Next() {
+		var i GetWebhooksForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ShortID,
+			&i.UserID,
+			&i.Kind,
+			&i.Url,
+			&i.Secret,
+			&i.Room,
+			&i.Token,
+			&i.FeedID,
+			&i.RuleID,
+			&i.FeedName,
+			&i.RuleShortID,
+			&i.LastStatus,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const queueWebhookDeliveries = `-- name: QueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, webhook_id, post_id)
+SELECT gen_random_uuid(), webhooks.id, posts.id
+FROM webhooks
+INNER JOIN posts ON posts.id = $1
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = webhooks.user_id
+WHERE (webhooks.feed_id IS NULL OR webhooks.feed_id = posts.feed_id)
+AND (webhooks.rule_id IS NULL OR EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.rule_id = webhooks.rule_id AND post_rule_matches.post_id = posts.id
+))
+AND NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.user_id = webhooks.user_id AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'mute'
+)
+AND NOT EXISTS (
+    SELECT 1 FROM webhook_deliveries
+    INNER JOIN posts other ON webhook_deliveries.post_id = other.id
+    WHERE webhook_deliveries.webhook_id = webhooks.id AND other.id <> posts.id
+    AND COALESCE(other.story_id, other.id) = COALESCE(posts.story_id, posts.id)
+)
+ON CONFLICT (webhook_id, post_id) DO NOTHING
+`
+
+// a webhook gets a new post when its owner follows the feed, the post is not muted for them,
+// and the post is from the webhook's feed and matches its rule, if it has them
+// the same story from another feed has already been sent to this webhook
+func (q *Queries) QueueWebhookDeliveries(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, queueWebhookDeliveries, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const recordWebhookAttempt = `-- name: RecordWebhookAttempt :exec
+UPDATE webhook_deliveries SET
+    status = $2,
+    attempts = attempts + 1,
+    next_attempt_at = $3,
+    last_status_code = $4,
+    last_error = $5,
+    delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() ELSE delivered_at END,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type RecordWebhookAttemptParams struct {
+	ID             uuid.UUID
+	Status         string
+	NextAttemptAt  time.Time
+	LastStatusCode sql.NullInt32
+	LastError      string
+}
+
+func (q *Queries) RecordWebhookAttempt(ctx context.Context, arg RecordWebhookAttemptParams) error {
+	_, err := q.db.ExecContext(ctx, recordWebhookAttempt,
+		arg.ID,
+		arg.Status,
+		arg.NextAttemptAt,
+		arg.LastStatusCode,
+		arg.LastError,
+	)
+	return err
+}
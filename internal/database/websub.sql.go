@@ -0,0 +1,237 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: websub.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const activateWebSubSubscription = `-- name: ActivateWebSubSubscription :exec
+UPDATE websub_subscriptions SET
+    updated_at = NOW(),
+    status = 'active',
+    lease_seconds = $2::integer,
+    lease_expires_at = NOW() + make_interval(secs => $2::integer),
+    last_error = ''
+WHERE id = $1
+`
+
+type ActivateWebSubSubscriptionParams struct {
+	ID           uuid.UUID
+	LeaseSeconds int32
+}
+
+func (q *Queries) ActivateWebSubSubscription(ctx context.Context, arg ActivateWebSubSubscriptionParams) error {
+	_, err := q.db.ExecContext(ctx, activateWebSubSubscription, arg.ID, arg.LeaseSeconds)
+	return err
+}
+
+const createWebSubSubscription = `-- name: CreateWebSubSubscription :one
+INSERT INTO websub_subscriptions (id, feed_id, hub_url, topic_url, secret)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (feed_id) DO UPDATE SET
+    updated_at = NOW(),
+    hub_url = EXCLUDED.hub_url,
+    topic_url = EXCLUDED.topic_url,
+    secret = EXCLUDED.secret,
+    status = 'pending',
+    requested_at = NOW(),
+    lease_seconds = NULL,
+    lease_expires_at = NULL,
+    last_error = ''
+RETURNING id, created_at, updated_at, feed_id, hub_url, topic_url, secret, status, requested_at, lease_seconds, lease_expires_at, last_error, last_push_at
+`
+
+type CreateWebSubSubscriptionParams struct {
+	ID       uuid.UUID
+	FeedID   uuid.UUID
+	HubUrl   string
+	TopicUrl string
+	Secret   string
+}
+
+// a subscription to a new hub or topic starts over as pending, with a new secret
+func (q *Queries) CreateWebSubSubscription(ctx context.Context, arg CreateWebSubSubscriptionParams) (WebsubSubscription, error) {
+	row := q.db.QueryRowContext(ctx, createWebSubSubscription,
+		arg.ID,
+		arg.FeedID,
+		arg.HubUrl,
+		arg.TopicUrl,
+		arg.Secret,
+	)
+	var i WebsubSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FeedID,
+		&i.HubUrl,
+		&i.TopicUrl,
+		&i.Secret,
+		&i.Status,
+		&i.RequestedAt,
+		&i.LeaseSeconds,
+		&i.LeaseExpiresAt,
+		&i.LastError,
+		&i.LastPushAt,
+	)
+	return i, err
+}
+
+const denyWebSubSubscription = `-- name: DenyWebSubSubscription :exec
+UPDATE websub_subscriptions SET
+    updated_at = NOW(),
+    status = 'denied',
+    lease_seconds = NULL,
+    lease_expires_at = NULL,
+    last_error = $2
+WHERE id = $1
+`
+
+type DenyWebSubSubscriptionParams struct {
+	ID     uuid.UUID
+	Reason string
+}
+
+func (q *Queries) DenyWebSubSubscription(ctx context.Context, arg DenyWebSubSubscriptionParams) error {
+	_, err := q.db.ExecContext(ctx, denyWebSubSubscription, arg.ID, arg.Reason)
+	return err
+}
+
+const getWebSubSubscription = `-- name: GetWebSubSubscription :one
+SELECT id, created_at, updated_at, feed_id, hub_url, topic_url, secret, status, requested_at, lease_seconds, lease_expires_at, last_error, last_push_at FROM websub_subscriptions
+WHERE id = $1
+`
+
+func (q *Queries) GetWebSubSubscription(ctx context.Context, id uuid.UUID) (WebsubSubscription, error) {
+	row := q.db.QueryRowContext(ctx, getWebSubSubscription, id)
+	var i WebsubSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FeedID,
+		&i.HubUrl,
+		&i.TopicUrl,
+		&i.Secret,
+		&i.Status,
+		&i.RequestedAt,
+		&i.LeaseSeconds,
+		&i.LeaseExpiresAt,
+		&i.LastError,
+		&i.LastPushAt,
+	)
+	return i, err
+}
+
+const getWebSubSubscriptionForFeed = `-- name: GetWebSubSubscriptionForFeed :one
+SELECT id, created_at, updated_at, feed_id, hub_url, topic_url, secret, status, requested_at, lease_seconds, lease_expires_at, last_error, last_push_at FROM websub_subscriptions
+WHERE feed_id = $1
+`
+
+func (q *Queries) GetWebSubSubscriptionForFeed(ctx context.Context, feedID uuid.UUID) (WebsubSubscription, error) {
+	row := q.db.QueryRowContext(ctx, getWebSubSubscriptionForFeed, feedID)
+	var i WebsubSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FeedID,
+		&i.HubUrl,
+		&i.TopicUrl,
+		&i.Secret,
+		&i.Status,
+		&i.RequestedAt,
+		&i.LeaseSeconds,
+		&i.LeaseExpiresAt,
+		&i.LastError,
+		&i.LastPushAt,
+	)
+	return i, err
+}
+
+const getWebSubSubscriptionsToRenew = `-- name: GetWebSubSubscriptionsToRenew :many
+SELECT id, created_at, updated_at, feed_id, hub_url, topic_url, secret, status, requested_at, lease_seconds, lease_expires_at, last_error, last_push_at FROM websub_subscriptions
+WHERE status = 'active'
+    AND lease_expires_at < NOW() + make_interval(secs => LEAST(COALESCE(lease_seconds, 0) / 2, 86400))
+    AND requested_at < NOW() - interval '10 minutes'
+ORDER BY lease_expires_at ASC
+`
+
+// leases are renewed a day before they run out, or halfway through leases shorter than two days,
+// and a renewal that has just been asked for is given time to be verified
+func (q *Queries) GetWebSubSubscriptionsToRenew(ctx context.Context) ([]WebsubSubscription, error) {
+	rows, err := q.db.QueryContext(ctx, getWebSubSubscriptionsToRenew)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebsubSubscription
+	for rows.Next() {
+		var i WebsubSubscription
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.FeedID,
+			&i.HubUrl,
+			&i.TopicUrl,
+			&i.Secret,
+			&i.Status,
+			&i.RequestedAt,
+			&i.LeaseSeconds,
+			&i.LeaseExpiresAt,
+			&i.LastError,
+			&i.LastPushAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordWebSubPush = `-- name: RecordWebSubPush :exec
+UPDATE websub_subscriptions SET last_push_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) RecordWebSubPush(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, recordWebSubPush, id)
+	return err
+}
+
+const recordWebSubRequest = `-- name: RecordWebSubRequest :exec
+UPDATE websub_subscriptions SET
+    updated_at = NOW(),
+    requested_at = NOW(),
+    last_error = $2,
+    status = CASE
+        WHEN status = 'active' THEN status
+        WHEN $2::text <> '' THEN 'failed'
+        ELSE 'pending'
+    END
+WHERE id = $1
+`
+
+type RecordWebSubRequestParams struct {
+	ID        uuid.UUID
+	LastError string
+}
+
+// an active subscription stays active when renewing it fails, until its lease runs out
+func (q *Queries) RecordWebSubRequest(ctx context.Context, arg RecordWebSubRequestParams) error {
+	_, err := q.db.ExecContext(ctx, recordWebSubRequest, arg.ID, arg.LastError)
+	return err
+}
@@ -0,0 +1,35 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func lockPidFile(path string) (func(), error) {
+	//func that creates the pid file, failing if it already exists
+	//without flock a crashed aggregator leaves the file behind, and it has to be removed by hand
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			pid, _ := os.ReadFile(path)
+			return nil, fmt.Errorf("another aggregator is already running (pid %s, lock file %s)", strings.TrimSpace(string(pid)), path)
+		}
+		return nil, fmt.Errorf("could not create pid file: %w", err)
+	}
+
+	if _, err := file.WriteString(strconv.Itoa(os.Getpid()) + "\n"); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("could not write pid file: %w", err)
+	}
+
+	return func() {
+		file.Close()
+		os.Remove(path)
+	}, nil
+}
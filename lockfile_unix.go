@@ -0,0 +1,45 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func lockPidFile(path string) (func(), error) {
+	//func that takes an exclusive lock on the pid file and writes our pid into it
+	//the lock is released by the os if the process dies, so stale files do not block a restart
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open pid file: %w", err)
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		defer file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			pid, _ := os.ReadFile(path)
+			return nil, fmt.Errorf("another aggregator is already running (pid %s, lock file %s)", strings.TrimSpace(string(pid)), path)
+		}
+		return nil, fmt.Errorf("could not lock pid file: %w", err)
+	}
+
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not write pid file: %w", err)
+	}
+	if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not write pid file: %w", err)
+	}
+
+	return func() {
+		os.Remove(path)
+		file.Close()
+	}, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"internal/config"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type logOutput struct {
+	//the handler logs currently go to, and the func that closes its file
+	//writes hold the read lock, so a file replaced on reload is only closed once they are done with it
+	mu        sync.RWMutex
+	handler   slog.Handler
+	closeFile func() error
+}
+
+type reloadableHandler struct {
+	//slog handler that passes records on to the current handler of out, so the logger and every logger
+	//made from it with With or WithGroup keep working when the config is reloaded
+	out   *logOutput
+	scope []func(slog.Handler) slog.Handler
+}
+
+func newLogger(cfg *config.Config) (*slog.Logger, func() error, error) {
+	//func that builds the logger described by the config
+	//the returned func closes the log file, and reopenLogger points the logger at a new config
+	handler, closeFile, err := newLogHandler(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := &logOutput{handler: handler, closeFile: closeFile}
+	return slog.New(&reloadableHandler{out: out}), out.close, nil
+}
+
+func reopenLogger(logger *slog.Logger, cfg *config.Config) error {
+	//func that sends the logs of a logger made by newLogger where cfg says, closing the old log file
+	reloadable, ok := logger.Handler().(*reloadableHandler)
+	if !ok {
+		return fmt.Errorf("logger can not be reloaded")
+	}
+	handler, closeFile, err := newLogHandler(cfg)
+	if err != nil {
+		return err
+	}
+	reloadable.out.mu.Lock()
+	oldClose := reloadable.out.closeFile
+	reloadable.out.handler = handler
+	reloadable.out.closeFile = closeFile
+	reloadable.out.mu.Unlock()
+	return oldClose()
+}
+
+func (o *logOutput) close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.closeFile()
+}
+
+func (h *reloadableHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	h.out.mu.RLock()
+	defer h.out.mu.RUnlock()
+	return h.out.handler.Enabled(ctx, level)
+}
+
+func (h *reloadableHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.out.mu.RLock()
+	defer h.out.mu.RUnlock()
+	handler := h.out.handler
+	for _, apply := range h.scope {
+		handler = apply(handler)
+	}
+	return handler.Handle(ctx, record)
+}
+
+func (h *reloadableHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *reloadableHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *reloadableHandler) with(apply func(slog.Handler) slog.Handler) slog.Handler {
+	scope := append(slices.Clone(h.scope), apply)
+	return &reloadableHandler{out: h.out, scope: scope}
+}
+
+func newLogHandler(cfg *config.Config) (slog.Handler, func() error, error) {
+	//func that builds the handler described by the config
+	//logs go to stderr unless a log file is set, and the returned func closes that file
+	var level slog.Level
+	switch strings.ToLower(cfg.LogLevel) {
+	case "", "info":
+		level = slog.LevelInfo
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		return nil, nil, fmt.Errorf("unknown log_level: %s", cfg.LogLevel)
+	}
+
+	var out io.Writer = os.Stderr
+	closeLog := func() error { return nil }
+	if cfg.LogFile != "" {
+		file, err := os.OpenFile(cfg.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not open log file: %w", err)
+		}
+		out = file
+		closeLog = file.Close
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.LogFormat) {
+	case "", "text":
+		handler = slog.NewTextHandler(out, options)
+	case "json":
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		closeLog()
+		return nil, nil, fmt.Errorf("unknown log_format: %s", cfg.LogFormat)
+	}
+
+	return handler, closeLog, nil
+}
@@ -3,9 +3,13 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"internal/config"
+	"log/slog"
 	"os"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 	"github.com/joncaudill/gator/internal/database"
@@ -16,26 +20,63 @@ type state struct {
 	//struct that represents the state of the application
 	db     *database.Queries
 	config *config.Config
+	//the fetcher and post hooks are replaced when agg reloads its config, while other goroutines use them
+	fetcher atomic.Pointer[feedFetcher]
+	//post hooks from the config, only set while agg runs
+	hooks atomic.Pointer[postHooks]
+	//websub callback server, only set while agg runs with websub_addr
+	websub *webSub
+	//background webhook deliveries and post hooks, only set while agg runs
+	workers *aggWorkers
+	//the logger keeps working across reloads, which only swap where it writes to
+	logger   *slog.Logger
+	closeLog func() error
+	//output format picked with the --output flag of listing commands
+	output string
 }
 
 type command struct {
 	//struct that contains the params of the command
 	name string
-	args []string
+	//positional args, with flags already parsed out into flags
+	args  []string
+	flags map[string]string
+	//the definition the command was parsed with
+	def commandDef
 }
 
 type commands struct {
 	//struct that contains the commands of the application
-	names map[string]func(*state, command) error
+	names map[string]commandDef
+	//command names in the order they were registered, used by help
+	order []string
 }
 
 type RSSFeed struct {
 	Channel struct {
 		Title       string    `xml:"title"`
-		Link        []string  `xml:"link"`
+		Link        []RSSLink `xml:"link"`
 		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
+		Language    string    `xml:"language"`
+		Image       struct {
+			URL string `xml:"url"`
+		} `xml:"image"`
+		Item []RSSItem `xml:"item"`
 	} `xml:"channel"`
+	//url the feed was permanently redirected to (301/308) while fetching, if any
+	MovedTo string `xml:"-"`
+	//status code of the response the feed was read from
+	StatusCode int `xml:"-"`
+	//websub hubs the feed advertised, in its atom:link elements or Link headers, and its own url as it gave it
+	Hubs []string `xml:"-"`
+	Self string   `xml:"-"`
+}
+
+type RSSLink struct {
+	//a channel link, atom:link elements also match and carry their url and relation in attributes
+	Text string `xml:",chardata"`
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
 }
 
 type RSSItem struct {
@@ -43,23 +84,67 @@ type RSSItem struct {
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
 	PubDate     string `xml:"pubDate"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	//author also matches itunes:author, so the first non-empty one is used
+	Authors    []string     `xml:"author"`
+	Creator    string       `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories []string     `xml:"category"`
+	GUID       string       `xml:"guid"`
+	Comments   string       `xml:"comments"`
+	Enclosure  RSSEnclosure `xml:"enclosure"`
+	//link to the original article of an item syndicated through feedburner
+	OrigLink string `xml:"http://rssnamespace.org/feedburner/ext/1.0 origLink"`
+	//podcast details from the itunes:* tags
+	ITunesDuration string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ITunesEpisode  string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	ITunesSeason   string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	ITunesImage    struct {
+		Href string `xml:"href,attr"`
+	} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ITunesExplicit string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
 }
 
-func (c *commands) register(name string, f func(*state, command) error) {
-	//registers a new handler function for a command name
-	c.names[name] = f
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+func (c *commands) register(def commandDef) {
+	//registers a new command definition under its name
+	c.names[def.name] = def
+	c.order = append(c.order, def.name)
 }
 
 func (c *commands) run(s *state, cmd command) error {
 	//runs a given command with the state passed into the func
-	if _, ok := c.names[cmd.name]; !ok {
-		return fmt.Errorf("command not found: %s", cmd.name)
+	//the command's flags and args are parsed first, unless it takes them raw
+	def, ok := c.names[cmd.name]
+	if !ok {
+		return &usageError{msg: fmt.Sprintf("command not found: %s (run \"gator help\" for a list of commands)", cmd.name)}
 	}
-	err := c.names[cmd.name](s, cmd)
-	if err != nil {
-		return fmt.Errorf("could not run command: %w", err)
+	cmd.def = def
+	if !def.rawArgs {
+		var err error
+		cmd, err = def.parse(cmd.args)
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Print(def.help())
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	s.output = outputText
+	if def.output {
+		s.output = cmd.flag("output")
 	}
-	return nil
+
+	handler := def.handler
+	if def.loggedInHandler != nil {
+		handler = middlewareLoggedIn(def.loggedInHandler)
+	}
+	return handler(s, cmd)
 }
 
 func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(s *state, cmd command) error {
@@ -67,64 +152,90 @@ func middlewareLoggedIn(handler func(s *state, cmd command, user database.User)
 	return func(s *state, cmd command) error {
 		user, err := getCurrentUser(s)
 		if err != nil {
-			return fmt.Errorf("could not get current user: %w", err)
+			return err
 		}
 		return handler(s, cmd, user)
 	}
 }
 
-func getCurrentUser(s *state) (database.User, error) {
-	//func that gets the current user name
-	user, err := s.db.GetUser(context.Background(), s.config.UserName)
+func getUserById(s *state, id uuid.UUID) (database.User, error) {
+	//func that gets the user by the user id
+	user, err := s.db.GetUserById(context.Background(), id)
 	if err != nil {
-		return database.User{}, fmt.Errorf("could not get user name: %w", err)
+		return database.User{}, dbError(err, "user with id %s", id)
 	}
 	return user, nil
 }
 
-func getUserById(s *state, id uuid.UUID) (database.User, error) {
-	//func that gets the user by the user id
-	user, err := s.db.GetUserById(context.Background(), id)
+func getFeedByURL(s *state, feedURL string) (database.Feed, error) {
+	//func that gets a feed by its url, matching normalized urls and old aliases
+	urlKey, err := feedURLKey(feedURL)
 	if err != nil {
-		return database.User{}, fmt.Errorf("could not get user by id: %w", err)
+		return database.Feed{}, fmt.Errorf("invalid feed url %s: %w", feedURL, err)
 	}
-	return user, nil
+	feed, err := s.db.GetFeedByUrl(context.Background(), urlKey)
+	if err != nil {
+		return database.Feed{}, dbError(err, "feed %s", feedURL)
+	}
+	return feed, nil
 }
 
 func main() {
+	os.Exit(runMain())
+}
+
+func runMain() int {
+	//func that sets gator up, runs the command from the command line and returns the exit code
+	//errors are printed to stderr and mapped to an exit code by exitCode
 	cfg, err := config.Read()
 	if err != nil {
-		fmt.Println("could not read config:", err)
-		return
+		fmt.Fprintln(os.Stderr, "gator: could not read config:", err)
+		return exitError
 	}
 
 	db, err := sql.Open("postgres", cfg.DbUrl)
 	if err != nil {
-		fmt.Println("could not connect to database:", err)
-		return
+		fmt.Fprintln(os.Stderr, "gator: could not connect to database:", err)
+		return exitDatabase
 	}
+	defer db.Close()
 	dbQueries := database.New(db)
 
-	cliState := &state{config: &cfg, db: dbQueries}
-	cliCommands := commands{names: make(map[string]func(*state, command) error)}
-	cliCommands.register("login", handlerLogin)
-	cliCommands.register("register", handlerRegister)
-	cliCommands.register("reset", handlerReset)
-	cliCommands.register("users", handlerList)
-	cliCommands.register("agg", handlerAgg)
-	cliCommands.register("addfeed", middlewareLoggedIn(handlerAddFeed))
-	cliCommands.register("feeds", handlerFeeds)
-	cliCommands.register("follow", middlewareLoggedIn(handlerAddFollow))
-	cliCommands.register("following", middlewareLoggedIn(handlerFollowing))
-	cliCommands.register("unfollow", middlewareLoggedIn(handlerDeleteFollow))
-	cliCommands.register("posts", middlewareLoggedIn(handlerBrowse))
+	fetcher, err := newFeedFetcher(&cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gator: could not read fetch settings:", err)
+		return exitError
+	}
+
+	logger, closeLog, err := newLogger(&cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gator: could not set up logging:", err)
+		return exitError
+	}
+
+	cliState := &state{config: &cfg, db: dbQueries, logger: logger, closeLog: closeLog}
+	cliState.fetcher.Store(fetcher)
+	defer cliState.closeLog()
+
+	cliCommands := commands{names: make(map[string]commandDef)}
+	registerCommands(&cliCommands)
 
 	args := os.Args
 	if len(args) < 2 {
-		fmt.Println("not enough arguments were provided")
-		os.Exit(1)
+		fmt.Fprint(os.Stderr, cliCommands.help())
+		return exitUsage
+	}
+	if args[1] == "--help" || args[1] == "-h" {
+		args[1] = "help"
 	}
 
-	cliCommands.run(cliState, command{name: args[1], args: args[2:]})
-
+	err = cliCommands.run(cliState, command{name: args[1], args: args[2:]})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gator:", err)
+		var usageErr *usageError
+		if errors.As(err, &usageErr) && usageErr.command.name != "" {
+			fmt.Fprintf(os.Stderr, "usage: gator %s\n", usageErr.command.usage())
+		}
+	}
+	return exitCode(err)
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/joncaudill/gator/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const defaultFeedOverdueAfter = 24 * time.Hour
+
+var (
+	metricFetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gator_fetches_total",
+		Help: "Feed fetches by http status, or \"error\" when no response was received.",
+	}, []string{"status"})
+	metricFetchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gator_fetch_duration_seconds",
+		Help:    "Time taken to fetch and parse a feed.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+	})
+	metricBytesDownloaded = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gator_downloaded_bytes_total",
+		Help: "Bytes received in response bodies, before decompression.",
+	})
+	metricPosts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gator_posts_total",
+		Help: "Feed items stored by result: inserted, updated or duplicate.",
+	}, []string{"result"})
+	metricParseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gator_parse_errors_total",
+		Help: "Feeds that could not be parsed, and items whose publish date could not be parsed.",
+	}, []string{"kind"})
+	metricArticleFetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gator_article_fetches_total",
+		Help: "Linked pages fetched for full content, by result: extracted, no_article or error.",
+	}, []string{"result"})
+	metricWebSubPushes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gator_websub_pushes_total",
+		Help: "Content pushed by websub hubs, by result: accepted, bad_signature or dropped.",
+	}, []string{"result"})
+)
+
+type feedLagCollector struct {
+	//collector that reports overdue feeds and queue lag from last_fetched_at when scraped
+	db           *database.Queries
+	overdueAfter time.Duration
+	overdue      *prometheus.Desc
+	lag          *prometheus.Desc
+}
+
+func newFeedLagCollector(db *database.Queries, overdueAfter time.Duration) *feedLagCollector {
+	return &feedLagCollector{
+		db:           db,
+		overdueAfter: overdueAfter,
+		overdue: prometheus.NewDesc("gator_feeds_overdue",
+			"Feeds that have never been fetched or were last fetched longer ago than the overdue threshold.", nil, nil),
+		lag: prometheus.NewDesc("gator_queue_lag_seconds",
+			"Seconds since the least recently fetched feed was fetched (or created, if never fetched).", nil, nil),
+	}
+}
+
+func (c *feedLagCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.overdue
+	ch <- c.lag
+}
+
+func (c *feedLagCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	row, err := c.db.GetFeedFetchLag(ctx, time.Now().Add(-c.overdueAfter))
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.overdue, err)
+		ch <- prometheus.NewInvalidMetric(c.lag, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.overdue, prometheus.GaugeValue, float64(row.Overdue))
+	ch <- prometheus.MustNewConstMetric(c.lag, prometheus.GaugeValue, row.LagSeconds)
+}
+
+func startMetricsServer(s *state, addr string) (func(), error) {
+	//func that serves /metrics on addr until the returned func is called
+	overdueAfter, err := configDuration(s.config.MetricsOverdueAfter, defaultFeedOverdueAfter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metrics_overdue_after: %w", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metricFetches,
+		metricFetchDuration,
+		metricBytesDownloaded,
+		metricPosts,
+		metricParseErrors,
+		metricArticleFetches,
+		metricWebSubPushes,
+		newFeedLagCollector(s.db, overdueAfter),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError}))
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s: %w", addr, err)
+	}
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("metrics server stopped", "err", err)
+		}
+	}()
+	s.logger.Info("serving metrics", "addr", listener.Addr().String())
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
+
+type countingBody struct {
+	//wraps a response body to count the bytes read from it
+	io.ReadCloser
+}
+
+func (b countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	metricBytesDownloaded.Add(float64(n))
+	return n, err
+}
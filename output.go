@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputCSV  = "csv"
+	outputTSV  = "tsv"
+	outputYAML = "yaml"
+)
+
+type outputTable struct {
+	//struct that holds the records a listing command prints in a machine-readable format
+	//a value is a string, bool, int64 or nil, and json and yaml keep that type
+	columns []string
+	rows    [][]any
+}
+
+func (t *outputTable) add(values ...any) {
+	t.rows = append(t.rows, values)
+}
+
+func parseOutputFormat(format string) (string, error) {
+	//func that checks the value of the --output flag of a listing command
+	format = strings.ToLower(format)
+	switch format {
+	case outputText, outputJSON, outputCSV, outputTSV, outputYAML:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown output format: %s (use text, json, csv, tsv or yaml)", format)
+}
+
+func writeTable(s *state, table outputTable) error {
+	//func that prints a table to stdout in the output format picked with --output
+	switch s.output {
+	case outputJSON:
+		return writeJSON(os.Stdout, table)
+	case outputCSV:
+		return writeCSV(os.Stdout, table)
+	case outputTSV:
+		return writeTSV(os.Stdout, table)
+	case outputYAML:
+		return writeYAML(os.Stdout, table)
+	}
+	return fmt.Errorf("output format %s cannot be written as a table", s.output)
+}
+
+func writeJSON(w io.Writer, table outputTable) error {
+	//func that writes the table as a json array of objects, keeping the column order
+	var b strings.Builder
+	b.WriteString("[")
+	for i, row := range table.rows {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n  {")
+		for j, column := range table.columns {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(jsonQuote(column))
+			b.WriteString(": ")
+			b.WriteString(jsonValue(row[j]))
+		}
+		b.WriteString("}")
+	}
+	if len(table.rows) > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString("]\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeCSV(w io.Writer, table outputTable) error {
+	writer := csv.NewWriter(w)
+	writer.Write(table.columns)
+	for _, row := range table.rows {
+		writer.Write(textValues(row))
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeTSV(w io.Writer, table outputTable) error {
+	//func that writes the table as tab separated values
+	//tabs and newlines inside values are replaced with spaces so every record stays on one line
+	clean := strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+	lines := []string{strings.Join(table.columns, "\t")}
+	for _, row := range table.rows {
+		values := textValues(row)
+		for i, value := range values {
+			values[i] = clean.Replace(value)
+		}
+		lines = append(lines, strings.Join(values, "\t"))
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+func writeYAML(w io.Writer, table outputTable) error {
+	//func that writes the table as a yaml list of mappings
+	//strings are written double-quoted, which shares its escaping rules with json, and other values as plain scalars
+	if len(table.rows) == 0 {
+		_, err := io.WriteString(w, "[]\n")
+		return err
+	}
+	var b strings.Builder
+	for _, row := range table.rows {
+		for j, column := range table.columns {
+			if j == 0 {
+				b.WriteString("- ")
+			} else {
+				b.WriteString("  ")
+			}
+			b.WriteString(column)
+			b.WriteString(": ")
+			b.WriteString(jsonValue(row[j]))
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func textValues(row []any) []string {
+	//func that turns a row into text for csv and tsv, where null is an empty field
+	values := make([]string, len(row))
+	for i, value := range row {
+		switch value := value.(type) {
+		case nil:
+		case string:
+			values[i] = value
+		case bool:
+			values[i] = strconv.FormatBool(value)
+		case int64:
+			values[i] = strconv.FormatInt(value, 10)
+		default:
+			values[i] = fmt.Sprint(value)
+		}
+	}
+	return values
+}
+
+func jsonValue(value any) string {
+	//func that writes a value as json, which is also how yaml reads it
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return jsonQuote(value)
+	case bool:
+		return strconv.FormatBool(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	}
+	return jsonQuote(fmt.Sprint(value))
+}
+
+func jsonQuote(value string) string {
+	//func that quotes a string as json without escaping html characters
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func nullTime(t sql.NullTime) any {
+	//func that returns a nullable time as a table value
+	if !t.Valid {
+		return nil
+	}
+	return formatTime(t.Time)
+}
+
+func nullString(s sql.NullString) any {
+	if !s.Valid {
+		return nil
+	}
+	return s.String
+}
+
+func nullInt32(n sql.NullInt32) any {
+	if !n.Valid {
+		return nil
+	}
+	return int64(n.Int32)
+}
+
+func nullInt64(n sql.NullInt64) any {
+	if !n.Valid {
+		return nil
+	}
+	return n.Int64
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const maxTextWidth = 100
+
+func showInPager(text string) error {
+	//func that prints text through $PAGER (less by default) when stdout is a terminal, and straight to stdout otherwise
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Print(text)
+		return nil
+	}
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less"}
+	}
+	path, err := exec.LookPath(pager[0])
+	if err != nil {
+		//no pager installed, so just print it
+		fmt.Print(text)
+		return nil
+	}
+
+	cmd := exec.Command(path, pager[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if os.Getenv("LESS") == "" {
+		//like git: quit if it fits on one screen, keep colors and don't clear the screen on exit
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("could not run pager %s: %w", pager[0], err)
+	}
+	return nil
+}
+
+func terminalWidth() int {
+	//func that returns the width to wrap text to, which is the terminal's width up to maxTextWidth
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		return 80
+	}
+	return min(width-1, maxTextWidth)
+}
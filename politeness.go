@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUserAgent       = "gator-rss-aggregator/1.0 (+https://github.com/joncaudill/gator)"
+	defaultHostInterval    = 2 * time.Second
+	defaultHostConcurrency = 1
+	maxRetryAfter          = 24 * time.Hour
+)
+
+var errHostBackingOff = errors.New("host asked us to back off")
+
+type hostLimiter struct {
+	//struct that keeps requests to the same host spaced out and limited in number
+	mu          sync.Mutex
+	interval    time.Duration
+	concurrency int
+	hosts       map[string]*hostState
+}
+
+type hostState struct {
+	//struct that holds what we know about a single host
+	slots      chan struct{}
+	nextAt     time.Time
+	retryAt    time.Time
+	crawlDelay time.Duration
+}
+
+func newHostLimiter(interval time.Duration, concurrency int) *hostLimiter {
+	return &hostLimiter{
+		interval:    interval,
+		concurrency: concurrency,
+		hosts:       make(map[string]*hostState),
+	}
+}
+
+func (l *hostLimiter) host(host string) *hostState {
+	//func that returns the state for a host, creating it the first time it is seen
+	//callers must hold l.mu
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostState{slots: make(chan struct{}, l.concurrency)}
+		l.hosts[host] = h
+	}
+	return h
+}
+
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	//func that waits until a request to host is allowed and returns a func to release it
+	l.mu.Lock()
+	h := l.host(host)
+	l.mu.Unlock()
+
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-h.slots }
+
+	l.mu.Lock()
+	now := time.Now()
+	if h.retryAt.After(now) {
+		retryAt := h.retryAt
+		l.mu.Unlock()
+		release()
+		return nil, fmt.Errorf("%w: %s until %s", errHostBackingOff, host, retryAt.Format(time.RFC1123))
+	}
+	startAt := now
+	if h.nextAt.After(now) {
+		startAt = h.nextAt
+	}
+	interval := l.interval
+	if h.crawlDelay > interval {
+		interval = h.crawlDelay
+	}
+	h.nextAt = startAt.Add(interval)
+	l.mu.Unlock()
+
+	if wait := time.Until(startAt); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+func (l *hostLimiter) backOff(host string, until time.Time) {
+	//func that stops requests to host until the given time
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	h := l.host(host)
+	if until.After(h.retryAt) {
+		h.retryAt = until
+	}
+}
+
+func (l *hostLimiter) setCrawlDelay(host string, delay time.Duration) {
+	//func that records the crawl-delay a host asked for in its robots.txt
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.host(host).crawlDelay = delay
+}
+
+func buildUserAgent(userAgent, contact string) string {
+	//func that returns the User-Agent header sent with every request
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	if contact != "" {
+		userAgent += " contact: " + contact
+	}
+	return userAgent
+}
+
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	//func that parses a Retry-After header, which is either a number of seconds or an http date
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = date.Sub(now)
+	} else {
+		return 0, false
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	return wait, true
+}
+
+func (f *feedFetcher) get(ctx context.Context, requestURL string) (*http.Response, func(), error) {
+	//func that makes a single polite GET request
+	//it checks robots.txt if enabled, waits its turn for the host and honors Retry-After
+	request, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create request: %w", err)
+	}
+	host := strings.ToLower(request.URL.Host)
+
+	if f.robots != nil {
+		allowed, err := f.robots.allowed(ctx, f, request.URL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not check robots.txt: %w", err)
+		}
+		if !allowed {
+			return nil, nil, fmt.Errorf("fetching %s is disallowed by robots.txt", requestURL)
+		}
+	}
+
+	release, err := f.limiter.acquire(ctx, host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//set the request headers
+	request.Header.Set("User-Agent", f.userAgent)
+	request.Header.Set("Accept-Encoding", "gzip, deflate, br")
+
+	response, err := f.client.Do(request)
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("could not fetch feed: %w", err)
+	}
+	response.Body = countingBody{response.Body}
+
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable {
+		wait, ok := parseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+		if !ok && response.StatusCode == http.StatusTooManyRequests {
+			//no hint from the server, so leave the host alone for a while
+			wait = 10 * f.limiter.interval
+		}
+		if wait > 0 {
+			f.limiter.backOff(host, time.Now().Add(wait))
+		}
+	}
+
+	return response, release, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: "", wantOK: false},
+		{value: "120", want: 2 * time.Minute, wantOK: true},
+		{value: " 5 ", want: 5 * time.Second, wantOK: true},
+		{value: "0", want: 0, wantOK: true},
+		{value: "-10", want: 0, wantOK: true},
+		{value: "999999999", want: maxRetryAfter, wantOK: true},
+		{value: "Wed, 01 May 2024 12:05:00 GMT", want: 5 * time.Minute, wantOK: true},
+		{value: "Wed, 01 May 2024 11:00:00 GMT", want: 0, wantOK: true},
+		{value: "Fri, 01 May 2026 12:00:00 GMT", want: maxRetryAfter, wantOK: true},
+		{value: "soon", wantOK: false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/joncaudill/gator/internal/database"
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/net/html"
+)
+
+const (
+	//how long the plain text summary stored with each post may be, in characters
+	summaryLength = 200
+)
+
+type textBlock struct {
+	//a paragraph of rendered text, with the prefix of its first line (e.g. a list bullet or "> ")
+	//and the indent of the lines after it
+	prefix   string
+	indent   string
+	text     strings.Builder
+	pre      bool
+	listItem bool
+}
+
+type listState struct {
+	ordered bool
+	n       int
+}
+
+type htmlRenderer struct {
+	//struct that turns html into blocks of text, collecting links as footnotes when footnotes is set
+	footnotes  bool
+	blocks     []*textBlock
+	current    *textBlock
+	lists      []listState
+	quoteDepth int
+	pre        int
+	skip       int
+	links      []string
+	linkNums   map[string]int
+	//the open <a>: its href and where its text starts in linkBlock
+	href      string
+	linkBlock *textBlock
+	linkStart int
+}
+
+func renderHTML(s string, width int) string {
+	//func that renders the html of a description as readable text wrapped to width columns
+	//paragraphs are separated by blank lines, lists get bullets, quotes get "> " and links become numbered footnotes
+	r := &htmlRenderer{footnotes: true, linkNums: make(map[string]int)}
+	r.parse(s)
+
+	var out []string
+	prevListItem := false
+	for _, block := range r.blocks {
+		lines := block.lines(width)
+		if len(lines) == 0 {
+			continue
+		}
+		if len(out) > 0 && !(block.listItem && prevListItem) {
+			out = append(out, "")
+		}
+		out = append(out, lines...)
+		prevListItem = block.listItem
+	}
+	if len(r.links) > 0 {
+		out = append(out, "")
+		for i, link := range r.links {
+			out = append(out, fmt.Sprintf("[%d] %s", i+1, link))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func summarizeHTML(s string) string {
+	//func that returns a short one line plain text summary of the html of a description, for listings
+	return truncateWords(plainTextHTML(s), summaryLength)
+}
+
+func plainTextHTML(s string) string {
+	//func that returns all of the text of some html on one line, which is what rules match against
+	r := &htmlRenderer{linkNums: make(map[string]int)}
+	r.parse(s)
+	var parts []string
+	for _, block := range r.blocks {
+		if text := singleLine(block.text.String()); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (r *htmlRenderer) parse(s string) {
+	//func that walks the html tokens, filling in the blocks
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			r.endBlock()
+			return
+		}
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.TextToken:
+			r.text(token.Data)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			r.startTag(token, tokenType == html.SelfClosingTagToken)
+		case html.EndTagToken:
+			r.endTag(token)
+		}
+	}
+}
+
+func (r *htmlRenderer) startTag(token html.Token, selfClosing bool) {
+	if skippedElements[token.Data] {
+		if !selfClosing {
+			r.skip++
+		}
+		return
+	}
+	if r.skip > 0 {
+		return
+	}
+	switch token.Data {
+	case "br":
+		if r.current != nil {
+			r.current.text.WriteString("\n")
+		}
+	case "a":
+		r.href = attr(token, "href")
+		r.linkBlock = r.block()
+		r.linkStart = r.linkBlock.text.Len()
+	case "img":
+		if alt := singleLine(attr(token, "alt")); alt != "" {
+			r.text(" [image: " + alt + "] ")
+		}
+	case "blockquote":
+		r.endBlock()
+		r.quoteDepth++
+	case "pre":
+		r.endBlock()
+		r.pre++
+		r.block().pre = true
+	case "ul", "ol":
+		r.endBlock()
+		list := listState{ordered: token.Data == "ol"}
+		if start, err := strconv.Atoi(attr(token, "start")); err == nil && list.ordered {
+			list.n = start - 1
+		}
+		r.lists = append(r.lists, list)
+	case "li":
+		r.endBlock()
+		if len(r.lists) == 0 {
+			r.lists = append(r.lists, listState{})
+		}
+		list := &r.lists[len(r.lists)-1]
+		list.n++
+		bullet := "- "
+		if list.ordered {
+			bullet = strconv.Itoa(list.n) + ". "
+		}
+		block := r.block()
+		block.prefix = r.quotePrefix() + strings.Repeat("  ", len(r.lists)-1) + bullet
+		block.indent = r.quotePrefix() + strings.Repeat("  ", len(r.lists)-1) + strings.Repeat(" ", len(bullet))
+		block.listItem = true
+	case "td", "th":
+		r.text(" ")
+	default:
+		if blockElements[token.Data] {
+			r.endBlock()
+		}
+	}
+}
+
+func (r *htmlRenderer) endTag(token html.Token) {
+	if skippedElements[token.Data] {
+		if r.skip > 0 {
+			r.skip--
+		}
+		return
+	}
+	if r.skip > 0 {
+		return
+	}
+	switch token.Data {
+	case "a":
+		r.endLink()
+	case "blockquote":
+		r.endBlock()
+		if r.quoteDepth > 0 {
+			r.quoteDepth--
+		}
+	case "pre":
+		r.endBlock()
+		if r.pre > 0 {
+			r.pre--
+		}
+	case "ul", "ol":
+		r.endBlock()
+		if len(r.lists) > 0 {
+			r.lists = r.lists[:len(r.lists)-1]
+		}
+	case "li":
+		r.endBlock()
+	case "td", "th":
+		r.text(" ")
+	default:
+		if blockElements[token.Data] {
+			r.endBlock()
+		}
+	}
+}
+
+func (r *htmlRenderer) endLink() {
+	//func that adds a footnote for the link that just ended, unless its text already is the url
+	href := r.href
+	r.href = ""
+	if !r.footnotes || r.linkBlock == nil || !isWebURL(href) {
+		return
+	}
+	linkText := strings.TrimSpace(r.linkBlock.text.String()[r.linkStart:])
+	if linkText == href {
+		return
+	}
+	n, ok := r.linkNums[href]
+	if !ok {
+		r.links = append(r.links, href)
+		n = len(r.links)
+		r.linkNums[href] = n
+	}
+	r.linkBlock.text.WriteString(fmt.Sprintf("[%d]", n))
+}
+
+func (r *htmlRenderer) text(s string) {
+	if r.skip > 0 || s == "" {
+		return
+	}
+	if r.current == nil && strings.TrimSpace(s) == "" {
+		//whitespace between blocks
+		return
+	}
+	block := r.block()
+	if block.pre {
+		block.text.WriteString(s)
+		return
+	}
+	writeText(&block.text, s)
+}
+
+func (r *htmlRenderer) block() *textBlock {
+	//func that returns the block text is going into, starting a new one if needed
+	if r.current == nil {
+		indent := r.quotePrefix() + strings.Repeat("  ", len(r.lists))
+		r.current = &textBlock{prefix: indent, indent: indent, pre: r.pre > 0}
+		r.blocks = append(r.blocks, r.current)
+	}
+	return r.current
+}
+
+func (r *htmlRenderer) endBlock() {
+	r.current = nil
+}
+
+func (r *htmlRenderer) quotePrefix() string {
+	return strings.Repeat("> ", r.quoteDepth)
+}
+
+func (b *textBlock) lines(width int) []string {
+	//func that returns the lines of a block, wrapped to width columns including its prefix
+	//a width of 0 or less means no wrapping
+	text := b.text.String()
+	var lines []string
+	if b.pre {
+		text = strings.Trim(text, "\n")
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	} else {
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		available := 0
+		if width > 0 {
+			available = max(width-runewidth.StringWidth(b.indent), 20)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+			line = strings.TrimSpace(line)
+			if available > 0 {
+				lines = append(lines, wrapText(line, available)...)
+			} else {
+				lines = append(lines, line)
+			}
+		}
+	}
+	for i := range lines {
+		if i == 0 {
+			lines[i] = b.prefix + lines[i]
+		} else {
+			lines[i] = b.indent + lines[i]
+		}
+	}
+	return lines
+}
+
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "header": true, "footer": true, "aside": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"table": true, "tr": true, "figure": true, "figcaption": true, "dl": true, "dt": true, "dd": true, "hr": true,
+}
+
+var skippedElements = map[string]bool{
+	//elements whose contents are never shown
+	"script": true, "style": true, "noscript": true, "iframe": true, "object": true, "embed": true,
+	"svg": true, "math": true, "template": true, "head": true, "title": true, "select": true, "textarea": true,
+}
+
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+func isWebURL(s string) bool {
+	lower := strings.ToLower(s)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+func writeText(b *strings.Builder, text string) {
+	//func that writes a run of text with its whitespace collapsed,
+	//keeping the space between words split across tags, e.g. "a <b>bold</b> word"
+	if text == "" {
+		return
+	}
+	spaceBefore := strings.TrimLeft(text, " \t\r\n") != text
+	spaceAfter := strings.TrimRight(text, " \t\r\n") != text
+	words := strings.Join(strings.Fields(text), " ")
+	written := b.String()
+	if spaceBefore && written != "" && !strings.HasSuffix(written, " ") && !strings.HasSuffix(written, "\n") {
+		b.WriteString(" ")
+	}
+	b.WriteString(words)
+	if spaceAfter && words != "" {
+		b.WriteString(" ")
+	}
+}
+
+func truncateWords(s string, n int) string {
+	//func that cuts s down to at most n characters, at a word boundary when there is one, adding "…" if it was cut
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	cut := string(runes[:n-1])
+	if i := strings.LastIndex(cut, " "); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " .,;:") + "…"
+}
+
+func wrapText(s string, width int) []string {
+	//func that wraps plain text to lines of at most width columns, breaking words that are longer than a line
+	if width < 1 {
+		width = 1
+	}
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for runewidth.StringWidth(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				head := runewidth.Truncate(word, width, "")
+				if head == "" {
+					//a single rune wider than the line
+					_, size := utf8.DecodeRuneInString(word)
+					head = word[:size]
+				}
+				lines = append(lines, head)
+				word = word[len(head):]
+			}
+			if word == "" {
+				continue
+			}
+			switch {
+			case line == "":
+				line = word
+			case runewidth.StringWidth(line)+1+runewidth.StringWidth(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func renderPost(post database.Post, feedName string, categories []string, episode *database.Episode, width int) string {
+	//func that renders a post as readable text: a header with the title, feed, date, author and links, then the body
+	var b strings.Builder
+	for _, line := range wrapText(singleLine(post.Title), width) {
+		b.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&b, "#%d · %s · %s\n", post.ShortID, feedName, post.PublishedAt.Format("Mon, 02 Jan 2006 15:04"))
+	if byline := postByline(post, categories); byline != "" {
+		b.WriteString(byline + "\n")
+	}
+	b.WriteString(post.Url + "\n")
+	if post.EnclosureUrl != "" {
+		b.WriteString("enclosure: " + postEnclosure(post) + "\n")
+	}
+	if episode != nil {
+		if summary := episodeSummary(*episode); summary != "" {
+			b.WriteString("episode: " + summary + "\n")
+		}
+		if episode.ImageUrl != "" {
+			b.WriteString("image: " + episode.ImageUrl + "\n")
+		}
+	}
+	if post.CommentsUrl != "" {
+		b.WriteString("comments: " + post.CommentsUrl + "\n")
+	}
+	b.WriteString("\n" + renderHTML(postBody(post), width) + "\n")
+	return b.String()
+}
+
+func postBody(post database.Post) string {
+	//func that returns the html to show for a post: the article fetched from its page if there is one,
+	//then the full content when the feed has it, then the description
+	if strings.TrimSpace(post.FullContent) != "" {
+		return post.FullContent
+	}
+	if strings.TrimSpace(post.Content) != "" {
+		return post.Content
+	}
+	return post.Description
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestRenderHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "paragraphs are wrapped and separated",
+			in:   `<p>One two three four five six seven eight nine ten.</p><p>Second para.</p>`,
+			want: "One two three four\nfive six seven eight\nnine ten.\n\nSecond para.",
+		},
+		{name: "bullet list", in: `<ul><li>a</li><li>b</li></ul>`, want: "- a\n- b"},
+		{name: "numbered list", in: `<ol><li>a</li><li>b</li></ol>`, want: "1. a\n2. b"},
+		{name: "quote", in: `<blockquote><p>quoted</p></blockquote>`, want: "> quoted"},
+		{
+			name: "links become footnotes, one per url",
+			in:   `<p>see <a href="https://example.com">this</a> and <a href="https://example.com">again</a></p>`,
+			want: "see this[1] and\nagain[1]\n\n[1] https://example.com",
+		},
+		{name: "preformatted text is kept", in: "<pre>  code\n  more</pre>", want: "  code\n  more"},
+		{name: "entities are decoded", in: `a &amp; b`, want: "a & b"},
+		{name: "scripts are left out", in: `<script>x</script>visible`, want: "visible"},
+	}
+	for _, tt := range tests {
+		if got := renderHTML(tt.in, 20); got != tt.want {
+			t.Errorf("%s: renderHTML(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
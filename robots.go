@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	robotsCacheTTL      = 24 * time.Hour
+	robotsErrorCacheTTL = time.Hour
+	robotsMaxBytes      = 500 << 10
+	robotsProductToken  = "gator"
+	//RFC 9309 asks crawlers to follow at least five redirects for robots.txt
+	robotsMaxRedirects = 5
+	//requests to a host wait in line for its crawl-delay, which holds up the aggregator loop,
+	//so a longer delay is cut down to this
+	robotsMaxCrawlDelay = time.Minute
+)
+
+type robotsCache struct {
+	//struct that caches the parsed robots.txt of each host
+	mu      sync.Mutex
+	entries map[string]robotsEntry
+}
+
+type robotsEntry struct {
+	rules     robotsRules
+	expiresAt time.Time
+}
+
+type robotsRules struct {
+	//the allow and disallow rules that apply to gator, plus the crawl-delay if one was given
+	disallowAll bool
+	rules       []robotsRule
+	crawlDelay  time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{entries: make(map[string]robotsEntry)}
+}
+
+func (c *robotsCache) allowed(ctx context.Context, f *feedFetcher, u *url.URL) (bool, error) {
+	//func that reports whether robots.txt lets gator fetch the given url
+	if u.Path == "/robots.txt" {
+		return true, nil
+	}
+	host := strings.ToLower(u.Host)
+
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		rules, ttl, err := fetchRobots(ctx, f, u.Scheme+"://"+u.Host+"/robots.txt")
+		if err != nil {
+			return false, err
+		}
+		entry = robotsEntry{rules: rules, expiresAt: time.Now().Add(ttl)}
+		c.mu.Lock()
+		c.entries[host] = entry
+		c.mu.Unlock()
+		f.limiter.setCrawlDelay(host, rules.crawlDelay)
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return entry.rules.allowed(path), nil
+}
+
+func fetchRobots(ctx context.Context, f *feedFetcher, robotsURL string) (robotsRules, time.Duration, error) {
+	//func that downloads and parses a robots.txt file
+	//following RFC 9309, redirects are followed, a missing file allows everything and a server error disallows everything
+	//a request that gets no response at all returns its error, so nothing is cached and it is tried again on the next fetch
+	requestURL := robotsURL
+	var response *http.Response
+	var release func()
+	for redirects := 0; ; redirects++ {
+		var err error
+		response, release, err = f.get(ctx, requestURL)
+		if err != nil {
+			return robotsRules{}, 0, err
+		}
+		location := response.Header.Get("Location")
+		if response.StatusCode < 300 || response.StatusCode > 399 || location == "" {
+			break
+		}
+		response.Body.Close()
+		release()
+
+		//past the redirect limit the file counts as unavailable, which allows everything
+		if redirects >= robotsMaxRedirects {
+			return robotsRules{}, robotsCacheTTL, nil
+		}
+		nextURL, err := response.Request.URL.Parse(location)
+		if err != nil {
+			return robotsRules{}, robotsCacheTTL, nil
+		}
+		requestURL = nextURL.String()
+	}
+	defer release()
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode <= 299:
+	case response.StatusCode >= 400 && response.StatusCode <= 499 && response.StatusCode != http.StatusTooManyRequests:
+		return robotsRules{}, robotsCacheTTL, nil
+	default:
+		return robotsRules{disallowAll: true}, robotsErrorCacheTTL, nil
+	}
+
+	body, err := readBody(response, robotsMaxBytes)
+	if err != nil {
+		return robotsRules{}, 0, fmt.Errorf("could not read robots.txt: %w", err)
+	}
+	return parseRobots(body, robotsProductToken), robotsCacheTTL, nil
+}
+
+func robotsAgentToken(agent string) string {
+	//func that returns the product token a user-agent line names, e.g. "gator" for "Gator/1.0"
+	//the token is the leading run of letters, "-" and "_", lowercased as the match is case-insensitive
+	agent = strings.ToLower(strings.TrimSpace(agent))
+	end := strings.IndexFunc(agent, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z') && r != '-' && r != '_'
+	})
+	if end >= 0 {
+		agent = agent[:end]
+	}
+	return agent
+}
+
+func parseRobots(body []byte, product string) robotsRules {
+	//func that returns the rules from a robots.txt that apply to product
+	//the groups naming product are used if there are any, otherwise the "*" groups are
+	var matched, wildcard robotsRules
+	foundMatched := false
+	product = strings.ToLower(product)
+
+	var agents []string
+	inRules := false
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			//a user-agent line after rules starts a new group
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			if value == "*" {
+				agents = append(agents, value)
+			} else if token := robotsAgentToken(value); token != "" {
+				agents = append(agents, token)
+			}
+			continue
+		}
+		if key != "allow" && key != "disallow" && key != "crawl-delay" {
+			continue
+		}
+		inRules = true
+
+		for _, agent := range agents {
+			var target *robotsRules
+			switch {
+			case agent == "*":
+				target = &wildcard
+			case agent == product:
+				target = &matched
+				foundMatched = true
+			default:
+				continue
+			}
+			switch key {
+			case "crawl-delay":
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					target.crawlDelay = min(time.Duration(seconds*float64(time.Second)), robotsMaxCrawlDelay)
+				}
+			default:
+				//an empty disallow means everything is allowed
+				if value != "" {
+					target.rules = append(target.rules, robotsRule{allow: key == "allow", pattern: value})
+				}
+			}
+		}
+	}
+
+	if foundMatched {
+		return matched
+	}
+	return wildcard
+}
+
+func (r robotsRules) allowed(path string) bool {
+	//func that applies the most specific matching rule, with allow winning ties
+	if r.disallowAll {
+		return false
+	}
+	allowed := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			longest = len(rule.pattern)
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+func robotsMatch(pattern, path string) bool {
+	//func that matches a robots.txt path pattern, which supports * wildcards and a trailing $ anchor
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	if anchored && len(parts) == 1 {
+		return rest == ""
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		allowed map[string]bool
+		delay   time.Duration
+	}{
+		{
+			name:    "empty",
+			body:    "",
+			allowed: map[string]bool{"/": true, "/feed": true},
+		},
+		{
+			name:    "wildcard group",
+			body:    "User-agent: *\nDisallow: /private\n",
+			allowed: map[string]bool{"/feed": true, "/private": false, "/private/feed": false},
+		},
+		{
+			name:    "own group wins over wildcard",
+			body:    "User-agent: *\nDisallow: /\n\nUser-agent: Gator/2.0\nDisallow: /private\nCrawl-delay: 5\n",
+			allowed: map[string]bool{"/feed": true, "/private": false},
+			delay:   5 * time.Second,
+		},
+		{
+			name:    "agent is matched case-insensitively on the whole token",
+			body:    "User-agent: GATOR\nDisallow: /a\n\nUser-agent: gatorbot\nDisallow: /b\n",
+			allowed: map[string]bool{"/a": false, "/b": true},
+		},
+		{
+			name:    "empty and punctuation-only agents are skipped",
+			body:    "User-agent:\nUser-agent: /1.0\nDisallow: /\n",
+			allowed: map[string]bool{"/": true, "/feed": true},
+		},
+		{
+			name:    "agents sharing a group",
+			body:    "User-agent: other\nUser-agent: gator\nDisallow: /x\n",
+			allowed: map[string]bool{"/x": false, "/y": true},
+		},
+		{
+			name:    "long crawl-delays are capped",
+			body:    "User-agent: *\nCrawl-delay: 86400\n",
+			allowed: map[string]bool{"/": true},
+			delay:   robotsMaxCrawlDelay,
+		},
+		{
+			name:    "fractional crawl-delay",
+			body:    "User-agent: *\nCrawl-delay: 0.5\n",
+			allowed: map[string]bool{"/": true},
+			delay:   500 * time.Millisecond,
+		},
+		{
+			name:    "empty disallow allows everything",
+			body:    "User-agent: gator\nDisallow:\n",
+			allowed: map[string]bool{"/": true},
+		},
+		{
+			name:    "longest match wins, allow wins ties",
+			body:    "User-agent: *\nDisallow: /a\nAllow: /a/b\nDisallow: /c\nAllow: /c\n",
+			allowed: map[string]bool{"/a/x": false, "/a/b/x": true, "/c": true},
+		},
+		{
+			name:    "comments are ignored",
+			body:    "# robots\nUser-agent: * # everyone\nDisallow: /tmp # scratch\n",
+			allowed: map[string]bool{"/tmp/x": false, "/feed": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots([]byte(tt.body), robotsProductToken)
+			for path, want := range tt.allowed {
+				if got := rules.allowed(path); got != want {
+					t.Errorf("allowed(%q) = %v, want %v", path, got, want)
+				}
+			}
+			if rules.crawlDelay != tt.delay {
+				t.Errorf("crawlDelay = %v, want %v", rules.crawlDelay, tt.delay)
+			}
+		})
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/anything", true},
+		{"/feed", "/feed.xml", true},
+		{"/feed", "/fee", false},
+		{"/feed$", "/feed", true},
+		{"/feed$", "/feed/", false},
+		{"/*.xml", "/a/b.xml", true},
+		{"/*.xml", "/a/b.html", false},
+		{"/*.xml$", "/a/b.xml?x=1", false},
+		{"/a*b*c", "/a-b-c", true},
+		{"/a*b*c", "/a-c-b", false},
+		{"*", "/x", true},
+		{"/*", "/x", true},
+	}
+	for _, tt := range tests {
+		if got := robotsMatch(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/gator/internal/database"
+)
+
+var (
+	//what a rule can do to the posts it matches, and what it matches them on
+	ruleActions = []string{"mute", "highlight", "read", "star"}
+	ruleFields  = []string{"keyword", "regex", "author", "category", "feed"}
+)
+
+func handlerAddRule(s *state, cmd command, user database.User) error {
+	//func that adds a filter rule for the current user
+	//mute and highlight rules apply to every post when posts are listed, read and star rules to new posts as agg stores them
+	action, field := cmd.args[0], cmd.args[1]
+	pattern := ""
+	if len(cmd.args) > 2 {
+		pattern = strings.TrimSpace(cmd.args[2])
+	}
+	if !slices.Contains(ruleActions, action) {
+		return &usageError{command: cmd.def, msg: fmt.Sprintf("addrule: unknown action %q, use one of %s", action, strings.Join(ruleActions, ", "))}
+	}
+	if !slices.Contains(ruleFields, field) {
+		return &usageError{command: cmd.def, msg: fmt.Sprintf("addrule: unknown match %q, use one of %s", field, strings.Join(ruleFields, ", "))}
+	}
+
+	feedURL := cmd.flag("feed")
+	if field == "feed" {
+		//the feed to match is given as the pattern or with --feed
+		if pattern != "" && feedURL != "" {
+			return &usageError{command: cmd.def, msg: "addrule: give the feed url once, as the pattern or with --feed"}
+		}
+		if pattern != "" {
+			feedURL, pattern = pattern, ""
+		}
+		if feedURL == "" {
+			return &usageError{command: cmd.def, msg: "addrule: missing feed url"}
+		}
+	} else if pattern == "" {
+		return &usageError{command: cmd.def, msg: "addrule: missing pattern"}
+	}
+
+	if field == "regex" {
+		//rules are matched by the database, so the regex has to make sense to postgres
+		_, err := s.db.CheckRegex(context.Background(), pattern)
+		if err != nil {
+			return &usageError{command: cmd.def, msg: fmt.Sprintf("addrule: invalid regex %q: %v", pattern, err)}
+		}
+	}
+
+	feedID := uuid.NullUUID{}
+	if feedURL != "" {
+		feed, err := getFeedByURL(s, feedURL)
+		if err != nil {
+			return err
+		}
+		feedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	rule, err := s.db.CreateFilterRule(context.Background(), database.CreateFilterRuleParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		FeedID:    feedID,
+		Field:     field,
+		Pattern:   pattern,
+		Action:    action,
+	})
+	if err != nil {
+		return dbError(err, "could not add rule")
+	}
+	fmt.Printf("added rule %d: %s\n", rule.ShortID, describeRule(rule.Action, rule.Field, rule.Pattern, feedURL))
+	return nil
+}
+
+func handlerRules(s *state, cmd command, user database.User) error {
+	//func that lists the filter rules of the current user
+	rules, err := s.db.GetFilterRulesForUser(context.Background(), user.ID)
+	if err != nil {
+		return dbError(err, "could not get rules")
+	}
+
+	if s.output != outputText {
+		table := outputTable{columns: []string{"id", "action", "match", "pattern", "feed_url", "created_at"}}
+		for _, rule := range rules {
+			table.add(rule.ShortID,
+				rule.Action,
+				rule.Field,
+				rule.Pattern,
+				nullString(rule.FeedUrl),
+				formatTime(rule.CreatedAt))
+		}
+		return writeTable(s, table)
+	}
+
+	if len(rules) == 0 {
+		fmt.Println("No rules yet, add one with \"gator addrule\".")
+		return nil
+	}
+	fmt.Println("Rules:")
+	for _, rule := range rules {
+		fmt.Printf("* [%d] %s\n", rule.ShortID, describeRule(rule.Action, rule.Field, rule.Pattern, rule.FeedName.String))
+	}
+	return nil
+}
+
+func handlerDeleteRule(s *state, cmd command, user database.User) error {
+	//func that deletes one of the current user's filter rules by the id shown by "gator rules"
+	shortID, err := strconv.ParseInt(strings.TrimPrefix(cmd.args[0], "#"), 10, 64)
+	if err != nil || shortID < 1 {
+		return &usageError{command: cmd.def, msg: fmt.Sprintf("deleterule: invalid rule id %q, use the number shown by \"gator rules\"", cmd.args[0])}
+	}
+	deleted, err := s.db.DeleteFilterRule(context.Background(), database.DeleteFilterRuleParams{UserID: user.ID, ShortID: shortID})
+	if err != nil {
+		return dbError(err, "could not delete rule %d", shortID)
+	}
+	if deleted == 0 {
+		return notFoundError("rule %d not found", shortID)
+	}
+	fmt.Printf("deleted rule %d\n", shortID)
+	return nil
+}
+
+func describeRule(action, field, pattern, feed string) string {
+	//func that describes a rule in words, e.g. `mute posts with keyword "sponsored" in Boot.dev Blog`
+	var b strings.Builder
+	switch action {
+	case "read":
+		b.WriteString("mark read")
+	default:
+		b.WriteString(action)
+	}
+	if field == "feed" {
+		fmt.Fprintf(&b, " every post in %s", feed)
+		return b.String()
+	}
+	switch field {
+	case "regex":
+		fmt.Fprintf(&b, " posts matching /%s/", pattern)
+	case "author":
+		fmt.Fprintf(&b, " posts by %q", pattern)
+	default:
+		fmt.Fprintf(&b, " posts with %s %q", field, pattern)
+	}
+	if feed != "" {
+		fmt.Fprintf(&b, " in %s", feed)
+	}
+	return b.String()
+}
+
+func completeRuleActions(s *state) ([]string, error) {
+	return ruleActions, nil
+}
+
+func completeRuleFields(s *state) ([]string, error) {
+	return ruleFields, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var allowedElements = map[string][]string{
+	//elements kept by sanitizeHTML, with the attributes each may keep
+	"a": {"href", "title"}, "abbr": {"title"}, "b": nil, "blockquote": {"cite"}, "br": nil, "code": nil,
+	"dd": nil, "del": nil, "div": nil, "dl": nil, "dt": nil, "em": nil, "figcaption": nil, "figure": nil,
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil, "hr": nil, "i": nil,
+	"img": {"src", "alt", "title", "width", "height"}, "ins": nil, "li": nil, "ol": {"start"}, "p": nil,
+	"pre": nil, "q": {"cite"}, "s": nil, "small": nil, "span": nil, "strong": nil, "sub": nil, "sup": nil,
+	"table": nil, "tbody": nil, "td": {"colspan", "rowspan"}, "tfoot": nil, "th": {"colspan", "rowspan"},
+	"thead": nil, "tr": nil, "u": nil, "ul": nil,
+}
+
+func sanitizeHTML(s string) string {
+	//func that cleans up the html of a description before it is stored
+	//elements in skippedElements are dropped along with their contents, other elements that are not in
+	//allowedElements are dropped but keep their contents, and only the allowed attributes are kept,
+	//with links and image sources limited to http, https, mailto and relative urls
+	var b strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	skip := 0
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return strings.TrimSpace(b.String())
+		}
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(html.EscapeString(token.Data))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			if skippedElements[token.Data] {
+				if tokenType == html.StartTagToken {
+					skip++
+				} else if tokenType == html.EndTagToken && skip > 0 {
+					skip--
+				}
+				continue
+			}
+			allowedAttrs, ok := allowedElements[token.Data]
+			if skip > 0 || !ok {
+				continue
+			}
+			var attrs []html.Attribute
+			for _, a := range token.Attr {
+				if a.Namespace != "" || !slices.Contains(allowedAttrs, a.Key) {
+					continue
+				}
+				if (a.Key == "href" || a.Key == "src" || a.Key == "cite") && !isSafeURL(a.Val) {
+					continue
+				}
+				attrs = append(attrs, html.Attribute{Key: a.Key, Val: a.Val})
+			}
+			token.Attr = attrs
+			b.WriteString(token.String())
+		}
+	}
+}
+
+func isSafeURL(s string) bool {
+	//func that reports whether a url may be kept in a link, which rules out schemes such as javascript: and data:
+	s = strings.TrimSpace(s)
+	colon := strings.Index(s, ":")
+	if colon < 0 || strings.ContainsAny(s[:colon], "/?#") {
+		//no scheme, so a relative url
+		return true
+	}
+	switch strings.ToLower(s[:colon]) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
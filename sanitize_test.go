@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "allowed markup is kept", in: `<p>Hello <b>world</b></p>`, want: `<p>Hello <b>world</b></p>`},
+		{name: "scripts are dropped with their contents", in: `<script>alert(1)</script><p>ok</p>`, want: `<p>ok</p>`},
+		{name: "nested skipped elements", in: `<svg><script>x</script></svg>t`, want: `t`},
+		{name: "iframes are dropped", in: `<iframe src="https://example.com"></iframe>after`, want: `after`},
+		{name: "unknown elements keep their text", in: `<style>p{}</style><font color=red>red</font>`, want: `red`},
+		{name: "event handlers are dropped", in: `<p onclick="x()">hi</p>`, want: `<p>hi</p>`},
+		{name: "javascript links are dropped", in: `<a href="javascript:alert(1)">x</a>`, want: `<a>x</a>`},
+		{name: "data image sources are dropped", in: `<img src="data:image/png;base64,xx" alt="a">`, want: `<img alt="a">`},
+		{name: "only allowed attributes are kept", in: `<a href="https://example.com/" target="_blank" title="t">x</a>`, want: `<a href="https://example.com/" title="t">x</a>`},
+		{name: "relative and mailto links", in: `<a href="/rel">r</a><a href="mailto:a@example.com">m</a>`, want: `<a href="/rel">r</a><a href="mailto:a@example.com">m</a>`},
+		{name: "text stays escaped", in: `a &lt;b&gt; &amp; c`, want: `a &lt;b&gt; &amp; c`},
+		{name: "surrounding space is trimmed", in: "  <p>x</p>\n", want: `<p>x</p>`},
+	}
+	for _, tt := range tests {
+		if got := sanitizeHTML(tt.in); got != tt.want {
+			t.Errorf("%s: sanitizeHTML(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
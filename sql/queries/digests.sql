@@ -0,0 +1,51 @@
+-- name: SetUserDigestSettings :one
+UPDATE users SET
+    email = $2,
+    digest_frequency = $3,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUsersDueDigest :many
+-- a little under a day or a week, so a digest does not slip later each time agg runs a bit late
+SELECT * FROM users
+WHERE email <> '' AND digest_frequency <> 'off'
+AND (last_digest_at IS NULL OR last_digest_at <= NOW() - CASE digest_frequency
+    WHEN 'daily' THEN INTERVAL '23 hours'
+    ELSE INTERVAL '167 hours'
+END)
+ORDER BY name;
+
+-- name: GetDigestPosts :many
+SELECT sqlc.embed(posts), feeds.name AS feed_name
+FROM posts
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = $1
+INNER JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = $1
+WHERE post_states.read_at IS NULL
+AND posts.created_at >= sqlc.arg(since)
+AND NOT EXISTS (
+    SELECT 1 FROM digest_posts
+    WHERE digest_posts.user_id = $1 AND digest_posts.post_id = posts.id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.user_id = $1 AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'mute'
+)
+-- a story that came in from several followed feeds is sent once, as its first post
+AND NOT EXISTS (
+    SELECT 1 FROM posts earlier
+    INNER JOIN feed_follows earlier_follows ON earlier_follows.feed_id = earlier.feed_id AND earlier_follows.user_id = $1
+    WHERE COALESCE(earlier.story_id, earlier.id) = COALESCE(posts.story_id, posts.id)
+    AND (earlier.published_at, earlier.id) < (posts.published_at, posts.id)
+)
+ORDER BY feeds.name, posts.published_at DESC
+LIMIT $2;
+
+-- name: RecordDigestSent :exec
+WITH sent AS (
+    INSERT INTO digest_posts (user_id, post_id)
+    SELECT sqlc.arg(user_id)::uuid, unnest(sqlc.arg(post_ids)::uuid[])
+    ON CONFLICT DO NOTHING
+)
+UPDATE users SET last_digest_at = NOW() WHERE id = sqlc.arg(user_id)::uuid;
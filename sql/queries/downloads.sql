@@ -0,0 +1,21 @@
+-- name: StartDownload :exec
+INSERT INTO downloads (id, created_at, updated_at, user_id, post_id, path)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (user_id, post_id) DO UPDATE SET
+    path = EXCLUDED.path,
+    completed_at = NULL,
+    updated_at = NOW();
+
+-- name: CompleteDownload :exec
+UPDATE downloads SET bytes = $3, completed_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: GetDownload :one
+SELECT * FROM downloads WHERE user_id = $1 AND post_id = $2;
@@ -0,0 +1,32 @@
+-- name: UpsertEpisode :exec
+INSERT INTO episodes (id, created_at, updated_at, post_id, duration_seconds, episode, season, image_url, explicit)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+ON CONFLICT (post_id) DO UPDATE SET
+    duration_seconds = EXCLUDED.duration_seconds,
+    episode = EXCLUDED.episode,
+    season = EXCLUDED.season,
+    image_url = EXCLUDED.image_url,
+    explicit = EXCLUDED.explicit,
+    updated_at = NOW();
+
+-- name: GetEpisodeForPost :one
+SELECT * FROM episodes WHERE post_id = $1;
+
+-- name: GetFeedEpisodes :many
+SELECT sqlc.embed(posts), feeds.name AS feed_name,
+    (downloads.completed_at IS NOT NULL)::boolean AS downloaded
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN downloads ON downloads.post_id = posts.id AND downloads.user_id = $1
+WHERE posts.feed_id = $2 AND posts.enclosure_url <> ''
+ORDER BY posts.published_at DESC;
@@ -22,7 +22,7 @@ INNER JOIN users ON inserted_feed_follow.user_id = users.id;
 DELETE FROM feed_follows WHERE user_id = $1 AND feed_id = $2;
 
 -- name: GetFeedFollowsForUser :many
-SELECT ff.id, ff.created_at, feeds.name AS feed_name, users.name AS user_name
+SELECT ff.id, ff.created_at, ff.feed_id, feeds.name AS feed_name, feeds.url AS feed_url, users.name AS user_name
 FROM feed_follows ff
 INNER JOIN feeds ON ff.feed_id = feeds.id
 INNER JOIN users ON ff.user_id = users.id
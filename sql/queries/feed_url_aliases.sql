@@ -0,0 +1,12 @@
+-- name: CreateFeedUrlAlias :exec
+INSERT INTO feed_url_aliases (id, created_at, url, url_key, feed_id)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+ON CONFLICT (url_key) DO UPDATE SET
+    url = EXCLUDED.url,
+    feed_id = EXCLUDED.feed_id;
@@ -1,12 +1,17 @@
 -- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, description, site_link, language, image_url, url_key)
 VALUES (
     $1,
     $2,
     $3,
     $4,
     $5,
-    $6
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11
 )
 RETURNING *;
 
@@ -14,7 +19,27 @@ RETURNING *;
 SELECT * FROM feeds;
 
 -- name: GetFeedByUrl :one
-SELECT * FROM feeds WHERE url = $1;
+SELECT * FROM feeds
+WHERE feeds.url_key = sqlc.arg(url_key)
+    OR feeds.id IN (SELECT feed_id FROM feed_url_aliases WHERE feed_url_aliases.url_key = sqlc.arg(url_key))
+LIMIT 1;
+
+-- name: GetFeedById :one
+SELECT * FROM feeds
+WHERE id = $1;
+
+-- name: UpdateFeedUrl :exec
+UPDATE feeds SET
+    url = $2,
+    url_key = $3,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetFeedFetchFullContent :exec
+UPDATE feeds SET
+    fetch_full_content = $2,
+    updated_at = NOW()
+WHERE id = $1;
 
 -- name: MarkFeedFetched :exec
 UPDATE feeds SET 
@@ -22,11 +47,29 @@ UPDATE feeds SET
     updated_at = NOW()    
 WHERE id = $1;
 
+-- name: SetFeedFetchResult :exec
+UPDATE feeds SET
+    last_fetch_status = $2,
+    last_fetch_error = $3
+WHERE id = $1;
+
 -- name: GetFeedToFetch :one
-SELECT * FROM feeds 
-ORDER BY last_fetched_at ASC NULLS FIRST
+-- feeds a websub hub pushes to are only polled once a day, as a fallback, so the others come first
+SELECT * FROM feeds
+ORDER BY COALESCE(last_fetched_at > NOW() - interval '1 day' AND EXISTS (
+        SELECT 1 FROM websub_subscriptions
+        WHERE websub_subscriptions.feed_id = feeds.id
+            AND websub_subscriptions.status = 'active'
+            AND websub_subscriptions.lease_expires_at > NOW()
+    ), false) ASC,
+    last_fetched_at ASC NULLS FIRST
 LIMIT 1;
 
+-- name: GetFeedFetchLag :one
+SELECT
+    COUNT(*) FILTER (WHERE last_fetched_at IS NULL OR last_fetched_at < sqlc.arg(overdue_before)::timestamp) AS overdue,
+    COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(COALESCE(last_fetched_at, created_at))), 0)::float8 AS lag_seconds
+FROM feeds;
 
 -- name: ResetFeeds :exec
 DELETE FROM feeds;
\ No newline at end of file
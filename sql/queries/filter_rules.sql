@@ -0,0 +1,54 @@
+-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, created_at, updated_at, user_id, feed_id, field, pattern, action)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+RETURNING *;
+
+-- name: GetFilterRulesForUser :many
+SELECT filter_rules.*, feeds.name AS feed_name, feeds.url AS feed_url
+FROM filter_rules
+LEFT JOIN feeds ON filter_rules.feed_id = feeds.id
+WHERE filter_rules.user_id = $1
+ORDER BY filter_rules.short_id;
+
+-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules WHERE user_id = $1 AND short_id = $2;
+
+-- name: CheckRegex :one
+SELECT ''::text ~* sqlc.arg(pattern)::text AS matches;
+
+-- name: ApplyReadRules :exec
+INSERT INTO post_states (id, created_at, updated_at, user_id, post_id, read_at)
+SELECT gen_random_uuid(), NOW(), NOW(), matches.user_id, matches.post_id, NOW()
+FROM (
+    SELECT DISTINCT post_rule_matches.user_id, post_rule_matches.post_id
+    FROM post_rule_matches
+    INNER JOIN posts ON post_rule_matches.post_id = posts.id
+    INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = post_rule_matches.user_id
+    WHERE post_rule_matches.post_id = $1 AND post_rule_matches.action = 'read'
+) matches
+ON CONFLICT (user_id, post_id) DO UPDATE SET
+    read_at = COALESCE(post_states.read_at, EXCLUDED.read_at),
+    updated_at = NOW();
+
+-- name: ApplyStarRules :exec
+INSERT INTO post_states (id, created_at, updated_at, user_id, post_id, starred)
+SELECT gen_random_uuid(), NOW(), NOW(), matches.user_id, matches.post_id, TRUE
+FROM (
+    SELECT DISTINCT post_rule_matches.user_id, post_rule_matches.post_id
+    FROM post_rule_matches
+    INNER JOIN posts ON post_rule_matches.post_id = posts.id
+    INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = post_rule_matches.user_id
+    WHERE post_rule_matches.post_id = $1 AND post_rule_matches.action = 'star'
+) matches
+ON CONFLICT (user_id, post_id) DO UPDATE SET
+    starred = TRUE,
+    updated_at = NOW();
@@ -0,0 +1,17 @@
+-- name: CreatePostCategory :exec
+INSERT INTO post_categories (id, created_at, post_id, name)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3
+)
+ON CONFLICT (post_id, name) DO NOTHING;
+
+-- name: DeletePostCategories :exec
+DELETE FROM post_categories WHERE post_id = $1;
+
+-- name: GetCategoriesForPosts :many
+SELECT post_id, name FROM post_categories
+WHERE post_id = ANY(@post_ids::uuid[])
+ORDER BY post_id, name;
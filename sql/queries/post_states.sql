@@ -0,0 +1,64 @@
+-- name: SetPostRead :exec
+INSERT INTO post_states (id, created_at, updated_at, user_id, post_id, read_at)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (user_id, post_id) DO UPDATE SET
+    read_at = EXCLUDED.read_at,
+    updated_at = NOW();
+
+-- name: SetPostStarred :exec
+INSERT INTO post_states (id, created_at, updated_at, user_id, post_id, starred)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (user_id, post_id) DO UPDATE SET
+    starred = EXCLUDED.starred,
+    updated_at = NOW();
+
+-- name: GetFollowedFeedsWithUnread :many
+SELECT feeds.id, feeds.name, feeds.url,
+    COUNT(posts.id) FILTER (WHERE post_states.read_at IS NULL) AS unread
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+LEFT JOIN posts ON posts.feed_id = feeds.id AND NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.user_id = feed_follows.user_id AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'mute'
+)
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+GROUP BY feeds.id, feeds.name, feeds.url
+ORDER BY feeds.name;
+
+-- name: GetReaderPosts :many
+SELECT sqlc.embed(posts), feeds.name AS feed_name,
+    (post_states.read_at IS NOT NULL)::boolean AS is_read,
+    COALESCE(post_states.starred, FALSE)::boolean AS starred,
+    EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.user_id = $1 AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'highlight'
+    ) AS highlighted
+FROM posts
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = $1
+INNER JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = $1
+WHERE (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+AND NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.user_id = $1 AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'mute'
+)
+ORDER BY posts.published_at DESC
+LIMIT $2;
+
+-- name: GetLastPostUpdate :one
+SELECT COALESCE(MAX(updated_at), 'epoch'::timestamp)::timestamp AS last_update FROM posts;
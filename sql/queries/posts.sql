@@ -1,5 +1,5 @@
 -- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, summary, published_at, feed_id)
 VALUES (
     $1,
     $2,
@@ -8,16 +8,91 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9
 )
 RETURNING *;
 
+-- name: UpsertPost :one
+INSERT INTO posts (id, created_at, updated_at, title, url, description, summary, published_at, feed_id,
+    content, author, guid, comments_url, enclosure_url, enclosure_type, enclosure_length, canonical_url, plain_text)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11,
+    $12,
+    $13,
+    $14,
+    $15,
+    $16,
+    $17,
+    $18
+)
+ON CONFLICT (feed_id, url) DO UPDATE SET
+    title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    summary = EXCLUDED.summary,
+    plain_text = EXCLUDED.plain_text,
+    content = EXCLUDED.content,
+    author = EXCLUDED.author,
+    guid = EXCLUDED.guid,
+    comments_url = EXCLUDED.comments_url,
+    enclosure_url = EXCLUDED.enclosure_url,
+    enclosure_type = EXCLUDED.enclosure_type,
+    enclosure_length = EXCLUDED.enclosure_length,
+    -- the canonical url from the article page wins over the one worked out from the item
+    canonical_url = CASE WHEN posts.full_content_fetched_at IS NULL THEN EXCLUDED.canonical_url ELSE posts.canonical_url END,
+    updated_at = EXCLUDED.updated_at
+WHERE (posts.title, posts.description, posts.content, posts.author, posts.guid, posts.comments_url,
+        posts.enclosure_url, posts.enclosure_type, posts.enclosure_length)
+    IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.description, EXCLUDED.content, EXCLUDED.author, EXCLUDED.guid,
+        EXCLUDED.comments_url, EXCLUDED.enclosure_url, EXCLUDED.enclosure_type, EXCLUDED.enclosure_length)
+RETURNING id, short_id, (xmax = 0)::boolean AS inserted, (full_content_fetched_at IS NOT NULL)::boolean AS full_content_fetched;
+
 -- name: GetPostsForUser :many
-SELECT * FROM posts WHERE feed_id IN (
-    SELECT id FROM feeds WHERE user_id = $1
+SELECT sqlc.embed(posts),
+    EXISTS (
+        SELECT 1 FROM post_rule_matches
+        WHERE post_rule_matches.user_id = $1 AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'highlight'
+    ) AS highlighted
+FROM posts WHERE feed_id IN (
+    SELECT feed_id FROM feed_follows WHERE user_id = $1
+)
+AND (sqlc.arg(include_muted)::boolean OR NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.user_id = $1 AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'mute'
+))
+-- a story that came in from several feeds is shown once, as its first post
+AND NOT EXISTS (
+    SELECT 1 FROM posts earlier
+    WHERE COALESCE(earlier.story_id, earlier.id) = COALESCE(posts.story_id, posts.id)
+    AND earlier.feed_id IN (SELECT feed_id FROM feed_follows WHERE user_id = $1)
+    AND (earlier.published_at, earlier.id) < (posts.published_at, posts.id)
 )
 ORDER BY published_at DESC
 LIMIT $2;
 
+-- name: GetPostByShortId :one
+SELECT sqlc.embed(posts), feeds.name AS feed_name
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = sqlc.arg(user_id)
+WHERE posts.short_id = sqlc.arg(short_id);
+
 -- name: ResetPosts :exec
-DELETE FROM posts;
\ No newline at end of file
+DELETE FROM posts;
+
+-- name: SetPostFullContent :exec
+UPDATE posts SET
+    full_content = $2,
+    canonical_url = CASE WHEN sqlc.arg(canonical_url)::text = '' THEN canonical_url ELSE sqlc.arg(canonical_url)::text END,
+    full_content_fetched_at = NOW()
+WHERE id = $1;
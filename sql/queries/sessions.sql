@@ -0,0 +1,27 @@
+-- name: CreateSession :exec
+INSERT INTO sessions (id, user_id, token_hash, expires_at)
+VALUES ($1, $2, $3, NOW() + make_interval(secs => sqlc.arg(lifetime_seconds)::integer));
+
+-- name: GetSessionUser :one
+-- using a session keeps it alive for another lifetime
+WITH session AS (
+    UPDATE sessions SET
+        last_used_at = NOW(),
+        expires_at = NOW() + make_interval(secs => sqlc.arg(lifetime_seconds)::integer)
+    WHERE token_hash = sqlc.arg(token_hash) AND expires_at > NOW()
+    RETURNING user_id
+)
+SELECT users.* FROM users
+JOIN session ON users.id = session.user_id;
+
+-- name: DeleteSession :exec
+DELETE FROM sessions WHERE token_hash = $1;
+
+-- name: DeleteUserSessions :exec
+DELETE FROM sessions WHERE user_id = $1;
+
+-- name: DeleteOtherSessions :exec
+DELETE FROM sessions WHERE user_id = $1 AND token_hash <> $2;
+
+-- name: DeleteExpiredSessions :exec
+DELETE FROM sessions WHERE expires_at <= NOW();
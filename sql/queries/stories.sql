@@ -0,0 +1,23 @@
+-- name: FindStoryByCanonicalUrl :one
+SELECT COALESCE(story_id, id)::uuid AS story_id
+FROM posts
+WHERE canonical_url = $1 AND id <> $2
+ORDER BY published_at
+LIMIT 1;
+
+-- name: GetStoryCandidates :many
+SELECT id, title, COALESCE(story_id, id)::uuid AS story_id
+FROM posts
+WHERE feed_id <> $1 AND id <> $2 AND published_at BETWEEN sqlc.arg(published_from) AND sqlc.arg(published_to)
+ORDER BY published_at;
+
+-- name: SetPostStory :exec
+UPDATE posts SET story_id = $2 WHERE id = $1;
+
+-- name: GetStoryFeeds :many
+SELECT COALESCE(posts.story_id, posts.id)::uuid AS story_id, posts.id AS post_id, feeds.name AS feed_name
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = sqlc.arg(user_id)
+WHERE COALESCE(posts.story_id, posts.id) = ANY(sqlc.arg(story_ids)::uuid[])
+ORDER BY posts.published_at;
@@ -1,10 +1,13 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name)
+-- the first user is an admin
+INSERT INTO users (id, created_at, updated_at, name, password_hash, is_admin)
 VALUES (
     $1,
     $2,
     $3,
-    $4
+    $4,
+    $5,
+    NOT EXISTS (SELECT 1 FROM users)
 )
 RETURNING *;
 
@@ -17,5 +20,13 @@ SELECT * FROM users;
 -- name: GetUserById :one
 SELECT * FROM users WHERE id = $1;
 
+-- name: SetUserPassword :exec
+UPDATE users SET updated_at = NOW(), password_hash = $2
+WHERE id = $1;
+
+-- name: SetFirstPassword :execrows
+UPDATE users SET updated_at = NOW(), password_hash = $2
+WHERE id = $1 AND password_hash = '';
+
 -- name: ResetUsers :exec
 DELETE FROM users;
\ No newline at end of file
@@ -0,0 +1,95 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, updated_at, user_id, kind, url, secret, room, token, feed_id, rule_id)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11
+)
+RETURNING *;
+
+-- name: GetWebhooksForUser :many
+SELECT webhooks.*, feeds.name AS feed_name, filter_rules.short_id AS rule_short_id,
+    COALESCE((
+        SELECT webhook_deliveries.status
+        FROM webhook_deliveries
+        WHERE webhook_deliveries.webhook_id = webhooks.id AND webhook_deliveries.attempts > 0
+        ORDER BY webhook_deliveries.updated_at DESC
+        LIMIT 1
+    ), '')::text AS last_status
+FROM webhooks
+LEFT JOIN feeds ON webhooks.feed_id = feeds.id
+LEFT JOIN filter_rules ON webhooks.rule_id = filter_rules.id
+WHERE webhooks.user_id = $1
+ORDER BY webhooks.short_id;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks WHERE user_id = $1 AND short_id = $2;
+
+-- name: GetFilterRuleByShortId :one
+SELECT * FROM filter_rules WHERE user_id = $1 AND short_id = $2;
+
+-- name: QueueWebhookDeliveries :execrows
+-- a webhook gets a new post when its owner follows the feed, the post is not muted for them,
+-- and the post is from the webhook's feed and matches its rule, if it has them
+INSERT INTO webhook_deliveries (id, webhook_id, post_id)
+SELECT gen_random_uuid(), webhooks.id, posts.id
+FROM webhooks
+INNER JOIN posts ON posts.id = $1
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = webhooks.user_id
+WHERE (webhooks.feed_id IS NULL OR webhooks.feed_id = posts.feed_id)
+AND (webhooks.rule_id IS NULL OR EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.rule_id = webhooks.rule_id AND post_rule_matches.post_id = posts.id
+))
+AND NOT EXISTS (
+    SELECT 1 FROM post_rule_matches
+    WHERE post_rule_matches.user_id = webhooks.user_id AND post_rule_matches.post_id = posts.id AND post_rule_matches.action = 'mute'
+)
+-- the same story from another feed has already been sent to this webhook
+AND NOT EXISTS (
+    SELECT 1 FROM webhook_deliveries
+    INNER JOIN posts other ON webhook_deliveries.post_id = other.id
+    WHERE webhook_deliveries.webhook_id = webhooks.id AND other.id <> posts.id
+    AND COALESCE(other.story_id, other.id) = COALESCE(posts.story_id, posts.id)
+)
+ON CONFLICT (webhook_id, post_id) DO NOTHING;
+
+-- name: GetDueWebhookDeliveries :many
+SELECT webhook_deliveries.id, webhook_deliveries.attempts, webhook_deliveries.created_at,
+    sqlc.embed(webhooks), sqlc.embed(posts), feeds.name AS feed_name, feeds.url AS feed_url
+FROM webhook_deliveries
+INNER JOIN webhooks ON webhook_deliveries.webhook_id = webhooks.id
+INNER JOIN posts ON webhook_deliveries.post_id = posts.id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE webhook_deliveries.status = 'pending' AND webhook_deliveries.next_attempt_at <= NOW()
+ORDER BY webhook_deliveries.next_attempt_at, webhook_deliveries.created_at
+LIMIT $1;
+
+-- name: RecordWebhookAttempt :exec
+UPDATE webhook_deliveries SET
+    status = $2,
+    attempts = attempts + 1,
+    next_attempt_at = $3,
+    last_status_code = $4,
+    last_error = $5,
+    delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() ELSE delivered_at END,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetWebhookDeliveries :many
+SELECT webhook_deliveries.*, webhooks.short_id AS webhook_short_id, posts.short_id AS post_short_id, posts.title AS post_title
+FROM webhook_deliveries
+INNER JOIN webhooks ON webhook_deliveries.webhook_id = webhooks.id
+INNER JOIN posts ON webhook_deliveries.post_id = posts.id
+WHERE webhooks.user_id = $1
+AND (sqlc.narg(webhook_short_id)::bigint IS NULL OR webhooks.short_id = sqlc.narg(webhook_short_id)::bigint)
+ORDER BY webhook_deliveries.updated_at DESC
+LIMIT $2;
@@ -0,0 +1,67 @@
+-- name: GetWebSubSubscription :one
+SELECT * FROM websub_subscriptions
+WHERE id = $1;
+
+-- name: GetWebSubSubscriptionForFeed :one
+SELECT * FROM websub_subscriptions
+WHERE feed_id = $1;
+
+-- name: CreateWebSubSubscription :one
+-- a subscription to a new hub or topic starts over as pending, with a new secret
+INSERT INTO websub_subscriptions (id, feed_id, hub_url, topic_url, secret)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (feed_id) DO UPDATE SET
+    updated_at = NOW(),
+    hub_url = EXCLUDED.hub_url,
+    topic_url = EXCLUDED.topic_url,
+    secret = EXCLUDED.secret,
+    status = 'pending',
+    requested_at = NOW(),
+    lease_seconds = NULL,
+    lease_expires_at = NULL,
+    last_error = ''
+RETURNING *;
+
+-- name: RecordWebSubRequest :exec
+-- an active subscription stays active when renewing it fails, until its lease runs out
+UPDATE websub_subscriptions SET
+    updated_at = NOW(),
+    requested_at = NOW(),
+    last_error = sqlc.arg(last_error),
+    status = CASE
+        WHEN status = 'active' THEN status
+        WHEN sqlc.arg(last_error)::text <> '' THEN 'failed'
+        ELSE 'pending'
+    END
+WHERE id = $1;
+
+-- name: ActivateWebSubSubscription :exec
+UPDATE websub_subscriptions SET
+    updated_at = NOW(),
+    status = 'active',
+    lease_seconds = sqlc.arg(lease_seconds)::integer,
+    lease_expires_at = NOW() + make_interval(secs => sqlc.arg(lease_seconds)::integer),
+    last_error = ''
+WHERE id = $1;
+
+-- name: DenyWebSubSubscription :exec
+UPDATE websub_subscriptions SET
+    updated_at = NOW(),
+    status = 'denied',
+    lease_seconds = NULL,
+    lease_expires_at = NULL,
+    last_error = sqlc.arg(reason)
+WHERE id = $1;
+
+-- name: RecordWebSubPush :exec
+UPDATE websub_subscriptions SET last_push_at = NOW()
+WHERE id = $1;
+
+-- name: GetWebSubSubscriptionsToRenew :many
+-- leases are renewed a day before they run out, or halfway through leases shorter than two days,
+-- and a renewal that has just been asked for is given time to be verified
+SELECT * FROM websub_subscriptions
+WHERE status = 'active'
+    AND lease_expires_at < NOW() + make_interval(secs => LEAST(COALESCE(lease_seconds, 0) / 2, 86400))
+    AND requested_at < NOW() - interval '10 minutes'
+ORDER BY lease_expires_at ASC;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE feeds
+  ADD COLUMN description TEXT NOT NULL DEFAULT '',
+  ADD COLUMN site_link TEXT NOT NULL DEFAULT '',
+  ADD COLUMN language TEXT NOT NULL DEFAULT '',
+  ADD COLUMN image_url TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE feeds
+  DROP COLUMN description,
+  DROP COLUMN site_link,
+  DROP COLUMN language,
+  DROP COLUMN image_url;
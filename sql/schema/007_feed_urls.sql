@@ -0,0 +1,95 @@
+-- +goose Up
+ALTER TABLE feeds
+  ADD COLUMN url_key TEXT;
+
+-- url_key is the form of the url used to match feeds, this does what feedURLKey does in go:
+-- the scheme, case of the host, a leading "www.", default ports, userinfo, fragments and trailing
+-- slashes are dropped, and the raw query pairs are sorted bytewise
+-- +goose StatementBegin
+CREATE FUNCTION pg_temp.feed_url_key(raw TEXT) RETURNS TEXT AS $$
+DECLARE
+  u TEXT := btrim(raw);
+  scheme TEXT;
+  host TEXT;
+  port TEXT;
+  rest TEXT;
+  query TEXT;
+  key TEXT;
+BEGIN
+  IF position('://' in u) = 0 THEN
+    u := 'https://' || u;
+  END IF;
+  scheme := lower(substring(u from '^([a-zA-Z][a-zA-Z0-9+.-]*)://'));
+  host := lower(regexp_replace(substring(u from '^[a-zA-Z][a-zA-Z0-9+.-]*://([^/?#]*)'), '^.*@', ''));
+  rest := coalesce(substring(u from '^[a-zA-Z][a-zA-Z0-9+.-]*://[^/?#]*([^#]*)'), '');
+
+  -- the port of an ipv6 address comes after its closing bracket
+  port := substring(host from '(?:^[^\[][^:]*|\]):([0-9]*)$');
+  IF port IS NOT NULL AND (port = '' OR (scheme = 'http' AND port = '80') OR (scheme = 'https' AND port = '443')) THEN
+    host := left(host, length(host) - length(port) - 1);
+  END IF;
+  key := regexp_replace(host, '^www\.', '') || rtrim(split_part(rest, '?', 1), '/');
+
+  IF position('?' in rest) > 0 THEN
+    SELECT string_agg(pair, '&' ORDER BY pair COLLATE "C") INTO query
+    FROM unnest(string_to_array(substring(rest from position('?' in rest) + 1), '&')) AS pair
+    WHERE pair <> '';
+    IF query IS NOT NULL THEN
+      key := key || '?' || query;
+    END IF;
+  END IF;
+  RETURN key;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+UPDATE feeds SET url_key = pg_temp.feed_url_key(url);
+
+-- feeds added more than once under urls with the same key are merged into the oldest of them,
+-- which takes over their follows and posts before they are deleted
+WITH feed_merges AS (
+  SELECT id, first_value(id) OVER (PARTITION BY url_key ORDER BY created_at, id) AS keep_id
+  FROM feeds
+)
+INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id)
+SELECT DISTINCT ON (feed_follows.user_id, feed_merges.keep_id)
+  gen_random_uuid(), feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_merges.keep_id
+FROM feed_follows
+JOIN feed_merges ON feed_follows.feed_id = feed_merges.id AND feed_merges.id <> feed_merges.keep_id
+ORDER BY feed_follows.user_id, feed_merges.keep_id, feed_follows.created_at
+ON CONFLICT (user_id, feed_id) DO NOTHING;
+
+WITH feed_merges AS (
+  SELECT id, first_value(id) OVER (PARTITION BY url_key ORDER BY created_at, id) AS keep_id
+  FROM feeds
+)
+UPDATE posts SET feed_id = feed_merges.keep_id
+FROM feed_merges
+WHERE posts.feed_id = feed_merges.id AND feed_merges.id <> feed_merges.keep_id;
+
+WITH feed_merges AS (
+  SELECT id, first_value(id) OVER (PARTITION BY url_key ORDER BY created_at, id) AS keep_id
+  FROM feeds
+)
+DELETE FROM feeds
+USING feed_merges
+WHERE feeds.id = feed_merges.id AND feed_merges.id <> feed_merges.keep_id;
+
+ALTER TABLE feeds
+  ALTER COLUMN url_key SET NOT NULL,
+  ADD CONSTRAINT feeds_url_key_key UNIQUE (url_key);
+
+CREATE TABLE feed_url_aliases (
+  id uuid PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  url TEXT NOT NULL,
+  url_key TEXT NOT NULL UNIQUE,
+  feed_id uuid NOT NULL
+    references feeds(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE feed_url_aliases;
+
+ALTER TABLE feeds
+  DROP COLUMN url_key;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE feeds
+  ADD COLUMN last_fetch_status INTEGER,
+  ADD COLUMN last_fetch_error TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE feeds
+  DROP COLUMN last_fetch_status,
+  DROP COLUMN last_fetch_error;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE post_states (
+  id uuid PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  user_id uuid NOT NULL
+    references users(id) ON DELETE CASCADE,
+  post_id uuid NOT NULL
+    references posts(id) ON DELETE CASCADE,
+  read_at TIMESTAMP,
+  starred BOOLEAN NOT NULL DEFAULT FALSE,
+  UNIQUE (user_id, post_id)
+);
+
+-- +goose Down
+DROP TABLE post_states;
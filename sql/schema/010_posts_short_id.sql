@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE posts
+  ADD COLUMN short_id BIGSERIAL NOT NULL UNIQUE;
+
+-- +goose Down
+ALTER TABLE posts
+  DROP COLUMN short_id;
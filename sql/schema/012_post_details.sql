@@ -0,0 +1,30 @@
+-- +goose Up
+ALTER TABLE posts
+  ADD COLUMN content TEXT NOT NULL DEFAULT '',
+  ADD COLUMN author TEXT NOT NULL DEFAULT '',
+  ADD COLUMN guid TEXT NOT NULL DEFAULT '',
+  ADD COLUMN comments_url TEXT NOT NULL DEFAULT '',
+  ADD COLUMN enclosure_url TEXT NOT NULL DEFAULT '',
+  ADD COLUMN enclosure_type TEXT NOT NULL DEFAULT '',
+  ADD COLUMN enclosure_length BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE post_categories (
+  id uuid PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  post_id uuid NOT NULL
+    references posts(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  UNIQUE (post_id, name)
+);
+
+-- +goose Down
+DROP TABLE post_categories;
+
+ALTER TABLE posts
+  DROP COLUMN content,
+  DROP COLUMN author,
+  DROP COLUMN guid,
+  DROP COLUMN comments_url,
+  DROP COLUMN enclosure_url,
+  DROP COLUMN enclosure_type,
+  DROP COLUMN enclosure_length;
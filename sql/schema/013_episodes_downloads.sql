@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE episodes (
+  id uuid PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  post_id uuid NOT NULL UNIQUE
+    references posts(id) ON DELETE CASCADE,
+  duration_seconds INTEGER,
+  episode INTEGER,
+  season INTEGER,
+  image_url TEXT NOT NULL DEFAULT '',
+  explicit BOOLEAN
+);
+
+CREATE TABLE downloads (
+  id uuid PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  user_id uuid NOT NULL
+    references users(id) ON DELETE CASCADE,
+  post_id uuid NOT NULL
+    references posts(id) ON DELETE CASCADE,
+  path TEXT NOT NULL,
+  bytes BIGINT NOT NULL DEFAULT 0,
+  completed_at TIMESTAMP,
+  UNIQUE (user_id, post_id)
+);
+
+-- +goose Down
+DROP TABLE downloads;
+DROP TABLE episodes;
@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE filter_rules (
+  id uuid PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  short_id BIGSERIAL NOT NULL UNIQUE,
+  user_id uuid NOT NULL
+    references users(id) ON DELETE CASCADE,
+  feed_id uuid
+    references feeds(id) ON DELETE CASCADE,
+  field TEXT NOT NULL CHECK (field IN ('keyword', 'regex', 'author', 'category', 'feed')),
+  pattern TEXT NOT NULL DEFAULT '',
+  action TEXT NOT NULL CHECK (action IN ('mute', 'highlight', 'read', 'star')),
+  CHECK (field <> 'feed' OR feed_id IS NOT NULL)
+);
+
+-- every post each rule matches; CASE makes sure only the branch for the rule's field is evaluated,
+-- so a keyword such as "c++" is never used as a regex
+CREATE VIEW post_rule_matches AS
+SELECT filter_rules.id AS rule_id, filter_rules.user_id, filter_rules.action, posts.id AS post_id
+FROM filter_rules
+INNER JOIN posts ON filter_rules.feed_id IS NULL OR filter_rules.feed_id = posts.feed_id
+WHERE CASE filter_rules.field
+  WHEN 'feed' THEN TRUE
+  WHEN 'keyword' THEN strpos(lower(posts.title), lower(filter_rules.pattern)) > 0
+    OR strpos(lower(posts.summary), lower(filter_rules.pattern)) > 0
+    OR strpos(lower(posts.description), lower(filter_rules.pattern)) > 0
+  WHEN 'regex' THEN posts.title ~* filter_rules.pattern OR posts.description ~* filter_rules.pattern
+  WHEN 'author' THEN strpos(lower(posts.author), lower(filter_rules.pattern)) > 0
+  WHEN 'category' THEN EXISTS (
+    SELECT 1 FROM post_categories
+    WHERE post_categories.post_id = posts.id AND lower(post_categories.name) = lower(filter_rules.pattern)
+  )
+  ELSE FALSE
+END;
+
+-- +goose Down
+DROP VIEW post_rule_matches;
+DROP TABLE filter_rules;
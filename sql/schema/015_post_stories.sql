@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE posts
+  ADD COLUMN canonical_url TEXT NOT NULL DEFAULT '',
+  ADD COLUMN story_id uuid;
+
+CREATE INDEX posts_canonical_url_idx ON posts (canonical_url);
+CREATE INDEX posts_story_id_idx ON posts (story_id);
+CREATE INDEX posts_published_at_idx ON posts (published_at);
+
+-- +goose Down
+DROP INDEX posts_published_at_idx;
+DROP INDEX posts_story_id_idx;
+DROP INDEX posts_canonical_url_idx;
+
+ALTER TABLE posts
+  DROP COLUMN canonical_url,
+  DROP COLUMN story_id;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE feeds
+  ADD COLUMN fetch_full_content BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE posts
+  ADD COLUMN full_content TEXT NOT NULL DEFAULT '',
+  ADD COLUMN full_content_fetched_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE posts
+  DROP COLUMN full_content,
+  DROP COLUMN full_content_fetched_at;
+
+ALTER TABLE feeds
+  DROP COLUMN fetch_full_content;
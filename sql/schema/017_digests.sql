@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE users
+  ADD COLUMN email TEXT NOT NULL DEFAULT '',
+  ADD COLUMN digest_frequency TEXT NOT NULL DEFAULT 'off' CHECK (digest_frequency IN ('off', 'daily', 'weekly')),
+  ADD COLUMN last_digest_at TIMESTAMP;
+
+CREATE TABLE digest_posts (
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  post_id uuid NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  sent_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, post_id)
+);
+
+-- +goose Down
+DROP TABLE digest_posts;
+
+ALTER TABLE users
+  DROP COLUMN email,
+  DROP COLUMN digest_frequency,
+  DROP COLUMN last_digest_at;
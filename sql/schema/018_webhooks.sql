@@ -0,0 +1,42 @@
+-- +goose Up
+CREATE TABLE webhooks (
+  id uuid PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  short_id BIGSERIAL NOT NULL UNIQUE,
+  user_id uuid NOT NULL
+    references users(id) ON DELETE CASCADE,
+  kind TEXT NOT NULL CHECK (kind IN ('json', 'slack', 'discord', 'matrix')),
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  -- the room and access token matrix messages are sent with
+  room TEXT NOT NULL DEFAULT '',
+  token TEXT NOT NULL DEFAULT '',
+  feed_id uuid
+    references feeds(id) ON DELETE CASCADE,
+  rule_id uuid
+    references filter_rules(id) ON DELETE CASCADE
+);
+
+CREATE TABLE webhook_deliveries (
+  id uuid PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  webhook_id uuid NOT NULL
+    references webhooks(id) ON DELETE CASCADE,
+  post_id uuid NOT NULL
+    references posts(id) ON DELETE CASCADE,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  last_status_code INTEGER,
+  last_error TEXT NOT NULL DEFAULT '',
+  delivered_at TIMESTAMP,
+  UNIQUE (webhook_id, post_id)
+);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
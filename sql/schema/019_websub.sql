@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE websub_subscriptions (
+  id uuid PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  feed_id uuid NOT NULL UNIQUE
+    references feeds(id) ON DELETE CASCADE,
+  hub_url TEXT NOT NULL,
+  topic_url TEXT NOT NULL,
+  -- the key pushes are signed with, given to the hub when subscribing
+  secret TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'active', 'denied', 'failed')),
+  requested_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  lease_seconds INTEGER,
+  lease_expires_at TIMESTAMP,
+  last_error TEXT NOT NULL DEFAULT '',
+  last_push_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE websub_subscriptions;
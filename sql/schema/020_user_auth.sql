@@ -0,0 +1,18 @@
+-- +goose Up
+-- users made before passwords have an empty hash, and can't log in until an admin sets a password
+ALTER TABLE users ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE sessions (
+  id uuid PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  user_id uuid NOT NULL
+    references users(id) ON DELETE CASCADE,
+  -- sha-256 of the token kept in the config file, so the table alone can't be used to log in
+  token_hash TEXT NOT NULL UNIQUE,
+  last_used_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE sessions;
+ALTER TABLE users DROP COLUMN password_hash;
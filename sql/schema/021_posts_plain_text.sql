@@ -0,0 +1,48 @@
+-- +goose Up
+-- the description as plain text, which keyword and regex rules match instead of its html
+ALTER TABLE posts
+  ADD COLUMN plain_text TEXT NOT NULL DEFAULT '';
+
+-- agg fills this in from the html; for posts stored before, dropping the tags and the common entities is close enough
+UPDATE posts SET plain_text = replace(replace(replace(replace(replace(
+    regexp_replace(CASE WHEN btrim(description) = '' THEN content ELSE description END, '<[^>]*>', ' ', 'g'),
+    '&lt;', '<'), '&gt;', '>'), '&quot;', '"'), '&#39;', ''''), '&amp;', '&');
+
+CREATE OR REPLACE VIEW post_rule_matches AS
+SELECT filter_rules.id AS rule_id, filter_rules.user_id, filter_rules.action, posts.id AS post_id
+FROM filter_rules
+INNER JOIN posts ON filter_rules.feed_id IS NULL OR filter_rules.feed_id = posts.feed_id
+WHERE CASE filter_rules.field
+  WHEN 'feed' THEN TRUE
+  WHEN 'keyword' THEN strpos(lower(posts.title), lower(filter_rules.pattern)) > 0
+    OR strpos(lower(posts.plain_text), lower(filter_rules.pattern)) > 0
+  WHEN 'regex' THEN posts.title ~* filter_rules.pattern OR posts.plain_text ~* filter_rules.pattern
+  WHEN 'author' THEN strpos(lower(posts.author), lower(filter_rules.pattern)) > 0
+  WHEN 'category' THEN EXISTS (
+    SELECT 1 FROM post_categories
+    WHERE post_categories.post_id = posts.id AND lower(post_categories.name) = lower(filter_rules.pattern)
+  )
+  ELSE FALSE
+END;
+
+-- +goose Down
+CREATE OR REPLACE VIEW post_rule_matches AS
+SELECT filter_rules.id AS rule_id, filter_rules.user_id, filter_rules.action, posts.id AS post_id
+FROM filter_rules
+INNER JOIN posts ON filter_rules.feed_id IS NULL OR filter_rules.feed_id = posts.feed_id
+WHERE CASE filter_rules.field
+  WHEN 'feed' THEN TRUE
+  WHEN 'keyword' THEN strpos(lower(posts.title), lower(filter_rules.pattern)) > 0
+    OR strpos(lower(posts.summary), lower(filter_rules.pattern)) > 0
+    OR strpos(lower(posts.description), lower(filter_rules.pattern)) > 0
+  WHEN 'regex' THEN posts.title ~* filter_rules.pattern OR posts.description ~* filter_rules.pattern
+  WHEN 'author' THEN strpos(lower(posts.author), lower(filter_rules.pattern)) > 0
+  WHEN 'category' THEN EXISTS (
+    SELECT 1 FROM post_categories
+    WHERE post_categories.post_id = posts.id AND lower(post_categories.name) = lower(filter_rules.pattern)
+  )
+  ELSE FALSE
+END;
+
+ALTER TABLE posts
+  DROP COLUMN plain_text;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- a link is unique within a feed only, so a second feed with the same link gets its own post,
+-- which is grouped into the same story, instead of taking over the first feed's post
+ALTER TABLE posts
+  DROP CONSTRAINT posts_url_key,
+  ADD CONSTRAINT posts_feed_id_url_key UNIQUE (feed_id, url);
+
+-- +goose Down
+-- only the first post stored with each link is kept
+DELETE FROM posts
+USING posts earlier
+WHERE earlier.url = posts.url AND (earlier.created_at, earlier.id) < (posts.created_at, posts.id);
+
+ALTER TABLE posts
+  DROP CONSTRAINT posts_feed_id_url_key,
+  ADD CONSTRAINT posts_url_key UNIQUE (url);
@@ -0,0 +1,11 @@
+-- +goose Up
+-- admins can set the password of another user, which is how a user made before passwords gets one,
+-- and can reset gator; the first user registered on an empty database is one
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+-- on a database from before passwords, the oldest user becomes the admin, so someone can unlock the rest
+UPDATE users SET is_admin = true
+WHERE id = (SELECT id FROM users ORDER BY created_at, id LIMIT 1);
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN is_admin;
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/gator/internal/database"
+)
+
+const (
+	//how far apart in time two posts can be published and still be the same story,
+	//how alike their titles must be, and how many words a title needs before it is compared at all
+	storyWindow          = 72 * time.Hour
+	storyTitleSimilarity = 0.8
+	storyMinTitleWords   = 4
+)
+
+func assignStory(ctx context.Context, s *state, post database.UpsertPostRow, feedID uuid.UUID, canonicalURL, title string, publishedAt time.Time) error {
+	//func that groups a new post with the same story from other feeds
+	//posts with the same canonical url are the same story, and failing that a post from another feed
+	//published around the same time with a near enough title is; otherwise the post starts its own story
+	storyID := post.ID
+	found := false
+	if canonicalURL != "" {
+		existing, err := s.db.FindStoryByCanonicalUrl(ctx, database.FindStoryByCanonicalUrlParams{CanonicalUrl: canonicalURL, ID: post.ID})
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return fmt.Errorf("could not look up story by url: %w", err)
+		default:
+			storyID, found = existing, true
+		}
+	}
+
+	if !found {
+		words := titleWords(title)
+		if len(words) >= storyMinTitleWords {
+			candidates, err := s.db.GetStoryCandidates(ctx, database.GetStoryCandidatesParams{
+				FeedID:        feedID,
+				ID:            post.ID,
+				PublishedFrom: publishedAt.Add(-storyWindow),
+				PublishedTo:   publishedAt.Add(storyWindow),
+			})
+			if err != nil {
+				return fmt.Errorf("could not get story candidates: %w", err)
+			}
+			best := 0.0
+			for _, candidate := range candidates {
+				similarity := titleSimilarity(words, titleWords(candidate.Title))
+				if similarity >= storyTitleSimilarity && similarity > best {
+					best, storyID = similarity, candidate.StoryID
+				}
+			}
+		}
+	}
+
+	err := s.db.SetPostStory(ctx, database.SetPostStoryParams{ID: post.ID, StoryID: uuid.NullUUID{UUID: storyID, Valid: true}})
+	if err != nil {
+		return fmt.Errorf("could not set post story: %w", err)
+	}
+	return nil
+}
+
+func titleWords(title string) map[string]bool {
+	//func that returns the set of words in a title, lowercased and without punctuation
+	//a trailing " - Site Name" or " | Site Name" is left out, since syndicated copies often add one
+	for _, separator := range []string{" | ", " - ", " – ", " — "} {
+		if i := strings.LastIndex(title, separator); i > 0 && len(strings.Fields(title[i+len(separator):])) <= 4 {
+			title = title[:i]
+			break
+		}
+	}
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[word] = true
+	}
+	return words
+}
+
+func titleSimilarity(a, b map[string]bool) float64 {
+	//func that returns how alike two titles are as the jaccard index of their words, from 0 to 1
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func getStoryFeeds(s *state, user database.User, storyIDs []uuid.UUID) (map[uuid.UUID][]database.GetStoryFeedsRow, error) {
+	//func that gets every post of a list of stories from the feeds the user follows, keyed by story id
+	rows, err := s.db.GetStoryFeeds(context.Background(), database.GetStoryFeedsParams{StoryIds: storyIDs, UserID: user.ID})
+	if err != nil {
+		return nil, dbError(err, "could not get story feeds")
+	}
+	stories := make(map[uuid.UUID][]database.GetStoryFeedsRow)
+	for _, row := range rows {
+		stories[row.StoryID] = append(stories[row.StoryID], row)
+	}
+	return stories, nil
+}
+
+func postStoryID(post database.Post) uuid.UUID {
+	//func that returns the story a post belongs to, which is the post itself until agg has grouped it
+	if post.StoryID.Valid {
+		return post.StoryID.UUID
+	}
+	return post.ID
+}
+
+func alsoIn(post database.Post, stories map[uuid.UUID][]database.GetStoryFeedsRow) []string {
+	//func that returns the names of the other feeds a post's story came in from
+	var names []string
+	for _, row := range stories[postStoryID(post)] {
+		if row.PostID != post.ID && !slices.Contains(names, row.FeedName) {
+			names = append(names, row.FeedName)
+		}
+	}
+	return names
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestTitleSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{a: "Go 1.22 is released", b: "Go 1.22 is released", want: 1},
+		{a: "Go 1.22 is released", b: "Go 1.22 is released - The Go Blog", want: 1},
+		{a: "Go 1.22 is released", b: "Go 1.22 is released | Hacker News", want: 1},
+		{a: "Hello, World!", b: "hello world", want: 1},
+		{a: "Go 1.22 is released", b: "Go 1.23 is released", want: 4.0 / 6},
+		{a: "Apple launches new iPhone", b: "Samsung shows new fridge", want: 1.0 / 7},
+		{a: "", b: "anything", want: 0},
+		{a: "!!!", b: "???", want: 0},
+	}
+	for _, tt := range tests {
+		got := titleSimilarity(titleWords(tt.a), titleWords(tt.b))
+		if got != tt.want {
+			t.Errorf("titleSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/google/uuid"
+	"github.com/joncaudill/gator/internal/database"
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	//how many posts the post list holds, and how often the tui checks for posts agg has added
+	tuiPostLimit       = 500
+	tuiRefreshInterval = 5 * time.Second
+	tuiFeedPaneWidth   = 32
+	tuiHelp            = "tab switch pane  j/k move  space/b scroll  r read  s star  o open  R refresh  q quit"
+)
+
+const (
+	paneFeeds = iota
+	panePosts
+)
+
+type readerUI struct {
+	//struct that holds what the tui shows and where its cursors are
+	s      *state
+	user   database.User
+	screen tcell.Screen
+
+	//the first feed is "all feeds", which has a nil id
+	feeds      []database.GetFollowedFeedsWithUnreadRow
+	posts      []database.GetReaderPostsRow
+	categories map[uuid.UUID][]string
+	focus      int
+	feedIdx    int
+	feedTop    int
+	postIdx    int
+	postTop    int
+	previewTop int
+	//latest post update seen, used to notice when agg adds or changes posts
+	lastUpdate time.Time
+	//message shown in the status line until the next key press
+	status string
+}
+
+func handlerTUI(s *state, cmd command, user database.User) error {
+	//func that runs the full screen reader until the user quits
+	ui := &readerUI{s: s, user: user, focus: panePosts}
+	//load before taking over the terminal, so a database error is printed normally
+	if err := ui.reload(); err != nil {
+		return err
+	}
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return fmt.Errorf("could not open terminal: %w", err)
+	}
+	if err := screen.Init(); err != nil {
+		return fmt.Errorf("could not open terminal: %w", err)
+	}
+	defer screen.Fini()
+	ui.screen = screen
+	return ui.loop()
+}
+
+func (ui *readerUI) loop() error {
+	//func that draws the screen and handles key presses and refreshes until the user quits
+	events := make(chan tcell.Event)
+	quit := make(chan struct{})
+	defer close(quit)
+	go ui.screen.ChannelEvents(events, quit)
+
+	ticker := time.NewTicker(tuiRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		ui.draw()
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			switch ev := ev.(type) {
+			case *tcell.EventResize:
+				ui.screen.Sync()
+			case *tcell.EventKey:
+				ui.status = ""
+				if ui.handleKey(ev) {
+					return nil
+				}
+			}
+		case <-ticker.C:
+			ui.checkForUpdates()
+		}
+	}
+}
+
+func (ui *readerUI) handleKey(ev *tcell.EventKey) (quit bool) {
+	//func that acts on a key press, returning true when the tui should exit
+	switch ev.Key() {
+	case tcell.KeyCtrlC, tcell.KeyEscape:
+		return true
+	case tcell.KeyTab, tcell.KeyBacktab:
+		ui.focus = 1 - ui.focus
+	case tcell.KeyLeft:
+		ui.focus = paneFeeds
+	case tcell.KeyRight:
+		ui.focus = panePosts
+	case tcell.KeyUp:
+		ui.move(-1)
+	case tcell.KeyDown:
+		ui.move(1)
+	case tcell.KeyPgUp:
+		ui.scrollPreview(-ui.previewHeight())
+	case tcell.KeyPgDn:
+		ui.scrollPreview(ui.previewHeight())
+	case tcell.KeyEnter:
+		if ui.focus == paneFeeds {
+			ui.focus = panePosts
+		} else {
+			ui.setRead(true)
+		}
+	case tcell.KeyCtrlL:
+		ui.screen.Sync()
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q':
+			return true
+		case 'j':
+			ui.move(1)
+		case 'k':
+			ui.move(-1)
+		case 'h':
+			ui.focus = paneFeeds
+		case 'l':
+			ui.focus = panePosts
+		case ' ':
+			ui.scrollPreview(ui.previewHeight())
+		case 'b':
+			ui.scrollPreview(-ui.previewHeight())
+		case 'J':
+			ui.scrollPreview(1)
+		case 'K':
+			ui.scrollPreview(-1)
+		case 'r':
+			if post, ok := ui.selectedPost(); ok {
+				ui.setRead(!post.IsRead)
+			}
+		case 's':
+			ui.toggleStar()
+		case 'o':
+			ui.openPost()
+		case 'R':
+			if err := ui.reload(); err != nil {
+				ui.status = err.Error()
+			}
+		case '?':
+			ui.status = tuiHelp
+		}
+	}
+	return false
+}
+
+func (ui *readerUI) reload() error {
+	//func that reloads the feeds and posts, keeping the selected feed and post where they still exist
+	ctx := context.Background()
+	lastUpdate, err := ui.s.db.GetLastPostUpdate(ctx)
+	if err != nil {
+		return dbError(err, "could not check for new posts")
+	}
+	feeds, err := ui.s.db.GetFollowedFeedsWithUnread(ctx, ui.user.ID)
+	if err != nil {
+		return dbError(err, "could not get followed feeds")
+	}
+
+	all := database.GetFollowedFeedsWithUnreadRow{Name: "all feeds"}
+	for _, feed := range feeds {
+		all.Unread += feed.Unread
+	}
+	selected := ui.selectedFeedID()
+	ui.feeds = append([]database.GetFollowedFeedsWithUnreadRow{all}, feeds...)
+	ui.feedIdx = 0
+	for i, feed := range ui.feeds {
+		if feed.ID == selected {
+			ui.feedIdx = i
+		}
+	}
+	ui.lastUpdate = lastUpdate
+	return ui.loadPosts()
+}
+
+func (ui *readerUI) loadPosts() error {
+	//func that loads the posts of the selected feed, keeping the selected post if it is still there
+	feedID := uuid.NullUUID{}
+	if id := ui.selectedFeedID(); id != uuid.Nil {
+		feedID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+	posts, err := ui.s.db.GetReaderPosts(context.Background(), database.GetReaderPostsParams{
+		UserID: ui.user.ID,
+		Limit:  tuiPostLimit,
+		FeedID: feedID,
+	})
+	if err != nil {
+		return dbError(err, "could not get posts")
+	}
+
+	postIDs := make([]uuid.UUID, 0, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.Post.ID)
+	}
+	categories, err := getPostCategories(ui.s, postIDs)
+	if err != nil {
+		return err
+	}
+
+	selected, hadSelection := ui.selectedPost()
+	ui.posts = posts
+	ui.categories = categories
+	for i, post := range posts {
+		if hadSelection && post.Post.ID == selected.Post.ID {
+			ui.postIdx = i
+			return nil
+		}
+	}
+	ui.postIdx, ui.postTop, ui.previewTop = 0, 0, 0
+	return nil
+}
+
+func (ui *readerUI) checkForUpdates() {
+	//func that reloads everything when agg has added or changed posts since the last load
+	lastUpdate, err := ui.s.db.GetLastPostUpdate(context.Background())
+	if err != nil {
+		ui.status = dbError(err, "could not check for new posts").Error()
+		return
+	}
+	if !lastUpdate.After(ui.lastUpdate) {
+		return
+	}
+	if err := ui.reload(); err != nil {
+		ui.status = err.Error()
+		return
+	}
+	ui.status = "new posts loaded"
+}
+
+func (ui *readerUI) selectedFeedID() uuid.UUID {
+	if ui.feedIdx >= len(ui.feeds) {
+		return uuid.Nil
+	}
+	return ui.feeds[ui.feedIdx].ID
+}
+
+func (ui *readerUI) selectedPost() (database.GetReaderPostsRow, bool) {
+	if ui.postIdx >= len(ui.posts) {
+		return database.GetReaderPostsRow{}, false
+	}
+	return ui.posts[ui.postIdx], true
+}
+
+func (ui *readerUI) move(delta int) {
+	//func that moves the cursor of the focused pane, loading the posts of a newly selected feed
+	if ui.focus == paneFeeds {
+		idx := clamp(ui.feedIdx+delta, 0, len(ui.feeds)-1)
+		if idx == ui.feedIdx {
+			return
+		}
+		ui.feedIdx = idx
+		ui.posts = nil
+		ui.postIdx, ui.postTop, ui.previewTop = 0, 0, 0
+		if err := ui.loadPosts(); err != nil {
+			ui.status = err.Error()
+		}
+		return
+	}
+	idx := clamp(ui.postIdx+delta, 0, len(ui.posts)-1)
+	if idx != ui.postIdx {
+		ui.postIdx = idx
+		ui.previewTop = 0
+	}
+}
+
+func (ui *readerUI) scrollPreview(delta int) {
+	ui.previewTop = max(ui.previewTop+delta, 0)
+}
+
+func (ui *readerUI) setRead(read bool) {
+	//func that marks the selected post read or unread
+	post, ok := ui.selectedPost()
+	if !ok {
+		return
+	}
+	readAt := sql.NullTime{}
+	if read {
+		readAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	err := ui.s.db.SetPostRead(context.Background(), database.SetPostReadParams{
+		ID:     uuid.New(),
+		UserID: ui.user.ID,
+		PostID: post.Post.ID,
+		ReadAt: readAt,
+	})
+	if err != nil {
+		ui.status = dbError(err, "could not mark post read").Error()
+		return
+	}
+	ui.refreshAfterChange()
+}
+
+func (ui *readerUI) toggleStar() {
+	//func that stars the selected post, or unstars it if it is already starred
+	post, ok := ui.selectedPost()
+	if !ok {
+		return
+	}
+	err := ui.s.db.SetPostStarred(context.Background(), database.SetPostStarredParams{
+		ID:      uuid.New(),
+		UserID:  ui.user.ID,
+		PostID:  post.Post.ID,
+		Starred: !post.Starred,
+	})
+	if err != nil {
+		ui.status = dbError(err, "could not star post").Error()
+		return
+	}
+	ui.refreshAfterChange()
+}
+
+func (ui *readerUI) refreshAfterChange() {
+	//func that reloads after a post's state changed, so the unread counts stay right
+	if err := ui.reload(); err != nil {
+		ui.status = err.Error()
+	}
+}
+
+func (ui *readerUI) openPost() {
+	//func that opens the selected post in the browser and marks it read
+	//a browser from $BROWSER may be a terminal one, so the tui steps aside while it runs
+	post, ok := ui.selectedPost()
+	if !ok {
+		return
+	}
+	browser, fromEnv := browserCommand(post.Post.Url)
+	var err error
+	if fromEnv {
+		browser.Stdin, browser.Stdout, browser.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err = ui.screen.Suspend(); err == nil {
+			err = browser.Run()
+			if resumeErr := ui.screen.Resume(); resumeErr != nil && err == nil {
+				err = resumeErr
+			}
+		}
+	} else if err = browser.Start(); err == nil {
+		go browser.Wait()
+	}
+	if err != nil {
+		ui.status = fmt.Sprintf("could not open %s: %v", post.Post.Url, err)
+		return
+	}
+	if !post.IsRead {
+		ui.setRead(true)
+	}
+}
+
+func (ui *readerUI) layout() (feedWidth, postsHeight, height int) {
+	//func that works out the size of the panes: feeds on the left, posts above the preview on the right,
+	//and the status line at the bottom
+	width, height := ui.screen.Size()
+	feedWidth = min(tuiFeedPaneWidth, width/3)
+	bodyHeight := height - 1
+	postsHeight = (bodyHeight - 2) / 2
+	return feedWidth, postsHeight, height
+}
+
+func (ui *readerUI) previewHeight() int {
+	_, postsHeight, height := ui.layout()
+	return max(height-1-postsHeight-2, 1)
+}
+
+func (ui *readerUI) draw() {
+	//func that draws the whole screen
+	ui.screen.Clear()
+	width, height := ui.screen.Size()
+	if width < 40 || height < 10 {
+		drawString(ui.screen, 0, 0, width, "terminal too small", tcell.StyleDefault)
+		ui.screen.Show()
+		return
+	}
+	feedWidth, postsHeight, _ := ui.layout()
+	rightX := feedWidth + 1
+	rightWidth := width - rightX
+	bodyHeight := height - 1
+
+	for y := 0; y < bodyHeight; y++ {
+		ui.screen.SetContent(feedWidth, y, tcell.RuneVLine, nil, tcell.StyleDefault)
+	}
+
+	ui.drawHeader(0, 0, feedWidth, "feeds", ui.focus == paneFeeds)
+	ui.drawFeeds(0, 1, feedWidth, bodyHeight-1)
+	ui.drawHeader(rightX, 0, rightWidth, "posts", ui.focus == panePosts)
+	ui.drawPosts(rightX, 1, rightWidth, postsHeight)
+	ui.drawHeader(rightX, postsHeight+1, rightWidth, "preview", false)
+	ui.drawPreview(rightX, postsHeight+2, rightWidth, bodyHeight-postsHeight-2)
+
+	status := ui.status
+	if status == "" {
+		status = tuiHelp
+	}
+	drawString(ui.screen, 0, height-1, width, status, tcell.StyleDefault.Dim(true))
+	ui.screen.Show()
+}
+
+func (ui *readerUI) drawHeader(x, y, width int, title string, focused bool) {
+	style := tcell.StyleDefault.Reverse(true).Bold(focused)
+	drawString(ui.screen, x, y, width, runewidth.FillRight(" "+title, width), style)
+}
+
+func (ui *readerUI) rowStyle(selected bool, pane int) tcell.Style {
+	//func that returns the style of a list row, highlighting the cursor of the focused pane the most
+	if !selected {
+		return tcell.StyleDefault
+	}
+	if ui.focus == pane {
+		return tcell.StyleDefault.Reverse(true)
+	}
+	return tcell.StyleDefault.Underline(true)
+}
+
+func (ui *readerUI) drawFeeds(x, y, width, height int) {
+	ui.feedTop = scrollTop(ui.feedTop, ui.feedIdx, height)
+	for row := 0; row < height && ui.feedTop+row < len(ui.feeds); row++ {
+		i := ui.feedTop + row
+		feed := ui.feeds[i]
+		count := ""
+		if feed.Unread > 0 {
+			count = strconv.FormatInt(feed.Unread, 10)
+		}
+		nameWidth := max(width-runewidth.StringWidth(count)-2, 1)
+		line := " " + runewidth.FillRight(runewidth.Truncate(singleLine(feed.Name), nameWidth, "…"), nameWidth) + count
+		style := ui.rowStyle(i == ui.feedIdx, paneFeeds).Bold(feed.Unread > 0)
+		drawString(ui.screen, x, y+row, width, runewidth.FillRight(line, width), style)
+	}
+}
+
+func (ui *readerUI) drawPosts(x, y, width, height int) {
+	if len(ui.posts) == 0 {
+		drawString(ui.screen, x+1, y, width-1, "no posts yet, run \"gator agg\" to fetch some", tcell.StyleDefault.Dim(true))
+		return
+	}
+	showFeed := ui.selectedFeedID() == uuid.Nil
+	ui.postTop = scrollTop(ui.postTop, ui.postIdx, height)
+	for row := 0; row < height && ui.postTop+row < len(ui.posts); row++ {
+		i := ui.postTop + row
+		post := ui.posts[i]
+		read, star := "●", " "
+		if post.IsRead {
+			read = " "
+		}
+		if post.Starred {
+			star = "★"
+		}
+		line := fmt.Sprintf(" %s%s %s  %s", read, star, post.Post.PublishedAt.Format("Jan 02"), singleLine(post.Post.Title))
+		if showFeed {
+			line += "  · " + singleLine(post.FeedName)
+		}
+		style := ui.rowStyle(i == ui.postIdx, panePosts).Bold(!post.IsRead)
+		if post.Highlighted {
+			style = style.Foreground(tcell.ColorYellow)
+		}
+		drawString(ui.screen, x, y+row, width, runewidth.FillRight(runewidth.Truncate(line, width, "…"), width), style)
+	}
+}
+
+func (ui *readerUI) drawPreview(x, y, width, height int) {
+	post, ok := ui.selectedPost()
+	if !ok {
+		return
+	}
+	type styledLine struct {
+		text  string
+		style tcell.Style
+	}
+	textWidth := width - 2
+	var lines []styledLine
+	for _, line := range wrapText(singleLine(post.Post.Title), textWidth) {
+		lines = append(lines, styledLine{line, tcell.StyleDefault.Bold(true)})
+	}
+	meta := fmt.Sprintf("#%d · ", post.Post.ShortID) + post.FeedName + " · " + post.Post.PublishedAt.Format("Mon, 02 Jan 2006 15:04")
+	if post.Starred {
+		meta += " · starred"
+	}
+	lines = append(lines, styledLine{meta, tcell.StyleDefault.Dim(true)})
+	if byline := postByline(post.Post, ui.categories[post.Post.ID]); byline != "" {
+		for _, line := range wrapText(byline, textWidth) {
+			lines = append(lines, styledLine{line, tcell.StyleDefault.Dim(true)})
+		}
+	}
+	for _, line := range wrapText(post.Post.Url, textWidth) {
+		lines = append(lines, styledLine{line, tcell.StyleDefault.Underline(true)})
+	}
+	if post.Post.EnclosureUrl != "" {
+		for _, line := range wrapText("enclosure: "+postEnclosure(post.Post), textWidth) {
+			lines = append(lines, styledLine{line, tcell.StyleDefault.Dim(true)})
+		}
+	}
+	lines = append(lines, styledLine{"", tcell.StyleDefault})
+	for _, line := range strings.Split(renderHTML(postBody(post.Post), textWidth), "\n") {
+		lines = append(lines, styledLine{line, tcell.StyleDefault})
+	}
+
+	ui.previewTop = clamp(ui.previewTop, 0, max(len(lines)-height, 0))
+	for row := 0; row < height && ui.previewTop+row < len(lines); row++ {
+		line := lines[ui.previewTop+row]
+		drawString(ui.screen, x+1, y+row, textWidth, line.text, line.style)
+	}
+}
+
+func drawString(screen tcell.Screen, x, y, width int, s string, style tcell.Style) {
+	//func that draws a string on one row, cutting it off at width columns
+	col := 0
+	for _, r := range s {
+		w := runewidth.RuneWidth(r)
+		if w == 0 {
+			continue
+		}
+		if col+w > width {
+			return
+		}
+		screen.SetContent(x+col, y, r, nil, style)
+		col += w
+	}
+}
+
+func singleLine(s string) string {
+	//func that collapses newlines, tabs and runs of spaces so a string fits on one row
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func scrollTop(top, idx, height int) int {
+	//func that returns the first visible row of a list so the row at idx is on screen
+	if idx < top {
+		return idx
+	}
+	if height > 0 && idx >= top+height {
+		return idx - height + 1
+	}
+	return top
+}
+
+func clamp(v, lo, hi int) int {
+	if hi < lo {
+		return lo
+	}
+	return min(max(v, lo), hi)
+}
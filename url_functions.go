@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+func normalizeFeedURL(rawURL string) (string, error) {
+	//func that checks a feed url and returns it as it should be stored and fetched
+	//only surrounding space is trimmed and a missing scheme is filled in, the rest is left as given
+	//since servers may treat a trailing slash or an escaped slash differently; feedURLKey does the folding
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("could not parse url: %w", err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("url has no host: %s", rawURL)
+	}
+	return rawURL, nil
+}
+
+func feedURLKey(feedURL string) (string, error) {
+	//func that returns the key used to match feed urls against each other
+	//the scheme, case of the host, a leading "www.", default ports, fragments, trailing slashes
+	//and the order of query parameters are ignored
+	//migration 007 backfills keys with the same rules in sql, so keep the two in step
+	normalized, err := normalizeFeedURL(feedURL)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return "", fmt.Errorf("could not parse url: %w", err)
+	}
+
+	//u.Host keeps the brackets of an ipv6 address, unlike u.Hostname
+	host := strings.ToLower(u.Host)
+	scheme := strings.ToLower(u.Scheme)
+	if port := u.Port(); port == "" || (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		host = strings.TrimSuffix(host, ":"+port)
+	}
+	key := strings.TrimPrefix(host, "www.") + strings.TrimRight(u.EscapedPath(), "/")
+
+	//the raw pairs are sorted as they are, rather than decoded and encoded again, so sql can do the same
+	var pairs []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+	if len(pairs) > 0 {
+		sort.Strings(pairs)
+		key += "?" + strings.Join(pairs, "&")
+	}
+	return key, nil
+}
+
+var trackingParams = map[string]bool{
+	//query parameters that only track where a click came from, on top of every utm_* one
+	"fbclid": true, "gclid": true, "dclid": true, "msclkid": true, "yclid": true, "twclid": true, "igshid": true,
+	"mc_cid": true, "mc_eid": true, "_hsenc": true, "_hsmi": true, "ref": true, "ref_src": true, "ref_url": true,
+	"cmpid": true, "s_cid": true, "amp": true,
+}
+
+func canonicalPostURL(link string) string {
+	//func that returns the key used to spot the same story under different urls, or "" if the link is not a url
+	//on top of what feedURLKey ignores, tracking parameters are dropped and amp pages map to the normal page
+	normalized, err := normalizeFeedURL(link)
+	if err != nil {
+		return ""
+	}
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return ""
+	}
+	u.Host = strings.ToLower(u.Host)
+
+	//google's amp cache serves pages as https://example-com.cdn.ampproject.org/c/s/example.com/path
+	if strings.HasSuffix(u.Host, ".cdn.ampproject.org") {
+		rest := strings.TrimPrefix(strings.TrimPrefix(u.Path, "/c/"), "/v/")
+		rest = strings.TrimPrefix(rest, "s/")
+		if host, path, ok := strings.Cut(rest, "/"); ok && host != "" {
+			u.Host = host
+			u.Path = "/" + path
+		}
+	}
+	u.Host = strings.TrimPrefix(u.Host, "amp.")
+	switch {
+	case strings.HasSuffix(u.Path, "/amp"):
+		u.Path = strings.TrimSuffix(u.Path, "/amp")
+	case strings.HasPrefix(u.Path, "/amp/"):
+		u.Path = strings.TrimPrefix(u.Path, "/amp")
+	case strings.HasSuffix(u.Path, ".amp.html"):
+		u.Path = strings.TrimSuffix(u.Path, ".amp.html") + ".html"
+	}
+	u.RawPath = ""
+
+	query := u.Query()
+	for name, values := range query {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] ||
+			(lower == "outputtype" && len(values) == 1 && strings.EqualFold(values[0], "amp")) {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	key, err := feedURLKey(u.String())
+	if err != nil {
+		return ""
+	}
+	return key
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/gator/internal/database"
+)
+
+const (
+	//how many deliveries are tried each time, how long one may take,
+	//and how much of an error response is kept in the delivery log
+	webhookBatchSize     = 50
+	webhookTimeout       = 15 * time.Second
+	webhookMaxErrorBytes = 300
+)
+
+var (
+	//the kinds of webhook gator can send to, and how long to wait before each retry of a failed delivery
+	webhookKinds       = []string{"json", "slack", "discord", "matrix"}
+	webhookRetryDelays = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 12 * time.Hour}
+)
+
+type webhookEvent struct {
+	//payload of the json webhook kind
+	Event      string      `json:"event"`
+	DeliveryID uuid.UUID   `json:"delivery_id"`
+	Post       webhookPost `json:"post"`
+	Feed       webhookFeed `json:"feed"`
+}
+
+type webhookPost struct {
+	ID          uuid.UUID `json:"id"`
+	ShortID     int64     `json:"short_id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Summary     string    `json:"summary"`
+	Author      string    `json:"author,omitempty"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+type webhookFeed struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	URL  string    `json:"url"`
+}
+
+func handlerAddWebhook(s *state, cmd command, user database.User) error {
+	//func that adds a webhook that new posts from the current user's feeds are sent to
+	kind, target := strings.ToLower(cmd.args[0]), strings.TrimSpace(cmd.args[1])
+	if !slices.Contains(webhookKinds, kind) {
+		return &usageError{command: cmd.def, msg: fmt.Sprintf("addwebhook: unknown kind %q, use one of %s", kind, strings.Join(webhookKinds, ", "))}
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return &usageError{command: cmd.def, msg: fmt.Sprintf("addwebhook: invalid url %q, use an http or https url", target)}
+	}
+	room, token := strings.TrimSpace(cmd.flag("room")), strings.TrimSpace(cmd.flag("token"))
+	if kind == "matrix" && (room == "" || token == "") {
+		return &usageError{command: cmd.def, msg: "addwebhook: matrix webhooks need --room and --token"}
+	}
+	if kind != "matrix" && (room != "" || token != "") {
+		return &usageError{command: cmd.def, msg: "addwebhook: --room and --token are only for matrix webhooks"}
+	}
+
+	secret := cmd.flag("secret")
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("could not make webhook secret: %w", err)
+		}
+		secret = hex.EncodeToString(key)
+	}
+
+	feedID := uuid.NullUUID{}
+	if feedURL := cmd.flag("feed"); feedURL != "" {
+		feed, err := getFeedByURL(s, feedURL)
+		if err != nil {
+			return err
+		}
+		feedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	ruleID := uuid.NullUUID{}
+	if ruleArg := cmd.flag("rule"); ruleArg != "" {
+		shortID, err := strconv.ParseInt(strings.TrimPrefix(ruleArg, "#"), 10, 64)
+		if err != nil || shortID < 1 {
+			return &usageError{command: cmd.def, msg: fmt.Sprintf("addwebhook: invalid rule id %q, use the number shown by \"gator rules\"", ruleArg)}
+		}
+		rule, err := s.db.GetFilterRuleByShortId(context.Background(), database.GetFilterRuleByShortIdParams{UserID: user.ID, ShortID: shortID})
+		if errors.Is(err, sql.ErrNoRows) {
+			return notFoundError("rule %d not found", shortID)
+		}
+		if err != nil {
+			return dbError(err, "could not look up rule %d", shortID)
+		}
+		ruleID = uuid.NullUUID{UUID: rule.ID, Valid: true}
+	}
+
+	webhook, err := s.db.CreateWebhook(context.Background(), database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		Kind:      kind,
+		Url:       target,
+		Secret:    secret,
+		Room:      room,
+		Token:     token,
+		FeedID:    feedID,
+		RuleID:    ruleID,
+	})
+	if err != nil {
+		return dbError(err, "could not add webhook")
+	}
+	fmt.Printf("added webhook %d: %s to %s\n", webhook.ShortID, webhook.Kind, webhook.Url)
+	fmt.Printf("deliveries are signed with the secret %s\n", webhook.Secret)
+	return nil
+}
+
+func handlerWebhooks(s *state, cmd command, user database.User) error {
+	//func that lists the current user's webhooks and how their last delivery went
+	webhooks, err := s.db.GetWebhooksForUser(context.Background(), user.ID)
+	if err != nil {
+		return dbError(err, "could not get webhooks")
+	}
+
+	if s.output != outputText {
+		table := outputTable{columns: []string{"id", "kind", "url", "room", "feed", "rule_id", "last_status", "created_at"}}
+		for _, webhook := range webhooks {
+			table.add(webhook.ShortID,
+				webhook.Kind,
+				webhook.Url,
+				webhook.Room,
+				nullString(webhook.FeedName),
+				nullInt64(webhook.RuleShortID),
+				webhook.LastStatus,
+				formatTime(webhook.CreatedAt))
+		}
+		return writeTable(s, table)
+	}
+
+	if len(webhooks) == 0 {
+		fmt.Println("No webhooks yet, add one with \"gator addwebhook\".")
+		return nil
+	}
+	fmt.Println("Webhooks:")
+	for _, webhook := range webhooks {
+		fmt.Printf("* [%d] %s to %s", webhook.ShortID, webhook.Kind, webhook.Url)
+		if webhook.Room != "" {
+			fmt.Printf(" room %s", webhook.Room)
+		}
+		fmt.Println()
+		var filters []string
+		if webhook.FeedName.Valid {
+			filters = append(filters, "posts from "+webhook.FeedName.String)
+		}
+		if webhook.RuleShortID.Valid {
+			filters = append(filters, fmt.Sprintf("posts matching rule %d", webhook.RuleShortID.Int64))
+		}
+		if len(filters) == 0 {
+			filters = append(filters, "every new post")
+		}
+		fmt.Printf("  %s\n", strings.Join(filters, ", "))
+		if webhook.LastStatus != "" {
+			fmt.Printf("  last delivery: %s\n", webhook.LastStatus)
+		}
+	}
+	return nil
+}
+
+func handlerDeleteWebhook(s *state, cmd command, user database.User) error {
+	//func that deletes one of the current user's webhooks by the id shown by "gator webhooks"
+	shortID, err := strconv.ParseInt(strings.TrimPrefix(cmd.args[0], "#"), 10, 64)
+	if err != nil || shortID < 1 {
+		return &usageError{command: cmd.def, msg: fmt.Sprintf("deletewebhook: invalid webhook id %q, use the number shown by \"gator webhooks\"", cmd.args[0])}
+	}
+	deleted, err := s.db.DeleteWebhook(context.Background(), database.DeleteWebhookParams{UserID: user.ID, ShortID: shortID})
+	if err != nil {
+		return dbError(err, "could not delete webhook %d", shortID)
+	}
+	if deleted == 0 {
+		return notFoundError("webhook %d not found", shortID)
+	}
+	fmt.Printf("deleted webhook %d\n", shortID)
+	return nil
+}
+
+func handlerWebhookLog(s *state, cmd command, user database.User) error {
+	//func that shows the latest deliveries of the current user's webhooks, or of one webhook
+	params := database.GetWebhookDeliveriesParams{UserID: user.ID, Limit: 20}
+	if len(cmd.args) > 0 {
+		shortID, err := strconv.ParseInt(strings.TrimPrefix(cmd.args[0], "#"), 10, 64)
+		if err != nil || shortID < 1 {
+			return &usageError{command: cmd.def, msg: fmt.Sprintf("webhooklog: invalid webhook id %q, use the number shown by \"gator webhooks\"", cmd.args[0])}
+		}
+		params.WebhookShortID = sql.NullInt64{Int64: shortID, Valid: true}
+	}
+	if limit := cmd.flag("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return &usageError{command: cmd.def, msg: fmt.Sprintf("webhooklog: invalid limit %q, use a positive number", limit)}
+		}
+		params.Limit = int32(n)
+	}
+
+	deliveries, err := s.db.GetWebhookDeliveries(context.Background(), params)
+	if err != nil {
+		return dbError(err, "could not get webhook deliveries")
+	}
+
+	if s.output != outputText {
+		table := outputTable{columns: []string{"id", "webhook_id", "post_id", "post_title", "status", "attempts",
+			"last_status_code", "last_error", "next_attempt_at", "delivered_at", "created_at", "updated_at"}}
+		for _, delivery := range deliveries {
+			table.add(delivery.ID.String(),
+				delivery.WebhookShortID,
+				delivery.PostShortID,
+				delivery.PostTitle,
+				delivery.Status,
+				int64(delivery.Attempts),
+				nullInt32(delivery.LastStatusCode),
+				delivery.LastError,
+				formatTime(delivery.NextAttemptAt),
+				nullTime(delivery.DeliveredAt),
+				formatTime(delivery.CreatedAt),
+				formatTime(delivery.UpdatedAt))
+		}
+		return writeTable(s, table)
+	}
+
+	if len(deliveries) == 0 {
+		fmt.Println("No webhook deliveries yet.")
+		return nil
+	}
+	for _, delivery := range deliveries {
+		fmt.Printf("* %s webhook %d, post [%d] %s\n", delivery.Status, delivery.WebhookShortID, delivery.PostShortID, singleLine(delivery.PostTitle))
+		attempts := fmt.Sprintf("%d %s", delivery.Attempts, plural(int(delivery.Attempts), "attempt", "attempts"))
+		if delivery.LastStatusCode.Valid {
+			attempts += fmt.Sprintf(", last status %d", delivery.LastStatusCode.Int32)
+		}
+		switch delivery.Status {
+		case "delivered":
+			fmt.Printf("  %s, delivered %s\n", attempts, delivery.DeliveredAt.Time.Format(time.DateTime))
+		case "pending":
+			fmt.Printf("  %s, next try %s\n", attempts, delivery.NextAttemptAt.Format(time.DateTime))
+		default:
+			fmt.Printf("  %s, gave up\n", attempts)
+		}
+		if delivery.LastError != "" && delivery.Status != "delivered" {
+			fmt.Printf("  %s\n", singleLine(delivery.LastError))
+		}
+	}
+	return nil
+}
+
+func queueWebhooks(ctx context.Context, s *state, postID uuid.UUID, log *slog.Logger) {
+	//func that queues a new post for every webhook that wants it, to be sent by deliverWebhooks
+	queued, err := s.db.QueueWebhookDeliveries(ctx, postID)
+	if err != nil {
+		log.Warn("could not queue webhooks", "post_id", postID, "err", err)
+		return
+	}
+	if queued > 0 {
+		log.Debug("queued webhooks", "post_id", postID, "count", queued)
+	}
+}
+
+func deliverWebhooks(ctx context.Context, s *state) {
+	//func that sends every webhook delivery that is due, recording how each attempt went
+	//failures are retried after the delays in webhookRetryDelays, then given up on
+	//when an attempt can't be recorded the same deliveries would come back as due, so it stops until the next round
+	for ctx.Err() == nil {
+		deliveries, err := s.db.GetDueWebhookDeliveries(ctx, webhookBatchSize)
+		if err != nil {
+			s.logger.Error("could not get webhook deliveries", "err", err)
+			return
+		}
+		for _, delivery := range deliveries {
+			if err := deliverWebhook(ctx, s, delivery); err != nil {
+				s.logger.Error("could not record webhook delivery, stopping until the next round", "delivery_id", delivery.ID, "err", err)
+				return
+			}
+		}
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+func deliverWebhook(ctx context.Context, s *state, delivery database.GetDueWebhookDeliveriesRow) error {
+	//func that makes one attempt at a delivery and records the result, returning an error if it could not be recorded
+	log := s.logger.With("webhook_id", delivery.Webhook.ID, "delivery_id", delivery.ID, "post_id", delivery.Post.ID)
+	now := time.Now()
+	statusCode, retryAfter, err := sendWebhook(ctx, s, delivery, now)
+	if ctx.Err() != nil {
+		//stopped mid-delivery, so leave it to be tried again without counting the attempt
+		return nil
+	}
+
+	params := database.RecordWebhookAttemptParams{ID: delivery.ID, Status: "delivered", NextAttemptAt: now}
+	if statusCode > 0 {
+		params.LastStatusCode = sql.NullInt32{Int32: int32(statusCode), Valid: true}
+	}
+	//client errors other than timeouts and rate limits won't get better by trying again
+	permanent := statusCode >= 400 && statusCode < 500 && statusCode != http.StatusRequestTimeout && statusCode != http.StatusTooManyRequests
+	attempt := int(delivery.Attempts)
+	switch {
+	case err == nil:
+		log.Info("webhook delivered", "status", statusCode)
+	case permanent || attempt >= len(webhookRetryDelays):
+		params.Status, params.LastError = "failed", err.Error()
+		log.Warn("webhook delivery failed, giving up", "attempts", attempt+1, "err", err)
+	default:
+		params.Status, params.LastError = "pending", err.Error()
+		params.NextAttemptAt = now.Add(max(webhookRetryDelays[attempt], retryAfter))
+		log.Warn("webhook delivery failed, will retry", "attempts", attempt+1, "next_attempt_at", params.NextAttemptAt, "err", err)
+	}
+	return s.db.RecordWebhookAttempt(ctx, params)
+}
+
+func sendWebhook(ctx context.Context, s *state, delivery database.GetDueWebhookDeliveriesRow, now time.Time) (int, time.Duration, error) {
+	//func that sends a delivery, returning the response status and any Retry-After wait it asked for
+	//every request is signed with the webhook's secret: X-Gator-Signature is "sha256=" and the hex hmac-sha256
+	//of the X-Gator-Timestamp header, a dot and the body
+	method, target, body, err := webhookRequest(delivery)
+	if err != nil {
+		return 0, 0, err
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not create request: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(delivery.Webhook.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	request.Header.Set("Content-Type", "application/json")
+	fetcher := s.fetcher.Load()
+	request.Header.Set("User-Agent", fetcher.userAgent)
+	request.Header.Set("X-Gator-Event", "post.created")
+	request.Header.Set("X-Gator-Delivery", delivery.ID.String())
+	request.Header.Set("X-Gator-Timestamp", timestamp)
+	request.Header.Set("X-Gator-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	if delivery.Webhook.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+delivery.Webhook.Token)
+	}
+
+	//redirects are not followed, since they would turn the post into a get
+	client := &http.Client{Transport: fetcher.client.Transport,
+		Timeout: webhookTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not send webhook: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+		return response.StatusCode, 0, nil
+	}
+	retryAfter, _ := parseRetryAfter(response.Header.Get("Retry-After"), now)
+	message, _ := io.ReadAll(io.LimitReader(response.Body, webhookMaxErrorBytes))
+	statusErr := fmt.Errorf("unexpected status %s", response.Status)
+	if text := strings.TrimSpace(string(message)); text != "" {
+		statusErr = fmt.Errorf("unexpected status %s: %s", response.Status, text)
+	}
+	return response.StatusCode, retryAfter, statusErr
+}
+
+func webhookRequest(delivery database.GetDueWebhookDeliveriesRow) (string, string, []byte, error) {
+	//func that returns the method, url and body a delivery is sent with, in the format of its webhook's kind
+	post := delivery.Post
+	title := singleLine(post.Title)
+	summary := postSummary(post)
+	var payload any
+	method, target := http.MethodPost, delivery.Webhook.Url
+	switch delivery.Webhook.Kind {
+	case "slack":
+		text := fmt.Sprintf("*%s*\n_%s_", slackLink(post.Url, title), slackEscape(delivery.FeedName))
+		if summary != "" {
+			text += "\n" + slackEscape(summary)
+		}
+		payload = map[string]any{"text": text, "unfurl_links": false}
+	case "discord":
+		embed := map[string]any{
+			"title":     truncateRunes(title, 256),
+			"url":       post.Url,
+			"timestamp": post.PublishedAt.UTC().Format(time.RFC3339),
+			"footer":    map[string]string{"text": truncateRunes(delivery.FeedName, 2048)},
+		}
+		if summary != "" {
+			embed["description"] = truncateRunes(summary, 4096)
+		}
+		if post.Author != "" {
+			embed["author"] = map[string]string{"name": truncateRunes(post.Author, 256)}
+		}
+		payload = map[string]any{"username": "gator", "embeds": []any{embed}}
+	case "matrix":
+		//the delivery id is the transaction id, so a retry of a message that did get through is not posted twice
+		method = http.MethodPut
+		target = strings.TrimRight(delivery.Webhook.Url, "/") + "/_matrix/client/v3/rooms/" +
+			url.PathEscape(delivery.Webhook.Room) + "/send/m.room.message/" + delivery.ID.String()
+		body := title + "\n" + post.Url + "\n" + delivery.FeedName
+		formatted := fmt.Sprintf(`<a href="%s">%s</a><br><em>%s</em>`, html.EscapeString(post.Url), html.EscapeString(title), html.EscapeString(delivery.FeedName))
+		if summary != "" {
+			body += "\n" + summary
+			formatted += "<br>" + html.EscapeString(summary)
+		}
+		payload = map[string]string{"msgtype": "m.text", "body": body, "format": "org.matrix.custom.html", "formatted_body": formatted}
+	default:
+		payload = webhookEvent{Event: "post.created",
+			DeliveryID: delivery.ID,
+			Post: webhookPost{ID: post.ID,
+				ShortID:     post.ShortID,
+				Title:       post.Title,
+				URL:         post.Url,
+				Summary:     summary,
+				Author:      post.Author,
+				PublishedAt: post.PublishedAt,
+			},
+			Feed: webhookFeed{ID: post.FeedID, Name: delivery.FeedName, URL: delivery.FeedUrl},
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("could not encode webhook payload: %w", err)
+	}
+	return method, target, body, nil
+}
+
+func slackEscape(s string) string {
+	//func that escapes the characters slack treats as markup in message text
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+func slackLink(target, text string) string {
+	//func that makes a slack link, "<url|text>"
+	//slack ends the url at the first "|", so one in the url is percent-encoded, and one in the text is left as it is
+	target = strings.ReplaceAll(slackEscape(target), "|", "%7C")
+	return "<" + target + "|" + slackEscape(text) + ">"
+}
+
+func truncateRunes(s string, n int) string {
+	//func that cuts s down to at most n runes, ending it with an ellipsis if it was cut
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
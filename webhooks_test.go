@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"internal/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/gator/internal/database"
+)
+
+func testDelivery(kind, target string) database.GetDueWebhookDeliveriesRow {
+	//func that returns a delivery of a post whose title, url and feed name have characters slack and html treat as markup
+	return database.GetDueWebhookDeliveriesRow{ID: uuid.MustParse("6f1c2a4e-8b3d-4c5e-9f70-1a2b3c4d5e6f"),
+		Webhook: database.Webhook{Kind: kind, Url: target, Secret: "hunter2", Room: "!room:example.org"},
+		Post: database.Post{Title: "Q&A: <b>tags</b>\nand | pipes",
+			Url:         "https://example.com/post?a=1&b=2|3",
+			Summary:     "Fish & chips",
+			Author:      "Ann",
+			PublishedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		},
+		FeedName: "Tom & Jerry's <blog>",
+		FeedUrl:  "https://example.com/feed",
+	}
+}
+
+func TestSlackLink(t *testing.T) {
+	tests := []struct {
+		target, text string
+		want         string
+	}{
+		{"https://example.com/a", "Title", "<https://example.com/a|Title>"},
+		{"https://example.com/?a=1&b=2", "Q&A <b>", "<https://example.com/?a=1&amp;b=2|Q&amp;A &lt;b&gt;>"},
+		{"https://example.com/a|b", "x|y", "<https://example.com/a%7Cb|x|y>"},
+	}
+	for _, tt := range tests {
+		if got := slackLink(tt.target, tt.text); got != tt.want {
+			t.Errorf("slackLink(%q, %q) = %q, want %q", tt.target, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookRequest(t *testing.T) {
+	tests := []struct {
+		kind       string
+		wantMethod string
+		wantTarget string
+		want       map[string]any
+	}{
+		{
+			kind:       "slack",
+			wantMethod: http.MethodPost,
+			wantTarget: "https://hooks.example.com/x/",
+			want: map[string]any{
+				"text":         "*<https://example.com/post?a=1&amp;b=2%7C3|Q&amp;A: &lt;b&gt;tags&lt;/b&gt; and | pipes>*\n_Tom &amp; Jerry's &lt;blog&gt;_\nFish &amp; chips",
+				"unfurl_links": false,
+			},
+		},
+		{
+			kind:       "discord",
+			wantMethod: http.MethodPost,
+			wantTarget: "https://hooks.example.com/x/",
+			want: map[string]any{
+				"username": "gator",
+				"embeds": []any{map[string]any{
+					"title":       "Q&A: <b>tags</b> and | pipes",
+					"url":         "https://example.com/post?a=1&b=2|3",
+					"timestamp":   "2024-03-01T12:00:00Z",
+					"footer":      map[string]any{"text": "Tom & Jerry's <blog>"},
+					"description": "Fish & chips",
+					"author":      map[string]any{"name": "Ann"},
+				}},
+			},
+		},
+		{
+			kind:       "matrix",
+			wantMethod: http.MethodPut,
+			wantTarget: "https://hooks.example.com/x/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/6f1c2a4e-8b3d-4c5e-9f70-1a2b3c4d5e6f",
+			want: map[string]any{
+				"msgtype":        "m.text",
+				"body":           "Q&A: <b>tags</b> and | pipes\nhttps://example.com/post?a=1&b=2|3\nTom & Jerry's <blog>\nFish & chips",
+				"format":         "org.matrix.custom.html",
+				"formatted_body": `<a href="https://example.com/post?a=1&amp;b=2|3">Q&amp;A: &lt;b&gt;tags&lt;/b&gt; and | pipes</a><br><em>Tom &amp; Jerry&#39;s &lt;blog&gt;</em><br>Fish &amp; chips`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			method, target, body, err := webhookRequest(testDelivery(tt.kind, "https://hooks.example.com/x/"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if method != tt.wantMethod {
+				t.Errorf("method = %s, want %s", method, tt.wantMethod)
+			}
+			if target != tt.wantTarget {
+				t.Errorf("target = %s, want %s", target, tt.wantTarget)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("body is not json: %v", err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("body = %s\nwant %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestSendWebhookSignature(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   string
+	}
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header.Clone(), body: string(body)}
+	}))
+	defer server.Close()
+
+	fetcher, err := newFeedFetcher(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &state{}
+	s.fetcher.Store(fetcher)
+
+	status, _, err := sendWebhook(context.Background(), s, testDelivery("slack", server.URL), time.Unix(1700000000, 0))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("sendWebhook = %d, %v, want 200", status, err)
+	}
+	got := <-requests
+
+	//the signature is the hex hmac-sha256, keyed with "hunter2", of "1700000000." and this body
+	//json.Marshal escapes <, > and & in strings
+	wantBody := `{"text":"*\u003chttps://example.com/post?a=1\u0026amp;b=2%7C3|Q\u0026amp;A: \u0026lt;b\u0026gt;tags\u0026lt;/b\u0026gt; and | pipes\u003e*\n_Tom \u0026amp; Jerry's \u0026lt;blog\u0026gt;_\nFish \u0026amp; chips","unfurl_links":false}`
+	if got.body != wantBody {
+		t.Errorf("body = %s\nwant %s", got.body, wantBody)
+	}
+	wantHeaders := map[string]string{
+		"X-Gator-Timestamp": "1700000000",
+		"X-Gator-Signature": "sha256=76dc3464ca21b14560f5eea75f8b15624aa47c9216b0ddfeec650185f851edd4",
+		"X-Gator-Event":     "post.created",
+		"X-Gator-Delivery":  "6f1c2a4e-8b3d-4c5e-9f70-1a2b3c4d5e6f",
+		"Content-Type":      "application/json",
+		"Authorization":     "",
+	}
+	for name, want := range wantHeaders {
+		if value := got.header.Get(name); value != want {
+			t.Errorf("%s = %q, want %q", name, value, want)
+		}
+	}
+}
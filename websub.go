@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/gator/internal/database"
+)
+
+const (
+	//the lease gator asks hubs for, in seconds
+	webSubLeaseSeconds = 10 * 24 * 60 * 60
+	//how long a subscription request that was not verified is given before asking again,
+	//and how long to wait before asking a hub that denied one again
+	webSubRetryAfter       = time.Hour
+	webSubDeniedRetryAfter = 24 * time.Hour
+	//how many verified pushes may wait for the aggregator loop, how long a hub request may take,
+	//and how much of an error response is kept
+	webSubQueueSize     = 64
+	webSubTimeout       = 15 * time.Second
+	webSubMaxErrorBytes = 300
+)
+
+type webSub struct {
+	//the public url callbacks are made under, and the pushes waiting for the aggregator loop
+	callbackURL string
+	pushes      chan webSubPush
+}
+
+type webSubPush struct {
+	//feed content a hub pushed, once its signature has been checked
+	subscriptionID uuid.UUID
+	feedID         uuid.UUID
+	body           []byte
+	contentType    string
+}
+
+func (w *webSub) callback(subscriptionID uuid.UUID) string {
+	//func that returns the url a hub calls back for a subscription
+	return w.callbackURL + "/websub/" + subscriptionID.String()
+}
+
+func startWebSubServer(s *state, addr, callbackURL string) (func(), error) {
+	//func that serves websub callbacks on addr until the returned func is called
+	//verified pushes are handed to the aggregator loop, so they are stored one at a time with the scrapes
+	if addr == "" || callbackURL == "" {
+		return nil, errors.New("websub_addr and websub_callback_url must be set together")
+	}
+	base, err := url.Parse(callbackURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid websub_callback_url %q: use an http or https url", callbackURL)
+	}
+	ws := &webSub{callbackURL: strings.TrimRight(base.String(), "/"),
+		pushes: make(chan webSubPush, webSubQueueSize),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /websub/{id}", webSubVerifyHandler(s))
+	mux.HandleFunc("POST /websub/{id}", webSubPushHandler(s, ws, s.fetcher.Load().maxBodyBytes))
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s: %w", addr, err)
+	}
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	s.websub = ws
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("websub server stopped", "err", err)
+		}
+	}()
+	s.logger.Info("serving websub callbacks", "addr", listener.Addr().String(), "callback_url", ws.callbackURL)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
+
+func webSubSubscription(s *state, w http.ResponseWriter, r *http.Request) (database.WebsubSubscription, bool) {
+	//func that looks up the subscription a callback is for, writing the error response when there is none
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return database.WebsubSubscription{}, false
+	}
+	sub, err := s.db.GetWebSubSubscription(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		//the feed was deleted, and hubs take 410 as a sign to stop pushing
+		http.Error(w, "no such subscription", http.StatusGone)
+		return sub, false
+	}
+	if err != nil {
+		s.logger.Error("could not get websub subscription", "subscription_id", id, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return sub, false
+	}
+	return sub, true
+}
+
+func webSubVerifyHandler(s *state) http.HandlerFunc {
+	//func that answers a hub verifying a subscription gator asked for, or telling it the subscription was denied
+	//gator never unsubscribes, it lets leases run out, so any other intent is refused
+	return func(w http.ResponseWriter, r *http.Request) {
+		sub, ok := webSubSubscription(s, w, r)
+		if !ok {
+			return
+		}
+		log := s.logger.With("feed_id", sub.FeedID, "hub", sub.HubUrl)
+		query := r.URL.Query()
+		if topic := query.Get("hub.topic"); topic != sub.TopicUrl {
+			log.Warn("websub verification for another topic", "topic", topic)
+			http.NotFound(w, r)
+			return
+		}
+
+		switch query.Get("hub.mode") {
+		case "subscribe":
+			leaseSeconds, err := strconv.ParseInt(query.Get("hub.lease_seconds"), 10, 32)
+			challenge := query.Get("hub.challenge")
+			if err != nil || leaseSeconds <= 0 || challenge == "" {
+				log.Warn("websub verification without a lease or challenge")
+				http.Error(w, "missing hub.lease_seconds or hub.challenge", http.StatusBadRequest)
+				return
+			}
+			err = s.db.ActivateWebSubSubscription(r.Context(), database.ActivateWebSubSubscriptionParams{ID: sub.ID, LeaseSeconds: int32(leaseSeconds)})
+			if err != nil {
+				log.Error("could not activate websub subscription", "err", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			log.Info("websub subscription verified", "lease", time.Duration(leaseSeconds)*time.Second)
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, challenge)
+		case "denied":
+			reason := query.Get("hub.reason")
+			err := s.db.DenyWebSubSubscription(r.Context(), database.DenyWebSubSubscriptionParams{ID: sub.ID, Reason: reason})
+			if err != nil {
+				log.Error("could not record denied websub subscription", "err", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			log.Warn("websub subscription denied", "reason", reason)
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func webSubPushHandler(s *state, ws *webSub, maxBytes int64) http.HandlerFunc {
+	//func that takes content a hub pushes and queues it for the aggregator loop
+	//pushes with a missing or bad signature are acknowledged all the same, as the spec asks, but dropped
+	return func(w http.ResponseWriter, r *http.Request) {
+		sub, ok := webSubSubscription(s, w, r)
+		if !ok {
+			return
+		}
+		log := s.logger.With("feed_id", sub.FeedID, "hub", sub.HubUrl)
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+		if err != nil {
+			log.Warn("could not read websub push", "err", err)
+			http.Error(w, "could not read body", http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > maxBytes {
+			log.Warn("websub push too large", "max_bytes", maxBytes)
+			http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !validHubSignature(sub.Secret, r.Header.Get("X-Hub-Signature"), body) {
+			metricWebSubPushes.WithLabelValues("bad_signature").Inc()
+			log.Warn("ignoring websub push with a bad signature")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		push := webSubPush{subscriptionID: sub.ID, feedID: sub.FeedID, body: body, contentType: r.Header.Get("Content-Type")}
+		select {
+		case ws.pushes <- push:
+			metricWebSubPushes.WithLabelValues("accepted").Inc()
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			//the hub will try again, and polling picks the items up if it does not
+			metricWebSubPushes.WithLabelValues("dropped").Inc()
+			log.Warn("websub push queue full, dropping push")
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	}
+}
+
+func validHubSignature(secret, header string, body []byte) bool {
+	//func that checks the X-Hub-Signature of a push, "method=hex hmac of the body" keyed with the secret
+	method, signature, ok := strings.Cut(strings.TrimSpace(header), "=")
+	if !ok || secret == "" {
+		return false
+	}
+	var newHash func() hash.Hash
+	switch strings.ToLower(method) {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "sha384":
+		newHash = sha512.New384
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func ingestWebSubPush(ctx context.Context, s *state, push webSubPush) {
+	//func that stores the items of pushed feed content the same way scraped ones are
+	log := s.logger.With("feed_id", push.feedID)
+	feed, err := s.db.GetFeedById(ctx, push.feedID)
+	if err != nil {
+		log.Error("could not get pushed feed", "err", err)
+		return
+	}
+	log = log.With("url", feed.Url)
+
+	feedRSS, err := parseFeed(push.body, push.contentType)
+	if err != nil {
+		metricParseErrors.WithLabelValues("feed").Inc()
+		log.Error("could not parse websub push", "err", err)
+		return
+	}
+	err = s.db.RecordWebSubPush(ctx, push.subscriptionID)
+	if err != nil {
+		log.Warn("could not record websub push", "err", err)
+	}
+
+	itemsNew, itemsUpdated, itemsSkipped := storeFeedItems(ctx, s, feed, feedRSS, log)
+	log.Info("feed pushed",
+		"items_new", itemsNew,
+		"items_updated", itemsUpdated,
+		"items_skipped", itemsSkipped,
+	)
+}
+
+func webSubStatus(s *state, feedID uuid.UUID) (string, error) {
+	//func that describes the websub subscription of a feed for the feeds command, or "" when it has none
+	sub, err := s.db.GetWebSubSubscriptionForFeed(context.Background(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", dbError(err, "could not get websub subscription")
+	}
+	switch {
+	case sub.Status == "active" && sub.LeaseExpiresAt.Valid:
+		return fmt.Sprintf("active until %s via %s", formatTime(sub.LeaseExpiresAt.Time), sub.HubUrl), nil
+	case sub.LastError != "":
+		return fmt.Sprintf("%s via %s (%s)", sub.Status, sub.HubUrl, sub.LastError), nil
+	default:
+		return fmt.Sprintf("%s via %s", sub.Status, sub.HubUrl), nil
+	}
+}
+
+func discoverHubs(feed *RSSFeed, response *http.Response) {
+	//func that finds the websub hubs and self url a feed advertised
+	//Link headers come first, since the spec prefers them to the atom:link elements in the body
+	var links []RSSLink
+	for _, value := range response.Header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			link = strings.TrimSpace(link)
+			end := strings.Index(link, ">")
+			if !strings.HasPrefix(link, "<") || end < 0 {
+				continue
+			}
+			for _, param := range strings.Split(link[end+1:], ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(strings.TrimSpace(name), "rel") {
+					links = append(links, RSSLink{Href: link[1:end], Rel: strings.Trim(strings.TrimSpace(value), `"`)})
+				}
+			}
+		}
+	}
+	links = append(links, feed.Channel.Link...)
+
+	seen := make(map[string]bool)
+	for _, link := range links {
+		if strings.TrimSpace(link.Href) == "" {
+			continue
+		}
+		href, err := response.Request.URL.Parse(strings.TrimSpace(link.Href))
+		if err != nil {
+			continue
+		}
+		for _, rel := range strings.Fields(strings.ToLower(link.Rel)) {
+			switch {
+			case rel == "hub" && !seen[href.String()]:
+				seen[href.String()] = true
+				feed.Hubs = append(feed.Hubs, href.String())
+			case rel == "self" && feed.Self == "":
+				feed.Self = href.String()
+			}
+		}
+	}
+}
+
+func subscribeWebSub(ctx context.Context, s *state, feed database.Feed, feedRSS *RSSFeed, log *slog.Logger) {
+	//func that asks the hub a scraped feed advertises to push it, unless that has already been asked
+	//the topic is the url the feed gives for itself, which is the one hubs know it by
+	if len(feedRSS.Hubs) == 0 {
+		return
+	}
+	hub := feedRSS.Hubs[0]
+	topic := feedRSS.Self
+	if topic == "" {
+		topic = feed.Url
+		if feedRSS.MovedTo != "" {
+			topic = feedRSS.MovedTo
+		}
+	}
+
+	sub, err := s.db.GetWebSubSubscriptionForFeed(ctx, feed.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Warn("could not get websub subscription", "err", err)
+		return
+	}
+	if err == nil && sub.HubUrl == hub && sub.TopicUrl == topic {
+		if webSubRequestDue(sub, time.Now()) {
+			requestWebSub(ctx, s, sub, log)
+		}
+		return
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Warn("could not make websub secret", "err", err)
+		return
+	}
+	sub, err = s.db.CreateWebSubSubscription(ctx, database.CreateWebSubSubscriptionParams{ID: uuid.New(),
+		FeedID:   feed.ID,
+		HubUrl:   hub,
+		TopicUrl: topic,
+		Secret:   hex.EncodeToString(key),
+	})
+	if err != nil {
+		log.Warn("could not create websub subscription", "err", err)
+		return
+	}
+	requestWebSub(ctx, s, sub, log)
+}
+
+func webSubRequestDue(sub database.WebsubSubscription, now time.Time) bool {
+	//func that reports whether a subscription that was not verified should be asked for again
+	//active ones are renewed by renewWebSubs as their leases run out
+	switch sub.Status {
+	case "active":
+		return false
+	case "denied":
+		return now.Sub(sub.RequestedAt) > webSubDeniedRetryAfter
+	default:
+		return now.Sub(sub.RequestedAt) > webSubRetryAfter
+	}
+}
+
+func renewWebSubs(ctx context.Context, s *state) {
+	//func that asks hubs to renew the subscriptions whose leases are running out
+	subs, err := s.db.GetWebSubSubscriptionsToRenew(ctx)
+	if err != nil {
+		s.logger.Error("could not get websub subscriptions to renew", "err", err)
+		return
+	}
+	for _, sub := range subs {
+		if ctx.Err() != nil {
+			return
+		}
+		requestWebSub(ctx, s, sub, s.logger.With("feed_id", sub.FeedID))
+	}
+}
+
+func requestWebSub(ctx context.Context, s *state, sub database.WebsubSubscription, log *slog.Logger) {
+	//func that sends a subscription request to a hub and records how it went
+	//the hub answers by calling back to verify it, which is when the subscription becomes active
+	log = log.With("hub", sub.HubUrl, "topic", sub.TopicUrl)
+	form := url.Values{"hub.mode": {"subscribe"},
+		"hub.topic":         {sub.TopicUrl},
+		"hub.callback":      {s.websub.callback(sub.ID)},
+		"hub.secret":        {sub.Secret},
+		"hub.lease_seconds": {strconv.Itoa(webSubLeaseSeconds)},
+	}
+	lastError := ""
+	err := postHubRequest(ctx, s, sub.HubUrl, form)
+	if err != nil {
+		lastError = err.Error()
+		log.Warn("could not subscribe to websub hub", "err", err)
+	} else {
+		log.Info("asked websub hub to push feed")
+	}
+
+	err = s.db.RecordWebSubRequest(ctx, database.RecordWebSubRequestParams{ID: sub.ID, LastError: lastError})
+	if err != nil {
+		log.Error("could not record websub request", "err", err)
+	}
+}
+
+func postHubRequest(ctx context.Context, s *state, hubURL string, form url.Values) error {
+	//func that posts a form to a hub, which accepts it with a 2xx status
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, hubURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	fetcher := s.fetcher.Load()
+	request.Header.Set("User-Agent", fetcher.userAgent)
+
+	//redirects are not followed, since they would turn the post into a get
+	client := &http.Client{Transport: fetcher.client.Transport,
+		Timeout: webSubTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(response.Body, webSubMaxErrorBytes))
+	if text := strings.TrimSpace(string(message)); text != "" {
+		return fmt.Errorf("unexpected status %s: %s", response.Status, text)
+	}
+	return fmt.Errorf("unexpected status %s", response.Status)
+}
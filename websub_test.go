@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestValidHubSignature(t *testing.T) {
+	//the signatures are hmacs of body keyed with "topsecret", worked out outside gator
+	body := []byte("<feed>hello</feed>")
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		want   bool
+	}{
+		{"sha1", "topsecret", "sha1=d076f62c7054f5805269d6915f4f97068258d1ec", true},
+		{"sha256", "topsecret", "sha256=c62a3bbfafe2564c3f69c9396621f1ba2e6845c60297ac0d28678a7e4f8ad6d9", true},
+		{"sha512", "topsecret", "sha512=c00faf3c819e7af23366510c41294a290e9da8be773b8534ccb80968bfeaf4b0b997c577d7e30a76f80efb6d503b4bb604a811606d28297ea35134e5cb84f570", true},
+		{"method is case insensitive", "topsecret", "SHA256=c62a3bbfafe2564c3f69c9396621f1ba2e6845c60297ac0d28678a7e4f8ad6d9", true},
+		{"signed with another secret", "topsecret", "sha256=3eb38843e7f980ec52f670fe3ccfa11470849eea93ad9cf2d6cee4ba4eb1a3ad", false},
+		{"wrong method for the signature", "topsecret", "sha1=c62a3bbfafe2564c3f69c9396621f1ba2e6845c60297ac0d28678a7e4f8ad6d9", false},
+		{"truncated signature", "topsecret", "sha256=c62a3bbfafe2564c3f69c9396621f1ba", false},
+		{"not hex", "topsecret", "sha256=not-a-signature", false},
+		{"unknown method", "topsecret", "md5=c62a3bbfafe2564c3f69c9396621f1ba2e6845c60297ac0d28678a7e4f8ad6d9", false},
+		{"no method", "topsecret", "c62a3bbfafe2564c3f69c9396621f1ba2e6845c60297ac0d28678a7e4f8ad6d9", false},
+		{"missing header", "topsecret", "", false},
+		{"no secret", "", "sha256=c62a3bbfafe2564c3f69c9396621f1ba2e6845c60297ac0d28678a7e4f8ad6d9", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validHubSignature(tt.secret, tt.header, body); got != tt.want {
+				t.Errorf("validHubSignature(%q, %q) = %v, want %v", tt.secret, tt.header, got, tt.want)
+			}
+		})
+	}
+}